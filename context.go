@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/flosch/pongo2/v6"
+	"gopkg.in/yaml.v3"
+)
+
+// defineFlags collects repeated -D key=value flags.
+type defineFlags []string
+
+func (d *defineFlags) String() string {
+	return strings.Join(*d, ",")
+}
+
+func (d *defineFlags) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	*d = append(*d, value)
+	return nil
+}
+
+// buildContext loads the object in contextFile (if any), YAML for a .yaml or
+// .yml file and JSON otherwise, and applies the -D overrides on top of it. A
+// dotted key like server.port sets a nested value.
+func buildContext(contextFile string, defines []string) (pongo2.Context, error) {
+	ctx := pongo2.Context{}
+
+	if contextFile != "" {
+		data, err := os.ReadFile(contextFile)
+		if err != nil {
+			return nil, err
+		}
+		var values map[string]any
+		switch filepath.Ext(contextFile) {
+		case ".yaml", ".yml":
+			if err := yaml.Unmarshal(data, &values); err != nil {
+				return nil, fmt.Errorf("%s: invalid YAML context: %v", contextFile, err)
+			}
+		default:
+			if err := json.Unmarshal(data, &values); err != nil {
+				return nil, fmt.Errorf("%s: invalid JSON context: %v", contextFile, err)
+			}
+		}
+		for k, v := range values {
+			ctx[k] = normalizeJSON(v)
+		}
+	}
+
+	for _, def := range defines {
+		key, value, _ := strings.Cut(def, "=")
+		if err := setContextValue(ctx, key, parseDefine(value)); err != nil {
+			return nil, fmt.Errorf("-D %s: %v", def, err)
+		}
+	}
+
+	return ctx, nil
+}
+
+func setContextValue(ctx pongo2.Context, key string, value any) error {
+	parts := strings.Split(key, ".")
+	current := map[string]any(ctx)
+	for i, part := range parts {
+		if part == "" {
+			return fmt.Errorf("empty key segment in %q", key)
+		}
+		if i == len(parts)-1 {
+			current[part] = value
+			return nil
+		}
+		next, ok := current[part].(map[string]any)
+		if !ok {
+			if _, exists := current[part]; exists {
+				return fmt.Errorf("%q is not an object", strings.Join(parts[:i+1], "."))
+			}
+			next = map[string]any{}
+			current[part] = next
+		}
+		current = next
+	}
+	return nil
+}
+
+// parseDefine converts a -D value to an int or bool when it looks like one,
+// and keeps it as a string otherwise.
+func parseDefine(value string) any {
+	if n, err := strconv.Atoi(value); err == nil {
+		return n
+	}
+	switch value {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return value
+}
+
+// normalizeJSON turns whole JSON numbers (and YAML floats like 8080.0) into
+// ints so templates render 8080 rather than 8080.000000.
+func normalizeJSON(v any) any {
+	switch val := v.(type) {
+	case float64:
+		if val == math.Trunc(val) && math.Abs(val) < 1<<53 {
+			return int(val)
+		}
+		return val
+	case map[string]any:
+		for k, item := range val {
+			val[k] = normalizeJSON(item)
+		}
+		return val
+	case []any:
+		for i, item := range val {
+			val[i] = normalizeJSON(item)
+		}
+		return val
+	}
+	return v
+}
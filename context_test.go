@@ -0,0 +1,139 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func TestBuildContextFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"cfg.json": `{"name": "app", "server": {"port": 8080, "ratio": 0.5, "tags": [1, "x"]}}`,
+		"cfg.yaml": "name: app\nserver:\n  port: 8080\n  ratio: 0.5\n  tags: [1, x]\n",
+		"cfg.yml":  "name: app\nserver: {port: 8080.0, ratio: 0.5, tags: [1, x]}\n",
+	})
+	want := pongo2.Context{
+		"name":   "app",
+		"server": map[string]any{"port": 8080, "ratio": 0.5, "tags": []any{1, "x"}},
+	}
+	for _, name := range []string{"cfg.json", "cfg.yaml", "cfg.yml"} {
+		ctx, err := buildContext(filepath.Join(dir, name), nil)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if !reflect.DeepEqual(ctx, want) {
+			t.Errorf("%s: got %#v, want %#v", name, ctx, want)
+		}
+	}
+
+	tpl := pongo2.Must(pongo2.FromString(`{{ name }}:{{ server.port }}`))
+	ctx, _ := buildContext(filepath.Join(dir, "cfg.json"), nil)
+	if out, err := tpl.Execute(ctx); err != nil || out != "app:8080" {
+		t.Errorf("nested lookup gave %q, %v", out, err)
+	}
+}
+
+func TestBuildContextDefines(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"cfg.json": `{"name": "app", "debug": false, "server": {"port": 80, "host": "localhost"}}`,
+	})
+	ctx, err := buildContext(filepath.Join(dir, "cfg.json"), []string{
+		"server.port=8080",
+		"debug=true",
+		"name=other",
+		"buf.size=4096",
+		"buf.label=01x",
+		"empty=",
+		"url=http://example.com/?a=b",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := pongo2.Context{
+		"name":   "other",
+		"debug":  true,
+		"server": map[string]any{"port": 8080, "host": "localhost"},
+		"buf":    map[string]any{"size": 4096, "label": "01x"},
+		"empty":  "",
+		"url":    "http://example.com/?a=b",
+	}
+	if !reflect.DeepEqual(ctx, want) {
+		t.Errorf("got %#v, want %#v", ctx, want)
+	}
+}
+
+func TestBuildContextErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"cfg.json":  `{"server": {"port": 80}, "name": "app"}`,
+		"bad.json":  `{"name": "app",}`,
+		"bad.yaml":  "name: [app\n",
+		"list.json": `[1, 2]`,
+	})
+	tests := []struct {
+		file    string
+		defines []string
+		want    string
+	}{
+		{"bad.json", nil, "bad.json: invalid JSON context"},
+		{"list.json", nil, "list.json: invalid JSON context"},
+		{"bad.yaml", nil, "bad.yaml: invalid YAML context"},
+		{"missing.json", nil, "missing.json"},
+		{"cfg.json", []string{"name.first=Ada"}, `-D name.first=Ada: "name" is not an object`},
+		{"cfg.json", []string{"server.port.max=9"}, `-D server.port.max=9: "server.port" is not an object`},
+		{"", []string{"a=1", "a.b=2"}, `-D a.b=2: "a" is not an object`},
+		{"", []string{"a..b=1"}, `-D a..b=1: empty key segment in "a..b"`},
+		{"", []string{"=1"}, `-D =1: empty key segment in ""`},
+	}
+	for _, tt := range tests {
+		file := tt.file
+		if file != "" {
+			file = filepath.Join(dir, file)
+		}
+		_, err := buildContext(file, tt.defines)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s %q: got error %v, want %q", tt.file, tt.defines, err, tt.want)
+		}
+	}
+}
+
+func TestDefineFlag(t *testing.T) {
+	var d defineFlags
+	for _, value := range []string{"a=1", "b.c=x=y"} {
+		if err := d.Set(value); err != nil {
+			t.Errorf("Set(%q): %v", value, err)
+		}
+	}
+	if err := d.Set("novalue"); err == nil || !strings.Contains(err.Error(), `expected key=value, got "novalue"`) {
+		t.Errorf("Set(novalue): got %v", err)
+	}
+	if got := d.String(); got != "a=1,b.c=x=y" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestParseDefine(t *testing.T) {
+	tests := []struct {
+		in   string
+		want any
+	}{
+		{"8080", 8080},
+		{"-3", -3},
+		{"true", true},
+		{"false", false},
+		{"True", "True"},
+		{"1.5", "1.5"},
+		{"0x10", "0x10"},
+		{"", ""},
+		{"hello world", "hello world"},
+	}
+	for _, tt := range tests {
+		if got := parseDefine(tt.in); got != tt.want {
+			t.Errorf("parseDefine(%q) = %#v, want %#v", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+var warnedNoClangFormat bool
+
+// formatGeneratedCode formats filename in place with clang-format, falling
+// back to the built-in indenter when clang-format is not installed.
+func formatGeneratedCode(filename string) error {
+	path, err := exec.LookPath("clang-format")
+	if err != nil {
+		if !warnedNoClangFormat {
+			fmt.Fprintln(os.Stderr, "Warning: clang-format not found, using built-in formatter")
+			warnedNoClangFormat = true
+		}
+		return formatFileBuiltin(filename)
+	}
+
+	cmd := exec.Command(path, "-i", filename)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("clang-format %s: %v: %s", filename, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func formatFileBuiltin(filename string) error {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, []byte(indentC(string(src))), 0o644)
+}
+
+// indentC re-indents C source by brace depth and strips trailing whitespace.
+// Preprocessor directives stay at column 0 and macro continuation lines are
+// left alone. Braces inside string/char literals and comments are ignored.
+func indentC(src string) string {
+	var out strings.Builder
+	depth := 0
+	inComment := false
+	continuation := false
+
+	for _, line := range strings.Split(src, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		trimmed := strings.TrimLeft(line, " \t")
+
+		switch {
+		case continuation:
+			out.WriteString(line)
+		case inComment:
+			out.WriteString(line)
+		case trimmed == "":
+		case strings.HasPrefix(trimmed, "#"):
+			out.WriteString(trimmed)
+		default:
+			lineDepth := depth
+			if strings.HasPrefix(trimmed, "}") {
+				lineDepth--
+			}
+			if lineDepth < 0 {
+				lineDepth = 0
+			}
+			out.WriteString(strings.Repeat("    ", lineDepth))
+			out.WriteString(trimmed)
+		}
+		out.WriteByte('\n')
+
+		wasContinuation := continuation
+		continuation = strings.HasSuffix(line, "\\")
+		if wasContinuation || strings.HasPrefix(trimmed, "#") {
+			// Macro bodies don't affect the surrounding indentation, but
+			// block comments opened inside them still need tracking.
+			_, inComment = braceDelta(trimmed, inComment)
+			continue
+		}
+
+		var delta int
+		delta, inComment = braceDelta(trimmed, inComment)
+		depth += delta
+		if depth < 0 {
+			depth = 0
+		}
+	}
+
+	return strings.TrimRight(out.String(), "\n") + "\n"
+}
+
+// braceDelta returns the net brace depth change for one line of C, and
+// whether the line ends inside a block comment.
+func braceDelta(line string, inComment bool) (int, bool) {
+	delta := 0
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case inComment:
+			if c == '*' && i+1 < len(line) && line[i+1] == '/' {
+				inComment = false
+				i++
+			}
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '/' && i+1 < len(line) && line[i+1] == '/':
+			return delta, false
+		case c == '/' && i+1 < len(line) && line[i+1] == '*':
+			inComment = true
+			i++
+		case c == '{':
+			delta++
+		case c == '}':
+			delta--
+		}
+	}
+	return delta, inComment
+}
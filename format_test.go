@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBraceDelta(t *testing.T) {
+	tests := []struct {
+		line        string
+		inComment   bool
+		delta       int
+		stillInside bool
+	}{
+		{"int main(void) {", false, 1, false},
+		{"} else {", false, 0, false},
+		{"}}", false, -2, false},
+		{`puts("{ not a block");`, false, 0, false},
+		{`puts("escaped \" { quote");`, false, 0, false},
+		{`puts("ends in backslash \\"); {`, false, 1, false},
+		{`char open = '{', close = '}';`, false, 0, false},
+		{`char quote = '\'', brace = '{';`, false, 0, false},
+		{"if (x) { // }", false, 1, false},
+		{"// { whole line", false, 0, false},
+		{"x = 1; /* { */ {", false, 1, false},
+		{"/* starts a comment {", false, 0, true},
+		{"still { inside", true, 0, true},
+		{"} closed */ }", true, -1, false},
+		{`"/* not a comment" {`, false, 1, false},
+		{`'"' {`, false, 1, false},
+	}
+	for _, tt := range tests {
+		delta, inside := braceDelta(tt.line, tt.inComment)
+		if delta != tt.delta || inside != tt.stillInside {
+			t.Errorf("braceDelta(%q, %v) = %d, %v; want %d, %v",
+				tt.line, tt.inComment, delta, inside, tt.delta, tt.stillInside)
+		}
+	}
+}
+
+func TestIndentC(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{
+			"nesting and trailing whitespace",
+			"int main(void) {   \nif (x) {\n\t\treturn 1;\n} else {\nreturn 0;\n}\n}\n\n\n",
+			"int main(void) {\n    if (x) {\n        return 1;\n    } else {\n        return 0;\n    }\n}\n",
+		},
+		{
+			"braces in literals",
+			"void f(void) {\nputs(\"}\");\nchar c = '{';\nputs(\"\\\"{\");\nreturn;\n}\n",
+			"void f(void) {\n    puts(\"}\");\n    char c = '{';\n    puts(\"\\\"{\");\n    return;\n}\n",
+		},
+		{
+			"braces in comments",
+			"void f(void) {\n// }\n/* { */\n/* a comment\n   spanning } lines\n*/\nreturn;\n}\n",
+			"void f(void) {\n    // }\n    /* { */\n    /* a comment\n   spanning } lines\n*/\n    return;\n}\n",
+		},
+		{
+			"preprocessor and macro bodies",
+			"  #include <stdio.h>\n#define BLOCK(x) do { \\\n    x; \\\n} while (0)\nint g(void) {\n#ifdef X\nreturn 1;\n#endif\nreturn 0;\n}\n",
+			"#include <stdio.h>\n#define BLOCK(x) do { \\\n    x; \\\n} while (0)\nint g(void) {\n#ifdef X\n    return 1;\n#endif\n    return 0;\n}\n",
+		},
+		{
+			"unbalanced closing brace",
+			"}\nint x;\n",
+			"}\nint x;\n",
+		},
+		{
+			"blank lines kept inside blocks",
+			"void f(void) {\n    int a;\n   \n    int b;\n}",
+			"void f(void) {\n    int a;\n\n    int b;\n}\n",
+		},
+	}
+	for _, tt := range tests {
+		if got := indentC(tt.src); got != tt.want {
+			t.Errorf("%s: indentC gave\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFormatFileBuiltin(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.c")
+	if err := os.WriteFile(path, []byte("int main(void) {\nreturn 0;  \n}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := formatFileBuiltin(path); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readFile(t, path), "int main(void) {\n    return 0;\n}\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if err := formatFileBuiltin(filepath.Join(t.TempDir(), "missing.c")); err == nil {
+		t.Error("formatting a missing file succeeded")
+	}
+}
@@ -2,4 +2,10 @@ module cccp
 
 go 1.25.4
 
-require github.com/flosch/pongo2/v6 v6.0.0 // indirect
+require (
+	github.com/flosch/pongo2/v6 v6.0.0
+	github.com/fsnotify/fsnotify v1.10.1
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/sys v0.13.0 // indirect
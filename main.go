@@ -1,42 +1,253 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"io/fs"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
 
 	"cccp/pkg/generators"
 
 	"github.com/flosch/pongo2/v6"
 )
 
+type options struct {
+	srcDir        string
+	outDir        string
+	contextFile   string
+	defines       defineFlags
+	copyAssets    bool
+	noFormat      bool
+	shortcodesDir string
+}
+
 func main() {
+	var opts options
+	flag.BoolVar(&opts.noFormat, "no-format", false, "skip formatting the generated C code")
+	flag.StringVar(&opts.contextFile, "context", "", "JSON or YAML (.yaml, .yml) `file` whose top-level object becomes the template context")
+	flag.Var(&opts.defines, "D", "set template context `key=value` (repeatable, dotted keys nest; overrides --context)")
+	flag.StringVar(&opts.srcDir, "src-dir", "src", "`directory` searched recursively for *.tpl templates; _*.tpl partials are only included")
+	flag.StringVar(&opts.outDir, "out-dir", "output", "`directory` receiving the rendered files")
+	flag.BoolVar(&opts.copyAssets, "copy-assets", false, "copy non-template files from --src-dir verbatim")
+	flag.StringVar(&opts.shortcodesDir, "shortcodes-dir", "shortcodes.d", "`directory` of *.yaml and *.json shortcode specs, skipped if missing")
+	watchMode := flag.Bool("watch", false, "keep running and regenerate when templates or the context file change")
+	flag.Parse()
+
 	// Initialize all generators
-	generators.InitAll()
+	if err := generators.InitAll(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := generators.LoadUserFilters(opts.shortcodesDir); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *watchMode {
+		if err := watch(opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	ctx, err := buildContext(opts.contextFile, opts.defines)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 
-	if err := runGeneration(); err != nil {
+	generated, err := runGeneration(opts, ctx, buildFlags{})
+	if ferr := formatOutputs(opts, generated); ferr != nil {
+		err = errors.Join(err, ferr)
+	}
+
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
-	formatGeneratedCode("output/main.c")
 }
 
-func formatGeneratedCode(filename string) error {
-	cmd := exec.Command("clang-format", "-i", filename)
-	return cmd.Run()
+// runGeneration renders every *.tpl under opts.srcDir into the mirrored path
+// under opts.outDir with the .tpl suffix stripped. A failing template doesn't
+// stop the others; all failures are returned together along with the files
+// written.
+func runGeneration(opts options, ctx pongo2.Context, flags buildFlags) ([]string, error) {
+	var generated []string
+	var errs []error
+
+	walkErr := filepath.WalkDir(opts.srcDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		dest, err := generateFile(opts, path, ctx, flags)
+		if err != nil {
+			errs = append(errs, err)
+		} else if dest != "" {
+			generated = append(generated, dest)
+		}
+		return nil
+	})
+	if walkErr != nil {
+		errs = append(errs, walkErr)
+	}
+	if err := flags.write(opts.outDir); err != nil {
+		errs = append(errs, err)
+	}
+
+	return generated, summarizeErrors(errs)
+}
+
+// generateFile renders (or copies) a single file from opts.srcDir and
+// returns its output path, or "" when the file is not part of the output.
+// The link flags a rendered template needs are recorded in flags.
+func generateFile(opts options, path string, ctx pongo2.Context, flags buildFlags) (string, error) {
+	rel, err := filepath.Rel(opts.srcDir, path)
+	if err != nil {
+		return "", err
+	}
+
+	var dest string
+	if isPartial(path) {
+		return "", nil
+	} else if strings.HasSuffix(path, ".tpl") {
+		dest = filepath.Join(opts.outDir, strings.TrimSuffix(rel, ".tpl"))
+		var libs []string
+		libs, err = renderTemplate(opts.srcDir, path, dest, ctx)
+		flags[dest] = libs
+	} else if opts.copyAssets {
+		dest = filepath.Join(opts.outDir, rel)
+		err = copyFile(path, dest)
+	} else {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	return dest, nil
 }
 
-func runGeneration() error {
-	// File operations only - read template, write output
-	tpl, err := pongo2.FromFile("src/main.c.tpl")
+// renderTemplate renders src to dest, prepending any #include the filters
+// used by the template need, and returns the link flags they need.
+// Includes and extends resolve against the including template (see
+// partialLoader).
+func renderTemplate(srcDir, src, dest string, ctx pongo2.Context) ([]string, error) {
+	loader := newPartialLoader()
+	tpl, err := pongo2.NewSet(srcDir, loader).FromFile(src)
+	if err != nil {
+		return nil, loader.explain(err)
+	}
+
+	usage := generators.StartUsage()
+	output, err := tpl.Execute(ctx)
 	if err != nil {
+		return nil, loader.explain(err)
+	}
+	output = prependIncludes(output, usage.Headers())
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return nil, err
+	}
+	return usage.Libs(), os.WriteFile(dest, []byte(output), 0o644)
+}
+
+// prependIncludes adds an #include line for each header not already
+// included by the rendered output.
+func prependIncludes(output string, headers []string) string {
+	var block strings.Builder
+	for _, header := range headers {
+		if includeRe(header).MatchString(output) {
+			continue
+		}
+		fmt.Fprintf(&block, "#include <%s>\n", header)
+	}
+	if block.Len() == 0 {
+		return output
+	}
+	return block.String() + "\n" + output
+}
+
+func includeRe(header string) *regexp.Regexp {
+	return regexp.MustCompile(`(?m)^\s*#\s*include\s*[<"]` + regexp.QuoteMeta(header) + `[>"]`)
+}
+
+// buildFlags maps each generated file to the link flags it needs, so a
+// partial rebuild can still write the flags for the whole tree.
+type buildFlags map[string][]string
+
+// write stores the deduplicated link flags in outDir/build_flags.txt, or
+// removes that file when nothing needs extra libraries.
+func (b buildFlags) write(outDir string) error {
+	var libs []string
+	for _, fileLibs := range b {
+		libs = append(libs, fileLibs...)
+	}
+	slices.Sort(libs)
+	libs = slices.Compact(libs)
+
+	path := filepath.Join(outDir, "build_flags.txt")
+	if len(libs) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
 		return err
 	}
+	return os.WriteFile(path, []byte(strings.Join(libs, " ")+"\n"), 0o644)
+}
 
-	output, err := tpl.Execute(pongo2.Context{})
+func copyFile(src, dest string) error {
+	data, err := os.ReadFile(src)
 	if err != nil {
 		return err
 	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(dest, data, 0o644)
+}
+
+// formatOutputs formats the generated C sources unless --no-format was given.
+func formatOutputs(opts options, generated []string) error {
+	if opts.noFormat {
+		return nil
+	}
+
+	var errs []error
+	for _, filename := range generated {
+		if !isCSource(filename) {
+			continue
+		}
+		if err := formatGeneratedCode(filename); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func summarizeErrors(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d file(s) failed:\n%w", len(errs), errors.Join(errs...))
+}
 
-	return os.WriteFile("output/main.c", []byte(output), 0o644)
+func isCSource(filename string) bool {
+	switch filepath.Ext(filename) {
+	case ".c", ".h":
+		return true
+	}
+	return false
 }
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"cccp/pkg/generators"
+)
+
+func TestRunGeneration(t *testing.T) {
+	if err := generators.InitAll(); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	src, outDir := filepath.Join(dir, "src"), filepath.Join(dir, "out")
+	writeTree(t, src, map[string]string{
+		"main.c.tpl":          "{% include \"_banner.tpl\" %}int main(void) { return {{ code }}; }\n",
+		"_banner.tpl":         "/* {{ name }} */\n",
+		"net/fetch.c.tpl":     "{{ \"page,hdrs\" | http_get : \"$url\" }}\n",
+		"net/broken.c.tpl":    "{% if %}\n",
+		"lib/util.h.tpl":      "#define NAME \"{{ name }}\"\n",
+		"assets/data.csv":     "a,b\n",
+		"assets/nested/x.txt": "x\n",
+	})
+	ctx := map[string]any{"name": "app", "code": 3}
+
+	for _, copyAssets := range []bool{false, true} {
+		os.RemoveAll(outDir)
+		opts := options{srcDir: src, outDir: outDir, copyAssets: copyAssets}
+		generated, err := runGeneration(opts, ctx, buildFlags{})
+
+		brokenPath := filepath.Join(src, "net", "broken.c.tpl")
+		if err == nil || !strings.HasPrefix(err.Error(), "1 file(s) failed:\n"+brokenPath+": ") {
+			t.Errorf("copyAssets=%v: got error %v, want one naming %s", copyAssets, err, brokenPath)
+		}
+
+		want := []string{"lib/util.h", "main.c", "net/fetch.c"}
+		if copyAssets {
+			want = append(want, "assets/data.csv", "assets/nested/x.txt")
+		}
+		var got []string
+		for _, path := range generated {
+			rel, _ := filepath.Rel(outDir, path)
+			got = append(got, filepath.ToSlash(rel))
+		}
+		slices.Sort(got)
+		slices.Sort(want)
+		if !slices.Equal(got, want) {
+			t.Errorf("copyAssets=%v: generated %q, want %q", copyAssets, got, want)
+		}
+
+		for _, missing := range []string{"_banner", "_banner.tpl", "net/broken.c", "main.c.tpl"} {
+			if _, err := os.Stat(filepath.Join(outDir, missing)); !os.IsNotExist(err) {
+				t.Errorf("copyAssets=%v: %s should not be written: %v", copyAssets, missing, err)
+			}
+		}
+	}
+
+	if got, want := readFile(t, filepath.Join(outDir, "main.c")), "/* app */\nint main(void) { return 3; }\n"; got != want {
+		t.Errorf("main.c: got %q, want %q", got, want)
+	}
+	if got := readFile(t, filepath.Join(outDir, "net", "fetch.c")); !strings.HasPrefix(got, "#include <curl/curl.h>\n") || !strings.Contains(got, "curl_easy_setopt") {
+		t.Errorf("net/fetch.c lacks its #include or code:\n%s", got)
+	}
+	if got, want := readFile(t, filepath.Join(outDir, "assets", "data.csv")), "a,b\n"; got != want {
+		t.Errorf("copied asset: got %q, want %q", got, want)
+	}
+	if got, want := readFile(t, filepath.Join(outDir, "build_flags.txt")), "-lcurl\n"; got != want {
+		t.Errorf("build_flags.txt: got %q, want %q", got, want)
+	}
+}
+
+func TestRunGenerationMissingSrcDir(t *testing.T) {
+	opts := options{srcDir: filepath.Join(t.TempDir(), "none"), outDir: t.TempDir()}
+	if _, err := runGeneration(opts, nil, buildFlags{}); err == nil || !strings.Contains(err.Error(), "1 file(s) failed") {
+		t.Errorf("got %v, want the walk error in the summary", err)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// isPartial reports whether a template is only meant to be included or
+// extended: partials start with an underscore and aren't rendered on their
+// own.
+func isPartial(path string) bool {
+	return strings.HasPrefix(filepath.Base(path), "_") && strings.HasSuffix(path, ".tpl")
+}
+
+// partialLoader resolves {% include %}, {% extends %} and {% import %}
+// names for one render. A relative name is relative to the including
+// template. The loader keeps the chain of templates being loaded so an
+// include cycle is reported as soon as it closes.
+type partialLoader struct {
+	stack []string
+	cycle []string
+}
+
+func newPartialLoader() *partialLoader {
+	return &partialLoader{}
+}
+
+func (l *partialLoader) Abs(base, name string) string {
+	if base == "" {
+		// The template being rendered, or a name this loader already
+		// resolved.
+		return filepath.Clean(name)
+	}
+	// pongo2 resolves a template's includes while parsing or executing
+	// it, after the templates it included earlier are done, so whatever
+	// follows base on the stack has finished loading.
+	base = filepath.Clean(base)
+	if i := slices.Index(l.stack, base); i >= 0 {
+		l.stack = l.stack[:i+1]
+	} else {
+		l.stack = []string{base}
+	}
+	if filepath.IsAbs(name) {
+		return filepath.Clean(name)
+	}
+	return filepath.Join(filepath.Dir(base), name)
+}
+
+func (l *partialLoader) Get(path string) (io.Reader, error) {
+	if i := slices.Index(l.stack, path); i >= 0 {
+		l.cycle = append(slices.Clone(l.stack[i:]), path)
+		return nil, fmt.Errorf("include cycle: %s", strings.Join(l.cycle, " -> "))
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	l.stack = append(l.stack, path)
+	return bytes.NewReader(data), nil
+}
+
+// explain adds the include cycle, if there was one, to a render error.
+// pongo2 reports every loader failure as "unable to resolve template".
+func (l *partialLoader) explain(err error) error {
+	if err != nil && l.cycle != nil {
+		return fmt.Errorf("include cycle: %s: %w", strings.Join(l.cycle, " -> "), err)
+	}
+	return err
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTree creates files (slash-separated paths relative to dir) with the
+// given contents.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestIncludeChainResolvesAgainstIncluder(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeTree(t, src, map[string]string{
+		"main.c.tpl":            `{% include "partials/_outer.c.tpl" %}{% for i in repeat %}{% include "partials/_dot.tpl" %}{% endfor %}` + "\n",
+		"partials/_outer.c.tpl": `outer({% include "_inner.c.tpl" %})`,
+		"partials/_inner.c.tpl": `inner {{ name }}`,
+		"partials/_dot.tpl":     `.`,
+		"_inner.c.tpl":          `wrong inner`,
+		"sub/page.c.tpl":        `{% extends "../partials/_base.tpl" %}{% block body %}page{% endblock %}`,
+		"partials/_base.tpl":    `<{% block body %}{% endblock %}>`,
+	})
+	ctx := map[string]any{"name": "cccp", "repeat": make([]int, 100)}
+
+	dest := filepath.Join(dir, "out", "main.c")
+	if _, err := renderTemplate(src, filepath.Join(src, "main.c.tpl"), dest, ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readFile(t, dest), "outer(inner cccp)"+strings.Repeat(".", 100)+"\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	dest = filepath.Join(dir, "out", "page.c")
+	if _, err := renderTemplate(src, filepath.Join(src, "sub", "page.c.tpl"), dest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readFile(t, dest), "<page>"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestIncludeCycleNamesTheChain(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"main.c.tpl":    `{% include "_a.c.tpl" %}`,
+		"_a.c.tpl":      `a {% include "_b.c.tpl" %}`,
+		"_b.c.tpl":      `b {% include "_a.c.tpl" %}`,
+		"self.c.tpl":    `{% extends "self.c.tpl" %}`,
+		"lazy.c.tpl":    `{% include "_lazy.c.tpl" %}`,
+		"_lazy.c.tpl":   `{% include next %}`,
+		"_lazy_b.c.tpl": `{% include "_lazy.c.tpl" with next="_lazy_b.c.tpl" %}`,
+	})
+	tests := []struct {
+		tpl   string
+		chain []string
+	}{
+		{"main.c.tpl", []string{"_a.c.tpl", "_b.c.tpl", "_a.c.tpl"}},
+		{"self.c.tpl", []string{"self.c.tpl", "self.c.tpl"}},
+		{"lazy.c.tpl", []string{"_lazy.c.tpl", "_lazy_b.c.tpl", "_lazy.c.tpl"}},
+	}
+	for _, tt := range tests {
+		var chain []string
+		for _, name := range tt.chain {
+			chain = append(chain, filepath.Join(dir, name))
+		}
+		ctx := map[string]any{"next": "_lazy_b.c.tpl"}
+		_, err := renderTemplate(dir, filepath.Join(dir, tt.tpl), filepath.Join(dir, "out"), ctx)
+		if want := "include cycle: " + strings.Join(chain, " -> "); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: got error %v, want it to contain %q", tt.tpl, err, want)
+		}
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
@@ -0,0 +1,165 @@
+package generators
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func init() {
+	Register(InitArenaFilters)
+}
+
+// Arenas are bump allocators for programs that make many small
+// allocations with a shared lifetime: nothing is freed on its own, and
+// arena_reset or arena_destroy releases everything at once. arena_create,
+// at file scope, declares the arena and static inline <name>_* functions;
+// the other arena_* filters work on an arena by name. Allocations are
+// aligned for any type and exit on out-of-memory.
+func InitArenaFilters() error {
+	var errs []error
+
+	// Blocks are block_size bytes; a bigger allocation gets a block of its
+	// own.
+	// Example usage:
+	// {{ "scratch" | arena_create : "64 * 1024" }}
+	errs = append(errs, registerFilter("arena_create", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		blockSize := strings.TrimSpace(param.String())
+		if blockSize == "" {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("arena_create needs a block size")}
+		}
+		firstUse("arena:" + strings.TrimSpace(in.String()))
+		code := fmt.Sprintf(
+			`struct %[1]s_block {
+    struct %[1]s_block *next;
+    size_t size;
+    size_t used;
+    _Alignas(max_align_t) unsigned char data[];
+};
+
+static struct %[1]s_block *%[1]s = NULL;
+
+static inline void *%[1]s_alloc(size_t n) {
+    const size_t align = _Alignof(max_align_t);
+    const size_t block_size = (size_t)(%[2]s);
+    if (n > SIZE_MAX - align - sizeof(struct %[1]s_block)) {
+        fprintf(stderr, "Allocation too large for arena %[1]s\n");
+        exit(EXIT_FAILURE);
+    }
+    n = n ? (n + align - 1) / align * align : align;
+    if (!%[1]s || %[1]s->size - %[1]s->used < n) {
+        size_t size = n > block_size ? n : block_size;
+        struct %[1]s_block *block = malloc(sizeof(*block) + size);
+        if (!block) {
+            fprintf(stderr, "Failed to get memory for arena %[1]s\n");
+            exit(EXIT_FAILURE);
+        }
+        block->size = size;
+        block->used = 0;
+        if (n > block_size && %[1]s) {
+            // Oversized: chain it behind the current block, which keeps
+            // serving small allocations from its free space.
+            block->next = %[1]s->next;
+            %[1]s->next = block;
+            block->used = n;
+            return block->data;
+        }
+        block->next = %[1]s;
+        %[1]s = block;
+    }
+    void *p = %[1]s->data + %[1]s->used;
+    %[1]s->used += n;
+    return p;
+}
+
+static inline char *%[1]s_strdup(const char *s) {
+    if (!s) {
+        return NULL;
+    }
+    size_t len = strlen(s);
+    char *copy = %[1]s_alloc(len + 1);
+    memcpy(copy, s, len + 1);
+    return copy;
+}
+
+// Keeps the newest block for reuse and frees the rest.
+static inline void %[1]s_reset(void) {
+    if (!%[1]s) {
+        return;
+    }
+    struct %[1]s_block *block = %[1]s->next;
+    while (block) {
+        struct %[1]s_block *next = block->next;
+        free(block);
+        block = next;
+    }
+    %[1]s->next = NULL;
+    %[1]s->used = 0;
+}
+
+static inline void %[1]s_destroy(void) {
+    while (%[1]s) {
+        struct %[1]s_block *next = %[1]s->next;
+        free(%[1]s);
+        %[1]s = next;
+    }
+}`,
+			in.String(), blockSize)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Declares a void* of the given size from the arena.
+	// Example usage:
+	// {{ "nodes" | arena_alloc : "scratch,count * sizeof(struct node)" }}
+	errs = append(errs, registerFilter("arena_alloc", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		parts := strings.SplitN(param.String(), ",", 2)
+		if len(parts) != 2 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("arena_alloc needs arena,size")}
+		}
+		code := fmt.Sprintf("void *%s = %s_alloc(%s);", in.String(), strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Declares a char* copy in the arena, NULL when the input is NULL.
+	// Example usage:
+	// {{ "label" | arena_strdup : "scratch,$name" }}
+	errs = append(errs, registerFilter("arena_strdup", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		parts := strings.SplitN(param.String(), ",", 2)
+		if len(parts) != 2 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("arena_strdup needs arena,string")}
+		}
+		code := fmt.Sprintf("char *%s = %s_strdup(%s);", in.String(), strings.TrimSpace(parts[0]), quoteIfLiteral(parts[1]))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Invalidate everything allocated so far, keeping one block to reuse.
+	// Example usage:
+	// {{ "scratch" | arena_reset }}
+	errs = append(errs, registerFilter("arena_reset", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return pongo2.AsSafeValue(fmt.Sprintf("%s_reset();", in.String())), nil
+	}))
+
+	// Free every block. The arena can be used again afterwards.
+	// Example usage:
+	// {{ "scratch" | arena_destroy }}
+	errs = append(errs, registerFilter("arena_destroy", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return pongo2.AsSafeValue(fmt.Sprintf("%s_destroy();", in.String())), nil
+	}))
+
+	return errors.Join(errs...)
+}
+
+// arenaTarget splits an optional trailing arena name off a string filter's
+// parameter. Only names declared by an earlier arena_create in the same
+// file count, so text like "a, b" is left alone. An empty arena means the
+// usual AUTO_FREE malloc'd result.
+func arenaTarget(param string) (src, arena string) {
+	if i := strings.LastIndex(param, ","); i >= 0 {
+		if arena := strings.TrimSpace(param[i+1:]); marked("arena:" + arena) {
+			return param[:i], arena
+		}
+	}
+	return param, ""
+}
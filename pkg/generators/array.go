@@ -0,0 +1,272 @@
+package generators
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func init() {
+	Register(InitArrayFilters)
+}
+
+// Growable arrays. array_create, at file scope, declares an Array_<name>
+// struct type, an instance named after its input and static inline
+// <name>_* helpers. The other array_* filters work on an array by name and
+// keep size and capacity consistent. Out-of-range indexes print an error
+// and exit unless an ok flag is asked for.
+func InitArrayFilters() error {
+	var errs []error
+
+	// Example usage:
+	// {{ "scores" | array_create : "int" }}
+	errs = append(errs, registerFilter("array_create", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		elemType := strings.TrimSpace(param.String())
+		if elemType == "" {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("array_create needs an element type")}
+		}
+
+		code := fmt.Sprintf(
+			`typedef %[2]s %[1]s_value;
+
+typedef struct {
+    %[1]s_value *data;
+    size_t size;
+    size_t capacity;
+} Array_%[1]s;
+
+static Array_%[1]s %[1]s;
+
+static inline void %[1]s_reserve(Array_%[1]s *a, size_t needed) {
+    if (needed <= a->capacity) {
+        return;
+    }
+    size_t cap = a->capacity ? a->capacity * 2 : 8;
+    while (cap < needed) {
+        cap *= 2;
+    }
+    %[1]s_value *data = realloc(a->data, cap * sizeof(*data));
+    if (!data) {
+        fprintf(stderr, "Failed to get memory for array %[1]s\n");
+        exit(EXIT_FAILURE);
+    }
+    a->data = data;
+    a->capacity = cap;
+}
+
+static inline void %[1]s_check_index(const Array_%[1]s *a, size_t index, size_t limit) {
+    if (index >= limit) {
+        fprintf(stderr, "Index %%zu out of bounds for array %[1]s (size %%zu)\n", index, a->size);
+        exit(EXIT_FAILURE);
+    }
+}
+
+static inline void %[1]s_insert(Array_%[1]s *a, size_t index, %[1]s_value value) {
+    %[1]s_check_index(a, index, a->size + 1);
+    %[1]s_reserve(a, a->size + 1);
+    memmove(&a->data[index + 1], &a->data[index], (a->size - index) * sizeof(*a->data));
+    a->data[index] = value;
+    a->size++;
+}
+
+static inline void %[1]s_remove(Array_%[1]s *a, size_t index) {
+    %[1]s_check_index(a, index, a->size);
+    memmove(&a->data[index], &a->data[index + 1], (a->size - index - 1) * sizeof(*a->data));
+    a->size--;
+}`,
+			in.String(), elemType)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Example usage:
+	// {{ "scores" | array_push : "score" }}
+	errs = append(errs, registerFilter("array_push", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(`%[1]s_insert(&%[1]s, %[1]s.size, %[2]s);`, in.String(), param.String())
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Declares value as a copy of element index. With a second input name
+	// that bool is declared instead of exiting on a bad index, and value is
+	// zeroed.
+	// Example usage:
+	// {{ "best" | array_get : "scores,0" }}
+	// {{ "score,have_score" | array_get : "scores,i" }}
+	errs = append(errs, registerFilter("array_get", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		outs := strings.Split(in.String(), ",")
+		name, index, err := arrayArgs("array_get", param)
+		if err != nil {
+			return nil, err
+		}
+		out := strings.TrimSpace(outs[0])
+		switch len(outs) {
+		case 1:
+			code := fmt.Sprintf(
+				`%[1]s_check_index(&%[1]s, (size_t)(%[3]s), %[1]s.size);
+%[1]s_value %[2]s = %[1]s.data[(size_t)(%[3]s)];`,
+				name, out, index)
+			return pongo2.AsSafeValue(code), nil
+		case 2:
+			ok := strings.TrimSpace(outs[1])
+			code := fmt.Sprintf(
+				`bool %[4]s = (size_t)(%[3]s) < %[1]s.size;
+%[1]s_value %[2]s = {0};
+if (%[4]s) {
+    %[2]s = %[1]s.data[(size_t)(%[3]s)];
+}`,
+				name, out, index, ok)
+			return pongo2.AsSafeValue(code), nil
+		}
+		return nil, &pongo2.Error{OrigError: fmt.Errorf("array_get needs value[,ok] as input")}
+	}))
+
+	// Example usage:
+	// {{ "scores" | array_set : "i,score * 2" }}
+	errs = append(errs, registerFilter("array_set", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		parts := strings.SplitN(param.String(), ",", 2)
+		if len(parts) != 2 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("array_set needs index,value")}
+		}
+		code := fmt.Sprintf(
+			`%[1]s_check_index(&%[1]s, (size_t)(%[2]s), %[1]s.size);
+%[1]s.data[(size_t)(%[2]s)] = %[3]s;`,
+			in.String(), strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Insert before index, shifting later elements up; index may equal the
+	// size to append.
+	// Example usage:
+	// {{ "scores" | array_insert : "1,42" }}
+	errs = append(errs, registerFilter("array_insert", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		parts := strings.SplitN(param.String(), ",", 2)
+		if len(parts) != 2 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("array_insert needs index,value")}
+		}
+		code := fmt.Sprintf(`%[1]s_insert(&%[1]s, (size_t)(%[2]s), %[3]s);`,
+			in.String(), strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Remove element index, shifting later elements down.
+	// Example usage:
+	// {{ "scores" | array_remove : "i" }}
+	errs = append(errs, registerFilter("array_remove", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(`%[1]s_remove(&%[1]s, (size_t)(%[2]s));`, in.String(), param.String())
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Declares value as the removed last element; exits when empty.
+	// Example usage:
+	// {{ "last" | array_pop : "scores" }}
+	errs = append(errs, registerFilter("array_pop", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(
+			`if (%[1]s.size == 0) {
+    fprintf(stderr, "Cannot pop from empty array %[1]s\n");
+    exit(EXIT_FAILURE);
+}
+%[1]s_value %[2]s = %[1]s.data[--%[1]s.size];`,
+			param.String(), in.String())
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Empty the array but keep its memory for reuse.
+	// Example usage:
+	// {{ "scores" | array_clear }}
+	errs = append(errs, registerFilter("array_clear", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(`%[1]s.size = 0;`, in.String())
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Release the array's memory; it is empty and reusable after.
+	// Example usage:
+	// {{ "scores" | array_free }}
+	errs = append(errs, registerFilter("array_free", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(
+			`free(%[1]s.data);
+%[1]s.data = NULL;
+%[1]s.size = 0;
+%[1]s.capacity = 0;`,
+			in.String())
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// A qsort/bsearch comparator, include at file scope. The expression
+	// compares a and b, both const pointers to the element type.
+	// Example usage:
+	// {{ "by_name" | comparator : "char *,strcmp(*a, *b)" }}
+	// {{ "by_age" | comparator : "struct person,(a->age > b->age) - (a->age < b->age)" }}
+	errs = append(errs, registerFilter("comparator", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		parts := strings.SplitN(param.String(), ",", 2)
+		if len(parts) != 2 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("comparator needs type,expression")}
+		}
+		code := fmt.Sprintf(
+			`static int %[1]s(const void *pa, const void *pb) {
+    %[2]s const *a = pa;
+    %[2]s const *b = pb;
+    return %[3]s;
+}`,
+			in.String(), strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Sort an array from array_create with a comparator.
+	// Example usage:
+	// {{ "names" | array_sort : "by_name" }}
+	errs = append(errs, registerFilter("array_sort", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(`qsort(%[1]s.data, %[1]s.size, sizeof(*%[1]s.data), %[2]s);`,
+			in.String(), strings.TrimSpace(param.String()))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Declares index and found for a key in an array sorted with the same
+	// comparator. The key is an element-typed expression and comes last.
+	// Example usage:
+	// {{ "idx,found" | array_bsearch : "names,by_name,\"carol\"" }}
+	errs = append(errs, registerFilter("array_bsearch", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		outs := strings.Split(in.String(), ",")
+		parts := strings.SplitN(param.String(), ",", 3)
+		if len(outs) != 2 || len(parts) != 3 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("array_bsearch needs index,found as input and array,comparator,key")}
+		}
+		index, found := strings.TrimSpace(outs[0]), strings.TrimSpace(outs[1])
+		code := fmt.Sprintf(
+			`size_t %[1]s = 0;
+bool %[2]s = false;
+{
+    %[3]s_value key_%[1]s = %[5]s;
+    %[3]s_value *hit_%[1]s = %[3]s.size ? bsearch(&key_%[1]s, %[3]s.data, %[3]s.size, sizeof(*%[3]s.data), %[4]s) : NULL;
+    if (hit_%[1]s) {
+        %[1]s = (size_t)(hit_%[1]s - %[3]s.data);
+        %[2]s = true;
+    }
+}`,
+			index, found, strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), strings.TrimSpace(parts[2]))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Sort a plain C array of count elements.
+	// Example usage:
+	// {{ "people" | sort_array : "people_count,by_age" }}
+	errs = append(errs, registerFilter("sort_array", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		parts := strings.Split(param.String(), ",")
+		if len(parts) != 2 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("sort_array needs count,comparator")}
+		}
+		code := fmt.Sprintf(`qsort(%[1]s, (size_t)(%[2]s), sizeof(*(%[1]s)), %[3]s);`,
+			in.String(), strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	return errors.Join(errs...)
+}
+
+func arrayArgs(filter string, param *pongo2.Value) (string, string, *pongo2.Error) {
+	parts := strings.SplitN(param.String(), ",", 2)
+	if len(parts) != 2 {
+		return "", "", &pongo2.Error{OrigError: fmt.Errorf("%s needs array,index", filter)}
+	}
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), nil
+}
@@ -0,0 +1,81 @@
+package generators
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestArrayAccess(t *testing.T) {
+	src, libs := render(t, `{{ "scores" | array_create : "int" }}
+int main(int argc, char **argv) {
+    for (int i = 0; i < 20; i++) {
+        {{ "scores" | array_push : "i * 10" }}
+    }
+    {{ "scores" | array_insert : "0,-1" }}
+    {{ "scores" | array_insert : "scores.size,999" }}
+    {{ "scores" | array_remove : "5" }}
+    {{ "scores" | array_set : "1,scores.data[1] + 5" }}
+    {{ "first" | array_get : "scores,0" }}
+    {{ "second" | array_get : "scores,1" }}
+    {{ "fifth" | array_get : "scores,5" }}
+    {{ "missing,have_missing" | array_get : "scores,scores.size" }}
+    {{ "last" | array_pop : "scores" }}
+    printf("%d %d %d %d %d %d %zu\n", first, second, fifth, missing, have_missing, last, scores.size);
+    {{ "scores" | array_clear }}
+    printf("%zu %d\n", scores.size, scores.capacity >= 22);
+    if (argc > 1) {
+        {{ "bad" | array_get : "scores,(size_t)strtol(argv[1], NULL, 10)" }}
+        printf("%d\n", bad);
+    }
+    {{ "scores" | array_free }}
+    return 0;
+}
+`)
+	bin := compileC(t, src, libs, sanitize)
+	stdout, stderr, code := runC(t, bin, "")
+	if code != 0 {
+		t.Fatalf("program exited %d: %s", code, stderr)
+	}
+	if want := "-1 5 50 0 0 999 20\n0 1\n"; stdout != want {
+		t.Errorf("got output %q, want %q", stdout, want)
+	}
+	for _, index := range []string{"0", "-1"} {
+		_, stderr, code := runC(t, bin, "", index)
+		if code == 0 || !strings.Contains(stderr, "out of bounds for array scores (size 0)") {
+			t.Errorf("index %s on an empty array: got exit %d, stderr %q", index, code, stderr)
+		}
+	}
+}
+
+func TestArraySortAndSearch(t *testing.T) {
+	out := renderAndRun(t, `struct person {
+    const char *name;
+    int age;
+};
+{{ "names" | array_create : "const char *" }}
+{{ "by_name" | comparator : "const char *,strcmp(*a, *b)" }}
+{{ "by_age" | comparator : "struct person,(a->age > b->age) - (a->age < b->age)" }}
+int main(void) {
+    const char *input[] = {"dave", "alice", "carol", "bob", "erin"};
+    for (size_t i = 0; i < 5; i++) {
+        {{ "names" | array_push : "input[i]" }}
+    }
+    {{ "names" | array_sort : "by_name" }}
+    for (size_t i = 0; i < names.size; i++) printf("%s ", names.data[i]);
+    {{ "idx,found" | array_bsearch : "names,by_name,\"carol\"" }}
+    {{ "nidx,nfound" | array_bsearch : "names,by_name,\"zed\"" }}
+    printf("%zu %d %d\n", idx, found, nfound);
+    {{ "names" | array_free }}
+    {{ "eidx,efound" | array_bsearch : "names,by_name,\"carol\"" }}
+    printf("%d\n", efound);
+
+    struct person people[] = { {"x", 40}, {"y", -3}, {"z", 7} };
+    {{ "people" | sort_array : "3,by_age" }}
+    printf("%s%s%s\n", people[0].name, people[1].name, people[2].name);
+    return 0;
+}
+`, sanitize)
+	if want := "alice bob carol dave erin 2 1 0\n0\nyzx\n"; out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+}
@@ -0,0 +1,150 @@
+package generators
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func init() {
+	Register(InitBase64Filters)
+}
+
+func InitBase64Filters() error {
+	var errs []error
+
+	// base64_encode_bytes and base64_decode_string helpers, include at file
+	// scope. Repeat uses in the same file emit nothing, so a template can
+	// ask for it wherever it needs base64 without tracking that itself.
+	// Example usage:
+	// {{ "" | base64_table }}
+	errs = append(errs, registerFilter("base64_table", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := `static const char base64_chars[] =
+    "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/";
+
+// Returns a NUL-terminated, padded encoding of len bytes from src.
+static char *base64_encode_bytes(const unsigned char *src, size_t len) {
+    char *out = malloc(4 * ((len + 2) / 3) + 1);
+    if (!out) {
+        fprintf(stderr, "Failed to get memory for base64 output\n");
+        exit(EXIT_FAILURE);
+    }
+    size_t i = 0, j = 0;
+    for (; i + 2 < len; i += 3) {
+        unsigned long v = (unsigned long)src[i] << 16 | (unsigned long)src[i + 1] << 8 | src[i + 2];
+        out[j++] = base64_chars[(v >> 18) & 63];
+        out[j++] = base64_chars[(v >> 12) & 63];
+        out[j++] = base64_chars[(v >> 6) & 63];
+        out[j++] = base64_chars[v & 63];
+    }
+    if (i < len) {
+        unsigned long v = (unsigned long)src[i] << 16;
+        if (i + 1 < len) {
+            v |= (unsigned long)src[i + 1] << 8;
+        }
+        out[j++] = base64_chars[(v >> 18) & 63];
+        out[j++] = base64_chars[(v >> 12) & 63];
+        out[j++] = i + 1 < len ? base64_chars[(v >> 6) & 63] : '=';
+        out[j++] = '=';
+    }
+    out[j] = '\0';
+    return out;
+}
+
+static int base64_value(char c) {
+    if (c >= 'A' && c <= 'Z') return c - 'A';
+    if (c >= 'a' && c <= 'z') return c - 'a' + 26;
+    if (c >= '0' && c <= '9') return c - '0' + 52;
+    if (c == '+') return 62;
+    if (c == '/') return 63;
+    return -1;
+}
+
+// Decodes padded base64 into a NUL-terminated buffer (the terminator is not
+// counted in *out_len). Returns NULL for NULL or malformed input.
+static unsigned char *base64_decode_string(const char *src, size_t *out_len) {
+    *out_len = 0;
+    if (!src) {
+        return NULL;
+    }
+    size_t len = strlen(src);
+    if (len % 4 != 0) {
+        return NULL;
+    }
+    unsigned char *out = malloc(len / 4 * 3 + 1);
+    if (!out) {
+        fprintf(stderr, "Failed to get memory for base64 output\n");
+        exit(EXIT_FAILURE);
+    }
+    size_t j = 0;
+    for (size_t i = 0; i < len; i += 4) {
+        int pad3 = src[i + 2] == '=', pad4 = src[i + 3] == '=';
+        if ((pad3 || pad4) && i + 4 != len) {
+            goto invalid;
+        }
+        if (pad3 && !pad4) {
+            goto invalid;
+        }
+        int a = base64_value(src[i]), b = base64_value(src[i + 1]);
+        int c = pad3 ? 0 : base64_value(src[i + 2]);
+        int d = pad4 ? 0 : base64_value(src[i + 3]);
+        if (a < 0 || b < 0 || c < 0 || d < 0) {
+            goto invalid;
+        }
+        unsigned long v = (unsigned long)a << 18 | (unsigned long)b << 12 | (unsigned long)c << 6 | (unsigned long)d;
+        out[j++] = (unsigned char)(v >> 16);
+        if (!pad3) {
+            out[j++] = (unsigned char)(v >> 8);
+        }
+        if (!pad4) {
+            out[j++] = (unsigned char)v;
+        }
+    }
+    out[j] = '\0';
+    *out_len = j;
+    return out;
+
+invalid:
+    free(out);
+    return NULL;
+}`
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Encode len bytes (may contain NULs) into an AUTO_FREE string. Needs
+	// {{ "" | base64_table }} and {{ "" | auto_free_generic }}.
+	// Example usage:
+	// {{ "token" | base64_encode : "credentials,strlen(credentials)" }}
+	errs = append(errs, registerFilter("base64_encode", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		parts := strings.Split(param.String(), ",")
+		if len(parts) != 2 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("base64_encode needs input,len")}
+		}
+		code := fmt.Sprintf(
+			`AUTO_FREE char *%s = base64_encode_bytes((const unsigned char *)(%s), (size_t)(%s));`,
+			in.String(), strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Decode a base64 string into an AUTO_FREE buffer and its length. The
+	// buffer is NULL (and the length 0) when the input is NULL or invalid.
+	// Needs {{ "" | base64_table }} and {{ "" | auto_free_generic }}.
+	// Example usage:
+	// {{ "raw,raw_len" | base64_decode : "encoded" }}
+	errs = append(errs, registerFilter("base64_decode", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		parts := strings.Split(in.String(), ",")
+		if len(parts) != 2 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("base64_decode needs out,out_len as input")}
+		}
+		out, outLen := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		code := fmt.Sprintf(
+			`size_t %[2]s = 0;
+AUTO_FREE unsigned char *%[1]s = base64_decode_string(%[3]s, &%[2]s);`,
+			out, outLen, param.String())
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,41 @@
+package generators
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestBase64RoundTrip(t *testing.T) {
+	out := renderAndRun(t, `{{ "" | auto_free_generic }}
+{{ "" | base64_table }}
+static void roundtrip(const char *s, size_t len) {
+    {{ "encoded" | base64_encode : "s,len" }}
+    {{ "decoded,decoded_len" | base64_decode : "encoded" }}
+    printf("%s %d\n", encoded, decoded_len == len && memcmp(decoded, s, len) == 0);
+}
+
+int main(void) {
+    const char *vectors[] = {"", "f", "fo", "foo", "foob", "fooba", "foobar"};
+    for (size_t i = 0; i < sizeof(vectors) / sizeof(vectors[0]); i++) {
+        roundtrip(vectors[i], strlen(vectors[i]));
+    }
+    const char binary[] = {0, (char)0xff, 'x', 0, (char)0x80};
+    roundtrip(binary, sizeof(binary));
+    const char *bad[] = {"Zm9v!", "Zm9", "=Zm9", NULL};
+    for (size_t i = 0; i < sizeof(bad) / sizeof(bad[0]); i++) {
+        {{ "raw,raw_len" | base64_decode : "bad[i]" }}
+        printf("%d %zu\n", raw == NULL, raw_len);
+    }
+    return 0;
+}
+`, sanitize)
+	var want strings.Builder
+	for _, s := range []string{"", "f", "fo", "foo", "foob", "fooba", "foobar", "\x00\xffx\x00\x80"} {
+		want.WriteString(base64.StdEncoding.EncodeToString([]byte(s)) + " 1\n")
+	}
+	want.WriteString(strings.Repeat("1 0\n", 4))
+	if out != want.String() {
+		t.Errorf("got output\n%s\nwant\n%s", out, want.String())
+	}
+}
@@ -0,0 +1,185 @@
+package generators
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+// Flags every generated program is compiled with. The snippets use GNU
+// extensions (cleanup attributes, statement expressions), so gnu11 rather
+// than c11; the errors catch code that only compiles by accident.
+var ccFlags = []string{
+	"-std=gnu11", "-Wall",
+	"-Werror=implicit-function-declaration",
+	"-Werror=incompatible-pointer-types",
+	"-Werror=int-conversion",
+}
+
+// sanitize is passed to compileC to build with AddressSanitizer and
+// UndefinedBehaviorSanitizer.
+const sanitize = "-fsanitize=address,undefined"
+
+// render executes tpl with every filter registered and returns the C it
+// produces, led by the #include lines its filters need as in a cccp run,
+// along with the link flags they need.
+func render(t *testing.T, tpl string) (string, []string) {
+	t.Helper()
+	return renderContext(t, tpl, nil)
+}
+
+// renderContext is render with a template context.
+func renderContext(t *testing.T, tpl string, ctx pongo2.Context) (string, []string) {
+	t.Helper()
+	if err := InitAll(); err != nil {
+		t.Fatalf("InitAll: %v", err)
+	}
+	usage := StartUsage()
+	tmpl, err := pongo2.FromString(tpl)
+	if err != nil {
+		t.Fatalf("parsing template: %v", err)
+	}
+	out, err := tmpl.Execute(ctx)
+	if err != nil {
+		t.Fatalf("rendering template: %v", err)
+	}
+	var b strings.Builder
+	for _, header := range usage.Headers() {
+		fmt.Fprintf(&b, "#include <%s>\n", header)
+	}
+	b.WriteString(out)
+	return b.String(), usage.Libs()
+}
+
+// lookupCC returns the C compiler to use, skipping the test when there is
+// none.
+func lookupCC(t *testing.T) string {
+	t.Helper()
+	for _, name := range []string{"cc", "gcc", "clang"} {
+		if path, err := exec.LookPath(name); err == nil {
+			return path
+		}
+	}
+	t.Skip("no C compiler found")
+	return ""
+}
+
+// compileC compiles src, linking libs, and returns the executable's path.
+// A -fsanitize= flag skips the test if the toolchain can't link a
+// sanitized program.
+func compileC(t *testing.T, src string, libs []string, flags ...string) string {
+	t.Helper()
+	cc := lookupCC(t)
+	for _, flag := range flags {
+		if strings.HasPrefix(flag, "-fsanitize=") {
+			requireCC(t, "int main(void) { return 0; }", nil, flag)
+		}
+	}
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "main.c")
+	if err := os.WriteFile(srcPath, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	bin := filepath.Join(dir, "main")
+	args := append(append(append([]string{}, ccFlags...), flags...), "-o", bin, srcPath)
+	args = append(args, libs...)
+	if out, err := exec.Command(cc, args...).CombinedOutput(); err != nil {
+		t.Fatalf("compiling generated C: %v\n%s\n--- source ---\n%s", err, out, numbered(src))
+	}
+	return bin
+}
+
+// syntaxCheck runs the compiler over src with -fsyntax-only.
+func syntaxCheck(t *testing.T, src string) {
+	t.Helper()
+	cc := lookupCC(t)
+	args := append(append([]string{}, ccFlags...), "-fsyntax-only", "-x", "c", "-")
+	cmd := exec.Command(cc, args...)
+	cmd.Stdin = strings.NewReader(src)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("generated C does not compile: %v\n%s\n--- source ---\n%s", err, out, numbered(src))
+	}
+}
+
+// requireCC skips the test unless src compiles and links with libs and
+// flags, for tests that need an optional library such as libcurl.
+func requireCC(t *testing.T, src string, libs []string, flags ...string) {
+	t.Helper()
+	cc := lookupCC(t)
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "probe.c")
+	if err := os.WriteFile(srcPath, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	args := append(append([]string{}, flags...), "-o", filepath.Join(dir, "probe"), srcPath)
+	args = append(args, libs...)
+	if out, err := exec.Command(cc, args...).CombinedOutput(); err != nil {
+		t.Skipf("toolchain can't build with %s: %s", strings.Join(append(flags, libs...), " "), firstLine(out))
+	}
+}
+
+// runC runs a compiled program in dir (the current directory when empty)
+// and returns its stdout, stderr and exit code.
+func runC(t *testing.T, bin, dir string, args ...string) (stdout, stderr string, code int) {
+	t.Helper()
+	return runCInput(t, bin, dir, "", args...)
+}
+
+// runCInput is runC with input on the program's stdin.
+func runCInput(t *testing.T, bin, dir, input string, args ...string) (stdout, stderr string, code int) {
+	t.Helper()
+	var outBuf, errBuf bytes.Buffer
+	cmd := exec.Command(bin, args...)
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Stdout, cmd.Stderr = &outBuf, &errBuf
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr):
+		code = exitErr.ExitCode()
+	default:
+		t.Fatalf("running %s: %v", bin, err)
+	}
+	return outBuf.String(), errBuf.String(), code
+}
+
+// renderAndRun renders tpl, compiles it with flags and runs it, failing
+// the test unless it exits 0. It returns the program's stdout.
+func renderAndRun(t *testing.T, tpl string, flags ...string) string {
+	t.Helper()
+	return renderAndRunIn(t, "", tpl, flags...)
+}
+
+// renderAndRunIn is renderAndRun with the program run in dir.
+func renderAndRunIn(t *testing.T, dir, tpl string, flags ...string) string {
+	t.Helper()
+	src, libs := render(t, tpl)
+	bin := compileC(t, src, libs, flags...)
+	stdout, stderr, code := runC(t, bin, dir)
+	if code != 0 {
+		t.Fatalf("program exited %d\nstdout:\n%s\nstderr:\n%s\n--- source ---\n%s", code, stdout, stderr, numbered(src))
+	}
+	return stdout
+}
+
+func numbered(src string) string {
+	var b strings.Builder
+	for i, line := range strings.Split(src, "\n") {
+		fmt.Fprintf(&b, "%4d  %s\n", i+1, line)
+	}
+	return b.String()
+}
+
+func firstLine(out []byte) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	return line
+}
@@ -0,0 +1,219 @@
+package generators
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func init() {
+	Register(InitCLIFilters)
+}
+
+// cliOption is one entry of a cli_options spec.
+type cliOption struct {
+	name     string // long name, e.g. "dry-run"
+	short    byte   // 0 when the option has no short form
+	kind     string // "flag", "string" or "int"
+	defValue string
+	val      string // getopt_long return value as C source
+}
+
+func (o cliOption) varName() string {
+	return "opt_" + strings.ReplaceAll(o.name, "-", "_")
+}
+
+var cliNameRe = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+
+// parseCLISpec parses "name|short|type[|default];..." where short may be
+// empty and type is flag, string or int.
+func parseCLISpec(spec string) ([]cliOption, error) {
+	var opts []cliOption
+	seen := map[string]bool{}
+	seenShort := map[byte]bool{'h': true}
+
+	for i, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		fields := strings.Split(entry, "|")
+		if len(fields) < 3 || len(fields) > 4 {
+			return nil, fmt.Errorf("option %q: want name|short|type[|default]", entry)
+		}
+
+		opt := cliOption{name: fields[0], kind: fields[2]}
+		if !cliNameRe.MatchString(opt.name) || opt.name == "help" {
+			return nil, fmt.Errorf("option %q: invalid or reserved name %q", entry, opt.name)
+		}
+		if seen[opt.name] {
+			return nil, fmt.Errorf("option %q: duplicate name %q", entry, opt.name)
+		}
+		seen[opt.name] = true
+
+		switch short := fields[1]; {
+		case short == "":
+			opt.val = strconv.Itoa(256 + i)
+		case len(short) == 1 && cliNameRe.MatchString(short) && !seenShort[short[0]]:
+			opt.short = short[0]
+			opt.val = fmt.Sprintf("'%c'", short[0])
+			seenShort[short[0]] = true
+		default:
+			return nil, fmt.Errorf("option %q: invalid or duplicate short name %q", entry, short)
+		}
+
+		hasDefault := len(fields) == 4
+		if hasDefault {
+			opt.defValue = fields[3]
+		}
+		switch opt.kind {
+		case "flag":
+			if hasDefault {
+				return nil, fmt.Errorf("option %q: flags can't have a default", entry)
+			}
+		case "string":
+		case "int":
+			if !hasDefault {
+				opt.defValue = "0"
+			}
+			if _, err := strconv.ParseInt(opt.defValue, 10, 32); err != nil {
+				return nil, fmt.Errorf("option %q: default %q is not an int", entry, opt.defValue)
+			}
+		default:
+			return nil, fmt.Errorf("option %q: unknown type %q (want flag, string or int)", entry, opt.kind)
+		}
+		opts = append(opts, opt)
+	}
+
+	if len(opts) == 0 {
+		return nil, fmt.Errorf("no options in spec")
+	}
+	return opts, nil
+}
+
+func InitCLIFilters() error {
+	var errs []error
+
+	// Generates, at file scope, one opt_<name> variable per option (dashes
+	// become underscores), a usage() function and parse_options(), which
+	// handles -h/--help and exits with usage on bad input.
+	// Spec: "name|short|type[|default]" entries separated by ";", where
+	// short may be empty and type is flag, string or int.
+	// Example usage:
+	// {{ "" | cli_options : "verbose|v|flag;output|o|string|out.txt;count|c|int|1" }}
+	// int main(int argc, char **argv) {
+	//     parse_options(argc, argv);
+	//     if (opt_verbose) printf("writing %d to %s\n", opt_count, opt_output);
+	errs = append(errs, registerFilter("cli_options", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		opts, err := parseCLISpec(param.String())
+		if err != nil {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("cli_options: %w", err)}
+		}
+
+		var b strings.Builder
+		for _, o := range opts {
+			switch o.kind {
+			case "flag":
+				fmt.Fprintf(&b, "static int %s = 0;\n", o.varName())
+			case "string":
+				def := "NULL"
+				if o.defValue != "" {
+					def = cStringLiteral(o.defValue)
+				}
+				fmt.Fprintf(&b, "static const char *%s = %s;\n", o.varName(), def)
+			case "int":
+				fmt.Fprintf(&b, "static int %s = %s;\n", o.varName(), o.defValue)
+			}
+		}
+
+		b.WriteString("\nstatic void usage(const char *prog) {\n")
+		b.WriteString("    fprintf(stderr, \"Usage: %s [options] [args...]\\n\", prog);\n")
+		for _, o := range opts {
+			line := "     "
+			if o.short != 0 {
+				line = fmt.Sprintf("  -%c,", o.short)
+			}
+			line += " --" + o.name
+			if o.kind != "flag" {
+				line += " <" + o.kind + ">"
+			}
+			if o.defValue != "" {
+				line += " (default: " + o.defValue + ")"
+			}
+			fmt.Fprintf(&b, "    fprintf(stderr, \"%%s\\n\", %s);\n", cStringLiteral(line))
+		}
+		b.WriteString("    fprintf(stderr, \"  -h, --help\\n\");\n}\n")
+
+		shortopts := ""
+		b.WriteString("\nstatic void parse_options(int argc, char **argv) {\n")
+		b.WriteString("    static struct option long_options[] = {\n")
+		for _, o := range opts {
+			hasArg := "required_argument"
+			if o.kind == "flag" {
+				hasArg = "no_argument"
+			}
+			fmt.Fprintf(&b, "        {\"%s\", %s, NULL, %s},\n", o.name, hasArg, o.val)
+			if o.short != 0 {
+				shortopts += string(o.short)
+				if o.kind != "flag" {
+					shortopts += ":"
+				}
+			}
+		}
+		b.WriteString("        {\"help\", no_argument, NULL, 'h'},\n")
+		b.WriteString("        {NULL, 0, NULL, 0},\n    };\n\n")
+		fmt.Fprintf(&b, "    int opt;\n    while ((opt = getopt_long(argc, argv, \"%sh\", long_options, NULL)) != -1) {\n", shortopts)
+		b.WriteString("        switch (opt) {\n")
+		for _, o := range opts {
+			fmt.Fprintf(&b, "        case %s:\n", o.val)
+			switch o.kind {
+			case "flag":
+				fmt.Fprintf(&b, "            %s = 1;\n            break;\n", o.varName())
+			case "string":
+				fmt.Fprintf(&b, "            %s = optarg;\n            break;\n", o.varName())
+			case "int":
+				fmt.Fprintf(&b,
+					`        {
+            char *end;
+            errno = 0;
+            long value = strtol(optarg, &end, 10);
+            if (errno != 0 || end == optarg || *end != '\0' || value < INT_MIN || value > INT_MAX) {
+                fprintf(stderr, "%%s: invalid integer for --%[1]s: %%s\n", argv[0], optarg);
+                usage(argv[0]);
+                exit(EXIT_FAILURE);
+            }
+            %[2]s = (int)value;
+            break;
+        }
+`,
+					o.name, o.varName())
+			}
+		}
+		b.WriteString(`        case 'h':
+            usage(argv[0]);
+            exit(EXIT_SUCCESS);
+        default:
+            usage(argv[0]);
+            exit(EXIT_FAILURE);
+        }
+    }
+}`)
+		return pongo2.AsSafeValue(b.String()), nil
+	}))
+
+	// Index of the first non-option argument, after parse_options.
+	// Example usage:
+	// {{ "first_arg" | cli_positional }}
+	// for (int i = first_arg; i < argc; i++) {
+	//     printf("file: %s\n", argv[i]);
+	// }
+	errs = append(errs, registerFilter("cli_positional", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return pongo2.AsSafeValue(fmt.Sprintf("int %s = optind;", in.String())), nil
+	}))
+
+	return errors.Join(errs...)
+}
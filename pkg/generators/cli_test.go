@@ -0,0 +1,73 @@
+package generators
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func TestParseCLISpec(t *testing.T) {
+	got, err := parseCLISpec(" verbose|v|flag; dry-run||flag ;output|o|string|out.txt;count|c|int|-3;")
+	if err != nil {
+		t.Fatalf("parseCLISpec: %v", err)
+	}
+	want := []cliOption{
+		{name: "verbose", short: 'v', kind: "flag", val: "'v'"},
+		{name: "dry-run", kind: "flag", val: "257"},
+		{name: "output", short: 'o', kind: "string", defValue: "out.txt", val: "'o'"},
+		{name: "count", short: 'c', kind: "int", defValue: "-3", val: "'c'"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+	if name := got[1].varName(); name != "opt_dry_run" {
+		t.Errorf("varName = %q, want opt_dry_run", name)
+	}
+}
+
+func TestParseCLISpecErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		want string
+	}{
+		{"empty", " ; ", "no options in spec"},
+		{"too few fields", "verbose|v", `option "verbose|v": want name|short|type[|default]`},
+		{"too many fields", "n|n|int|1|2", "want name|short|type[|default]"},
+		{"bad kind", "verbose|v|bool", `option "verbose|v|bool": unknown type "bool" (want flag, string or int)`},
+		{"bad name", "2fast||flag", `invalid or reserved name "2fast"`},
+		{"reserved name", "help||flag", `invalid or reserved name "help"`},
+		{"duplicate long name", "out|o|string;out|p|string", `option "out|p|string": duplicate name "out"`},
+		{"duplicate short name", "out|o|string;other|o|string", `invalid or duplicate short name "o"`},
+		{"reserved short name", "host|h|string", `invalid or duplicate short name "h"`},
+		{"long short name", "out|ou|string", `invalid or duplicate short name "ou"`},
+		{"bad int default", "count|c|int|ten", `option "count|c|int|ten": default "ten" is not an int`},
+		{"int default out of range", "count|c|int|4294967296", `default "4294967296" is not an int`},
+		{"flag default", "verbose|v|flag|1", "flags can't have a default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := parseCLISpec(tt.spec)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseCLISpec(%q) = %+v, %v; want error containing %q", tt.spec, opts, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCLIOptionsReportsSpecErrors(t *testing.T) {
+	if err := InitAll(); err != nil {
+		t.Fatalf("InitAll: %v", err)
+	}
+	StartUsage()
+	tmpl, err := pongo2.FromString(`{{ "" | cli_options : "verbose|v|bool" }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tmpl.Execute(nil)
+	if err == nil || !strings.Contains(err.Error(), `cli_options: option "verbose|v|bool": unknown type "bool"`) {
+		t.Errorf("got %v, want the spec error", err)
+	}
+}
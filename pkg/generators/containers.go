@@ -0,0 +1,265 @@
+package generators
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func init() {
+	Register(InitContainerFilters)
+}
+
+// Stacks, queues and ring buffers. Each *_create filter goes at file scope
+// and declares an instance named after its input along with <name>_value,
+// a Stack_/Queue_/Ring_<name> struct and static inline <name>_* helpers.
+// Popping an empty container prints an error and exits.
+func InitContainerFilters() error {
+	var errs []error
+
+	// Example usage:
+	// {{ "pending" | stack_create : "int" }}
+	errs = append(errs, registerFilter("stack_create", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		elemType := strings.TrimSpace(param.String())
+		if elemType == "" {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("stack_create needs an element type")}
+		}
+		code := fmt.Sprintf(
+			`typedef %[2]s %[1]s_value;
+
+typedef struct {
+    %[1]s_value *data;
+    size_t size;
+    size_t capacity;
+} Stack_%[1]s;
+
+static Stack_%[1]s %[1]s;
+
+static inline void %[1]s_push(Stack_%[1]s *s, %[1]s_value value) {
+    if (s->size == s->capacity) {
+        size_t cap = s->capacity ? s->capacity * 2 : 8;
+        %[1]s_value *data = realloc(s->data, cap * sizeof(*data));
+        if (!data) {
+            fprintf(stderr, "Failed to get memory for stack %[1]s\n");
+            exit(EXIT_FAILURE);
+        }
+        s->data = data;
+        s->capacity = cap;
+    }
+    s->data[s->size++] = value;
+}
+
+static inline %[1]s_value %[1]s_pop(Stack_%[1]s *s) {
+    if (s->size == 0) {
+        fprintf(stderr, "Stack underflow: %[1]s is empty\n");
+        exit(EXIT_FAILURE);
+    }
+    return s->data[--s->size];
+}`,
+			in.String(), elemType)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Example usage:
+	// {{ "pending" | stack_push : "job_id" }}
+	errs = append(errs, registerFilter("stack_push", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(`%[1]s_push(&%[1]s, %[2]s);`, in.String(), param.String())
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Declares value as the popped top element.
+	// Example usage:
+	// {{ "job_id" | stack_pop : "pending" }}
+	errs = append(errs, registerFilter("stack_pop", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(`%[1]s_value %[2]s = %[1]s_pop(&%[1]s);`, strings.TrimSpace(param.String()), in.String())
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Example usage:
+	// {{ "pending" | stack_free }}
+	errs = append(errs, registerFilter("stack_free", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return containerFree(in.String(), "size"), nil
+	}))
+
+	// A growing FIFO queue, stored as a circular buffer.
+	// Example usage:
+	// {{ "inbox" | queue_create : "const char *" }}
+	errs = append(errs, registerFilter("queue_create", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		elemType := strings.TrimSpace(param.String())
+		if elemType == "" {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("queue_create needs an element type")}
+		}
+		code := fmt.Sprintf(
+			`typedef %[2]s %[1]s_value;
+
+typedef struct {
+    %[1]s_value *data;
+    size_t head;
+    size_t count;
+    size_t capacity;
+} Queue_%[1]s;
+
+static Queue_%[1]s %[1]s;
+
+static inline void %[1]s_enqueue(Queue_%[1]s *q, %[1]s_value value) {
+    if (q->count == q->capacity) {
+        size_t cap = q->capacity ? q->capacity * 2 : 8;
+        %[1]s_value *data = malloc(cap * sizeof(*data));
+        if (!data) {
+            fprintf(stderr, "Failed to get memory for queue %[1]s\n");
+            exit(EXIT_FAILURE);
+        }
+        for (size_t i = 0; i < q->count; i++) {
+            data[i] = q->data[(q->head + i) %% q->capacity];
+        }
+        free(q->data);
+        q->data = data;
+        q->head = 0;
+        q->capacity = cap;
+    }
+    q->data[(q->head + q->count) %% q->capacity] = value;
+    q->count++;
+}
+
+static inline %[1]s_value %[1]s_dequeue(Queue_%[1]s *q) {
+    if (q->count == 0) {
+        fprintf(stderr, "Queue underflow: %[1]s is empty\n");
+        exit(EXIT_FAILURE);
+    }
+    %[1]s_value value = q->data[q->head];
+    q->head = (q->head + 1) %% q->capacity;
+    q->count--;
+    return value;
+}`,
+			in.String(), elemType)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Example usage:
+	// {{ "inbox" | queue_enqueue : "message" }}
+	errs = append(errs, registerFilter("queue_enqueue", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(`%[1]s_enqueue(&%[1]s, %[2]s);`, in.String(), param.String())
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Declares value as the oldest element, removing it.
+	// Example usage:
+	// {{ "message" | queue_dequeue : "inbox" }}
+	errs = append(errs, registerFilter("queue_dequeue", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(`%[1]s_value %[2]s = %[1]s_dequeue(&%[1]s);`, strings.TrimSpace(param.String()), in.String())
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Example usage:
+	// {{ "inbox" | queue_free }}
+	errs = append(errs, registerFilter("queue_free", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return containerFree(in.String(), "head", "count"), nil
+	}))
+
+	// A fixed-capacity ring buffer. When full, ring_push either overwrites
+	// the oldest element ("overwrite") or prints an error and exits
+	// ("fail", the default).
+	// Example usage:
+	// {{ "samples" | ring_create : "double,64,overwrite" }}
+	// {{ "events" | ring_create : "int,16" }}
+	errs = append(errs, registerFilter("ring_create", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		parts := strings.Split(param.String(), ",")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("ring_create needs type,capacity[,mode]")}
+		}
+		capacity, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || capacity <= 0 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("ring_create capacity must be a positive integer, got %q", parts[1])}
+		}
+		mode := "fail"
+		if len(parts) == 3 {
+			mode = strings.TrimSpace(parts[2])
+		}
+		var onFull string
+		switch mode {
+		case "fail":
+			onFull = fmt.Sprintf(
+				`fprintf(stderr, "Ring buffer overflow: %[1]s is full (capacity %[2]d)\n");
+        exit(EXIT_FAILURE);`,
+				in.String(), capacity)
+		case "overwrite":
+			onFull = fmt.Sprintf(
+				`r->head = (r->head + 1) %% %[1]d;
+        r->count--;`,
+				capacity)
+		default:
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("ring_create mode must be fail or overwrite, got %q", mode)}
+		}
+
+		code := fmt.Sprintf(
+			`typedef %[2]s %[1]s_value;
+
+typedef struct {
+    %[1]s_value data[%[3]d];
+    size_t head;
+    size_t count;
+} Ring_%[1]s;
+
+static Ring_%[1]s %[1]s;
+
+static inline void %[1]s_push(Ring_%[1]s *r, %[1]s_value value) {
+    if (r->count == %[3]d) {
+        %[4]s
+    }
+    r->data[(r->head + r->count) %% %[3]d] = value;
+    r->count++;
+}
+
+static inline %[1]s_value %[1]s_pop(Ring_%[1]s *r) {
+    if (r->count == 0) {
+        fprintf(stderr, "Ring buffer underflow: %[1]s is empty\n");
+        exit(EXIT_FAILURE);
+    }
+    %[1]s_value value = r->data[r->head];
+    r->head = (r->head + 1) %% %[3]d;
+    r->count--;
+    return value;
+}`,
+			in.String(), strings.TrimSpace(parts[0]), capacity, onFull)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Example usage:
+	// {{ "samples" | ring_push : "reading" }}
+	errs = append(errs, registerFilter("ring_push", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(`%[1]s_push(&%[1]s, %[2]s);`, in.String(), param.String())
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Declares value as the oldest element, removing it.
+	// Example usage:
+	// {{ "reading" | ring_pop : "samples" }}
+	errs = append(errs, registerFilter("ring_pop", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(`%[1]s_value %[2]s = %[1]s_pop(&%[1]s);`, strings.TrimSpace(param.String()), in.String())
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Declares the number of elements currently held.
+	// Example usage:
+	// {{ "buffered" | ring_count : "samples" }}
+	errs = append(errs, registerFilter("ring_count", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(`size_t %[1]s = %[2]s.count;`, in.String(), strings.TrimSpace(param.String()))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	return errors.Join(errs...)
+}
+
+// containerFree releases a container's data and zeroes its capacity and
+// the given counters.
+func containerFree(name string, counters ...string) *pongo2.Value {
+	var b strings.Builder
+	fmt.Fprintf(&b, "free(%[1]s.data);\n%[1]s.data = NULL;\n", name)
+	for _, counter := range append(counters, "capacity") {
+		fmt.Fprintf(&b, "%s.%s = 0;\n", name, counter)
+	}
+	return pongo2.AsSafeValue(strings.TrimSuffix(b.String(), "\n"))
+}
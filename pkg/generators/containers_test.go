@@ -0,0 +1,86 @@
+package generators
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestContainers(t *testing.T) {
+	src, libs := render(t, `#include <string.h>
+{{ "pending" | stack_create : "int" }}
+{{ "inbox" | queue_create : "int" }}
+{{ "samples" | ring_create : "int,4,overwrite" }}
+{{ "events" | ring_create : "int,2" }}
+int main(int argc, char **argv) {
+    for (int i = 1; i <= 20; i++) {
+        {{ "pending" | stack_push : "i" }}
+    }
+    for (int i = 0; i < 20; i++) {
+        {{ "top" | stack_pop : "pending" }}
+        printf("%d ", top);
+    }
+    printf("\n");
+    {{ "pending" | stack_free }}
+
+    /* Dequeue as we go so the queue wraps around before it grows. */
+    for (int i = 1; i <= 30; i++) {
+        {{ "inbox" | queue_enqueue : "i" }}
+        if (i % 3 == 0) {
+            {{ "oldest" | queue_dequeue : "inbox" }}
+            printf("%d ", oldest);
+        }
+    }
+    for (int i = 0; i < 20; i++) {
+        {{ "oldest" | queue_dequeue : "inbox" }}
+        printf("%d ", oldest);
+    }
+    printf("\n");
+    {{ "inbox" | queue_free }}
+
+    for (int i = 1; i <= 6; i++) {
+        {{ "samples" | ring_push : "i" }}
+    }
+    {{ "buffered" | ring_count : "samples" }}
+    printf("%zu:", (size_t)buffered);
+    for (int i = 0; i < 4; i++) {
+        {{ "reading" | ring_pop : "samples" }}
+        printf(" %d", reading);
+    }
+    printf("\n");
+
+    if (argc > 1 && strcmp(argv[1], "full") == 0) {
+        for (int i = 0; i < 3; i++) {
+            {{ "events" | ring_push : "i" }}
+        }
+    }
+    if (argc > 1 && strcmp(argv[1], "empty") == 0) {
+        {{ "none" | stack_pop : "pending" }}
+        printf("%d\n", none);
+    }
+    return 0;
+}
+`)
+	bin := compileC(t, src, libs, sanitize)
+	stdout, stderr, code := runC(t, bin, "")
+	if code != 0 {
+		t.Fatalf("program exited %d: %s", code, stderr)
+	}
+	var want strings.Builder
+	for i := 20; i >= 1; i-- {
+		fmt.Fprintf(&want, "%d ", i)
+	}
+	want.WriteString("\n")
+	for i := 1; i <= 30; i++ {
+		fmt.Fprintf(&want, "%d ", i)
+	}
+	want.WriteString("\n4: 3 4 5 6\n")
+	if stdout != want.String() {
+		t.Errorf("got output\n%s\nwant\n%s", stdout, want.String())
+	}
+	for _, arg := range []string{"full", "empty"} {
+		if _, stderr, code := runC(t, bin, "", arg); code == 0 {
+			t.Errorf("%s: program exited 0, want an error (stderr %q)", arg, stderr)
+		}
+	}
+}
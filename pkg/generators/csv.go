@@ -0,0 +1,150 @@
+package generators
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func init() {
+	Register(InitCSVFilters)
+}
+
+func InitCSVFilters() error {
+	var errs []error
+
+	// CsvReader type and csv_read_row helper, include once at file scope.
+	// Fields may be double-quoted to hold commas; "" inside quotes is a
+	// literal quote. CRLF endings and a last line without a newline are
+	// handled. Quoted fields can't span lines.
+	// Example usage:
+	// {{ "" | csv_reader }}
+	errs = append(errs, registerFilter("csv_reader", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := `typedef struct {
+    FILE *fp;
+    char *line;
+    size_t line_cap;
+    char **fields;
+    size_t field_cap;
+} CsvReader;
+
+// Returns 1 when a row was read, 0 at end of file and -1 on error. The
+// fields point into the reader's line buffer and stay valid until the
+// next call.
+static int csv_read_row(CsvReader *r, char ***fields, int *count) {
+    *count = 0;
+    ssize_t len = getline(&r->line, &r->line_cap, r->fp);
+    if (len == -1) {
+        return ferror(r->fp) ? -1 : 0;
+    }
+    while (len > 0 && (r->line[len - 1] == '\n' || r->line[len - 1] == '\r')) {
+        r->line[--len] = '\0';
+    }
+
+    int n = 0;
+    char *src = r->line;
+    for (;;) {
+        if ((size_t)n == r->field_cap) {
+            size_t cap = r->field_cap ? r->field_cap * 2 : 16;
+            char **grown = realloc(r->fields, cap * sizeof(char *));
+            if (!grown) {
+                return -1;
+            }
+            r->fields = grown;
+            r->field_cap = cap;
+        }
+
+        char *dst = src;
+        r->fields[n++] = dst;
+        if (*src == '"') {
+            src++;
+            while (*src) {
+                if (*src == '"') {
+                    if (src[1] != '"') {
+                        src++;
+                        break;
+                    }
+                    src++;  // "" is an escaped quote
+                }
+                *dst++ = *src++;
+            }
+            while (*src && *src != ',') {
+                src++;  // ignore junk between the closing quote and the comma
+            }
+        } else {
+            while (*src && *src != ',') {
+                *dst++ = *src++;
+            }
+        }
+
+        int more = *src == ',';
+        *dst = '\0';
+        if (!more) {
+            break;
+        }
+        src++;
+    }
+
+    *fields = r->fields;
+    *count = n;
+    return 1;
+}`
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Example usage:
+	// {{ "reader" | csv_open : "data.csv" }}
+	// {{ "reader" | csv_open : "$path_var" }}
+	errs = append(errs, registerFilter("csv_open", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		reader := in.String()
+		path := quoteIfLiteral(param.String())
+		code := fmt.Sprintf(
+			`CsvReader %[1]s = {0};
+%[1]s.fp = fopen(%[2]s, "r");
+if (!%[1]s.fp) {
+    fprintf(stderr, "Failed to open CSV file: %%s\n", %[2]s);
+    exit(EXIT_FAILURE);
+}`,
+			reader, path)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Expands to a condition that reads the next row, so it drives a loop.
+	// Example usage:
+	// char **fields;
+	// int field_count;
+	// while ({{ "reader" | csv_next_row : "fields,field_count" }}) {
+	//     printf("%s\n", fields[0]);
+	// }
+	errs = append(errs, registerFilter("csv_next_row", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		reader := in.String()
+		parts := strings.Split(param.String(), ",")
+		if len(parts) != 2 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("csv_next_row needs fields,count")}
+		}
+		fields, count := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		code := fmt.Sprintf("csv_read_row(&%s, &%s, &%s) == 1", reader, fields, count)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Example usage:
+	// {{ "reader" | csv_close }}
+	errs = append(errs, registerFilter("csv_close", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		reader := in.String()
+		code := fmt.Sprintf(
+			`if (%[1]s.fp) {
+    fclose(%[1]s.fp);
+    %[1]s.fp = NULL;
+}
+free(%[1]s.line);
+%[1]s.line = NULL;
+free(%[1]s.fields);
+%[1]s.fields = NULL;`,
+			reader)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,64 @@
+package generators
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCSVReader(t *testing.T) {
+	crlf := filepath.Join(t.TempDir(), "crlf.csv")
+	if err := os.WriteFile(crlf, []byte("a,\"b,c\"\r\n\r\nd\r\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	src, libs := render(t, `{{ "" | csv_reader }}
+int main(int argc, char **argv) {
+    for (int i = 1; i < argc; i++) {
+        {{ "reader" | csv_open : "$argv[i]" }}
+        char **fields;
+        int field_count;
+        while ({{ "reader" | csv_next_row : "fields,field_count" }}) {
+            printf("%d:", field_count);
+            for (int f = 0; f < field_count; f++) {
+                printf("[%s]", fields[f]);
+            }
+            printf("\n");
+        }
+        {{ "reader" | csv_close }}
+    }
+    return 0;
+}
+`)
+	bin := compileC(t, src, libs, sanitize)
+	stdout, stderr, code := runC(t, bin, "", filepath.Join("testdata", "people.csv"), crlf)
+	if code != 0 {
+		t.Fatalf("program exited %d: %s", code, stderr)
+	}
+	want := `3:[name][city][note]
+3:[Ada][London, UK][said "hi", twice]
+3:[Grace Hopper][][plain]
+3:[][x][]
+20:[1][2][3][4][5][6][7][8][9][10][11][12][13][14][15][16][17][18][19][20]
+3:[last][no, newline][end]
+2:[a][b,c]
+1:[]
+1:[d]
+`
+	if stdout != want {
+		t.Errorf("got\n%s\nwant\n%s", stdout, want)
+	}
+}
+
+func TestCSVOpenMissingFile(t *testing.T) {
+	src, libs := render(t, `{{ "" | csv_reader }}
+int main(void) {
+    {{ "reader" | csv_open : "missing.csv" }}
+    {{ "reader" | csv_close }}
+    return 0;
+}
+`)
+	bin := compileC(t, src, libs)
+	if _, stderr, code := runC(t, bin, t.TempDir()); code != 1 || stderr != "Failed to open CSV file: missing.csv\n" {
+		t.Errorf("got exit %d, stderr %q", code, stderr)
+	}
+}
@@ -0,0 +1,189 @@
+package generators
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func init() {
+	Register(InitDaemonFilters)
+}
+
+func InitDaemonFilters() error {
+	var errs []error
+
+	// Detach from the terminal: fork, setsid, fork again so the daemon
+	// can never reacquire a controlling terminal, chdir("/") and point
+	// stdin/stdout/stderr at /dev/null. Pass "debug" to keep stderr.
+	// The original process exits with 0. Use absolute paths afterwards.
+	// Example usage:
+	// {{ "" | daemonize }}
+	// {{ "" | daemonize : "debug" }}
+	errs = append(errs, registerFilter("daemonize", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		keepStderr := false
+		switch mode := strings.TrimSpace(param.String()); mode {
+		case "":
+		case "debug":
+			keepStderr = true
+		default:
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("daemonize parameter must be empty or debug, got %q", mode)}
+		}
+		redirectStderr := `
+    if (dup2(daemon_null, STDERR_FILENO) == -1) {
+        perror("dup2 stderr");
+        exit(EXIT_FAILURE);
+    }`
+		if keepStderr {
+			redirectStderr = ""
+		}
+		code := fmt.Sprintf(
+			`{
+    fflush(NULL);
+    pid_t daemon_pid = fork();
+    if (daemon_pid == -1) {
+        perror("fork");
+        exit(EXIT_FAILURE);
+    }
+    if (daemon_pid > 0) {
+        _exit(EXIT_SUCCESS);
+    }
+    if (setsid() == -1) {
+        perror("setsid");
+        exit(EXIT_FAILURE);
+    }
+    daemon_pid = fork();
+    if (daemon_pid == -1) {
+        perror("fork");
+        exit(EXIT_FAILURE);
+    }
+    if (daemon_pid > 0) {
+        _exit(EXIT_SUCCESS);
+    }
+    if (chdir("/") == -1) {
+        perror("chdir /");
+        exit(EXIT_FAILURE);
+    }
+    int daemon_null = open("/dev/null", O_RDWR);
+    if (daemon_null == -1) {
+        perror("open /dev/null");
+        exit(EXIT_FAILURE);
+    }
+    if (dup2(daemon_null, STDIN_FILENO) == -1) {
+        perror("dup2 stdin");
+        exit(EXIT_FAILURE);
+    }
+    if (dup2(daemon_null, STDOUT_FILENO) == -1) {
+        perror("dup2 stdout");
+        exit(EXIT_FAILURE);
+    }%[1]s
+    if (daemon_null > STDERR_FILENO) {
+        close(daemon_null);
+    }
+}`,
+			redirectStderr)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// State for pidfile_create, include once at file scope. The pidfile is
+	// removed at exit, but only by the process that created it, so forked
+	// children exiting don't take it away.
+	// Example usage:
+	// {{ "" | pidfile_helpers }}
+	errs = append(errs, registerFilter("pidfile_helpers", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := `static char pidfile_path[PATH_MAX];
+static pid_t pidfile_owner = 0;
+
+static void pidfile_cleanup(void) {
+    if (pidfile_owner != 0 && pidfile_owner == getpid()) {
+        unlink(pidfile_path);
+        pidfile_owner = 0;
+    }
+}`
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Write our PID to a new file, exiting with the other PID if a live
+	// process already holds it. A pidfile left by a dead process is
+	// replaced. Create it after daemonize, so it has the daemon's PID.
+	// One pidfile per program. Needs {{ "" | pidfile_helpers }}.
+	// Example usage:
+	// {{ "/run/mytool.pid" | pidfile_create }}
+	errs = append(errs, registerFilter("pidfile_create", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(
+			`{
+    const char *pid_path = %[1]s;
+    if (strlen(pid_path) >= sizeof(pidfile_path)) {
+        fprintf(stderr, "Pidfile path too long: %%s\n", pid_path);
+        exit(EXIT_FAILURE);
+    }
+    int pid_fd = -1;
+    for (int attempt = 0; attempt < 2 && pid_fd == -1; attempt++) {
+        pid_fd = open(pid_path, O_WRONLY | O_CREAT | O_EXCL, 0644);
+        if (pid_fd != -1 || errno != EEXIST) {
+            break;
+        }
+        long other_pid = 0;
+        FILE *pid_fp = fopen(pid_path, "r");
+        if (pid_fp) {
+            if (fscanf(pid_fp, "%%ld", &other_pid) != 1) {
+                other_pid = 0;
+            }
+            fclose(pid_fp);
+        }
+        if (other_pid > 0 && (kill((pid_t)other_pid, 0) == 0 || errno == EPERM)) {
+            fprintf(stderr, "Already running as PID %%ld (%%s)\n", other_pid, pid_path);
+            exit(EXIT_FAILURE);
+        }
+        // Stale pidfile from a process that's gone.
+        if (unlink(pid_path) == -1 && errno != ENOENT) {
+            break;
+        }
+        errno = EEXIST;
+    }
+    if (pid_fd == -1) {
+        fprintf(stderr, "Failed to create pidfile %%s: %%s\n", pid_path, strerror(errno));
+        exit(EXIT_FAILURE);
+    }
+    char pid_text[32];
+    int pid_len = snprintf(pid_text, sizeof(pid_text), "%%ld\n", (long)getpid());
+    if (write(pid_fd, pid_text, (size_t)pid_len) != pid_len || close(pid_fd) == -1) {
+        fprintf(stderr, "Failed to write pidfile %%s: %%s\n", pid_path, strerror(errno));
+        unlink(pid_path);
+        exit(EXIT_FAILURE);
+    }
+    strcpy(pidfile_path, pid_path);
+    if (pidfile_owner == 0 && atexit(pidfile_cleanup) != 0) {
+        fprintf(stderr, "Failed to register pidfile cleanup\n");
+        unlink(pid_path);
+        exit(EXIT_FAILURE);
+    }
+    pidfile_owner = getpid();
+}`,
+			quoteIfLiteral(in.String()))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Remove the pidfile now rather than at exit. Needs
+	// {{ "" | pidfile_helpers }}.
+	// Example usage:
+	// {{ "/run/mytool.pid" | pidfile_remove }}
+	errs = append(errs, registerFilter("pidfile_remove", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(
+			`{
+    const char *pid_path = %[1]s;
+    if (unlink(pid_path) == -1 && errno != ENOENT) {
+        fprintf(stderr, "Failed to remove pidfile %%s: %%s\n", pid_path, strerror(errno));
+    }
+    if (strcmp(pid_path, pidfile_path) == 0) {
+        pidfile_owner = 0;
+    }
+}`,
+			quoteIfLiteral(in.String()))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	return errors.Join(errs...)
+}
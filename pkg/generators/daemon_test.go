@@ -0,0 +1,79 @@
+package generators
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// deadPID returns the PID of a process that has exited and been reaped.
+func deadPID(t *testing.T) int {
+	t.Helper()
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skipf("can't run true: %v", err)
+	}
+	return cmd.Process.Pid
+}
+
+func TestPidfileCreate(t *testing.T) {
+	src, libs := render(t, `{{ "" | pidfile_helpers }}
+int main(void) {
+    {{ "app.pid" | pidfile_create }}
+    FILE *fp = fopen("app.pid", "r");
+    long written = 0;
+    if (!fp || fscanf(fp, "%ld", &written) != 1) {
+        return 2;
+    }
+    fclose(fp);
+    printf("%d\n", written == (long)getpid());
+    return 0;
+}
+`)
+	bin := compileC(t, src, libs, sanitize)
+
+	tests := []struct {
+		name    string
+		pidfile string // contents before the run, none when empty
+		live    bool
+	}{
+		{name: "no pidfile"},
+		{name: "stale pidfile", pidfile: fmt.Sprintf("%d\n", deadPID(t))},
+		{name: "unreadable pidfile", pidfile: "not a pid\n"},
+		{name: "live holder", pidfile: fmt.Sprintf("%d\n", os.Getpid()), live: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "app.pid")
+			if tt.pidfile != "" {
+				if err := os.WriteFile(path, []byte(tt.pidfile), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			stdout, stderr, code := runC(t, bin, dir)
+
+			if tt.live {
+				want := "Already running as PID " + strconv.Itoa(os.Getpid()) + " (app.pid)\n"
+				if code != 1 || stderr != want {
+					t.Errorf("got exit %d, stderr %q; want exit 1, stderr %q", code, stderr, want)
+				}
+				if data, err := os.ReadFile(path); err != nil || string(data) != tt.pidfile {
+					t.Errorf("live holder's pidfile changed to %q, %v", data, err)
+				}
+				return
+			}
+			if code != 0 || stdout != "1\n" {
+				t.Errorf("got exit %d, stdout %q, stderr %q; want our PID written", code, stdout, stderr)
+			}
+			if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("pidfile not removed at exit: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package generators
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func init() {
+	Register(InitEnvFilters)
+}
+
+func InitEnvFilters() error {
+	var errs []error
+
+	// Example usage:
+	// {{ "log_dir" | env_string : "LOG_DIR,/var/log/app" }}
+	errs = append(errs, registerFilter("env_string", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		varName := in.String()
+		name, def, ok := strings.Cut(param.String(), ",")
+		if !ok {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("env_string needs NAME,default")}
+		}
+		code := fmt.Sprintf(
+			`const char *%[1]s = getenv(%[2]s);
+if (!%[1]s) {
+    %[1]s = %[3]s;
+}`,
+			varName, cStringLiteral(strings.TrimSpace(name)), cStringLiteral(strings.TrimSpace(def)))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Falls back to the default when the variable is unset or not a valid int.
+	// Example usage:
+	// {{ "port" | env_int : "PORT,8080" }}
+	errs = append(errs, registerFilter("env_int", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		varName := in.String()
+		name, def, ok := strings.Cut(param.String(), ",")
+		if !ok {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("env_int needs NAME,default")}
+		}
+		code := fmt.Sprintf(
+			`int %[1]s = %[3]s;
+{
+    const char *env_%[1]s = getenv(%[2]s);
+    if (env_%[1]s && *env_%[1]s) {
+        char *end_%[1]s;
+        errno = 0;
+        long value_%[1]s = strtol(env_%[1]s, &end_%[1]s, 10);
+        if (errno == 0 && *end_%[1]s == '\0' && value_%[1]s >= INT_MIN && value_%[1]s <= INT_MAX) {
+            %[1]s = (int)value_%[1]s;
+        } else {
+            fprintf(stderr, "Ignoring invalid integer in %%s: %%s\n", %[2]s, env_%[1]s);
+        }
+    }
+}`,
+			varName, cStringLiteral(strings.TrimSpace(name)), strings.TrimSpace(def))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Example usage:
+	// {{ "api_key" | env_required : "API_KEY" }}
+	errs = append(errs, registerFilter("env_required", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		varName := in.String()
+		name := cStringLiteral(strings.TrimSpace(param.String()))
+		code := fmt.Sprintf(
+			`const char *%[1]s = getenv(%[2]s);
+if (!%[1]s || !*%[1]s) {
+    fprintf(stderr, "Missing required environment variable %%s\n", %[2]s);
+    exit(EXIT_FAILURE);
+}`,
+			varName, name)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	return errors.Join(errs...)
+}
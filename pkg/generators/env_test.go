@@ -0,0 +1,93 @@
+package generators
+
+import (
+	"os"
+	"testing"
+)
+
+const envTemplate = `#include <stdio.h>
+int main(void) {
+    {{ "dir" | env_string : "CCCP_TEST_DIR,/var/log/app, \"main\"" }}
+    {{ "port" | env_int : "CCCP_TEST_PORT,8080" }}
+    printf("%s %d\n", dir, port);
+    {{ "key" | env_required : "CCCP_TEST_KEY" }}
+    printf("%s\n", key);
+    return 0;
+}
+`
+
+func TestEnvFilters(t *testing.T) {
+	src, libs := render(t, envTemplate)
+	bin := compileC(t, src, libs, sanitize)
+
+	tests := []struct {
+		name       string
+		env        map[string]string
+		wantOut    string
+		wantErr    string
+		wantStatus int
+	}{
+		{
+			name:       "defaults",
+			env:        map[string]string{"CCCP_TEST_KEY": "k1"},
+			wantOut:    "/var/log/app, \"main\" 8080\nk1\n",
+			wantStatus: 0,
+		},
+		{
+			name: "set",
+			env: map[string]string{
+				"CCCP_TEST_DIR":  "/tmp/x",
+				"CCCP_TEST_PORT": "9090",
+				"CCCP_TEST_KEY":  "k2",
+			},
+			wantOut: "/tmp/x 9090\nk2\n",
+		},
+		{
+			name:    "invalid int",
+			env:     map[string]string{"CCCP_TEST_PORT": "90x", "CCCP_TEST_KEY": "k3"},
+			wantOut: "/var/log/app, \"main\" 8080\nk3\n",
+			wantErr: "Ignoring invalid integer in CCCP_TEST_PORT: 90x\n",
+		},
+		{
+			name:       "required missing",
+			env:        map[string]string{},
+			wantOut:    "/var/log/app, \"main\" 8080\n",
+			wantErr:    "Missing required environment variable CCCP_TEST_KEY\n",
+			wantStatus: 1,
+		},
+		{
+			name:       "required empty",
+			env:        map[string]string{"CCCP_TEST_KEY": ""},
+			wantOut:    "/var/log/app, \"main\" 8080\n",
+			wantErr:    "Missing required environment variable CCCP_TEST_KEY\n",
+			wantStatus: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"CCCP_TEST_DIR", "CCCP_TEST_PORT", "CCCP_TEST_KEY"} {
+				value, ok := tt.env[name]
+				if !ok {
+					t.Setenv(name, "")
+					unsetenv(t, name)
+					continue
+				}
+				t.Setenv(name, value)
+			}
+			stdout, stderr, code := runC(t, bin, "")
+			if stdout != tt.wantOut || stderr != tt.wantErr || code != tt.wantStatus {
+				t.Errorf("got exit %d, stdout %q, stderr %q; want exit %d, stdout %q, stderr %q",
+					code, stdout, stderr, tt.wantStatus, tt.wantOut, tt.wantErr)
+			}
+		})
+	}
+}
+
+// unsetenv removes name for the rest of the test. Call t.Setenv first so
+// the old value is restored afterwards.
+func unsetenv(t *testing.T, name string) {
+	t.Helper()
+	if err := os.Unsetenv(name); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,6 +1,9 @@
 package generators
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/flosch/pongo2/v6"
 )
 
@@ -8,14 +11,18 @@ func init() {
 	Register(InitErrorFilters)
 }
 
-func InitErrorFilters() {
-	// Generate error checking macros
+func InitErrorFilters() error {
+	var errs []error
+
+	// Generate error checking macros. CHECK_BOUNDS compares as intmax_t,
+	// like check_bounds, so a negative index fails instead of wrapping.
 	// Example usage:
 	// {{ "" | generate_error_macros }}
 	// Then in code:
 	// CHECK_NULL(buffer, "audio buffer");
 	// CHECK_SYS_CALL(write(fd, data, size), "write failed");
-	pongo2.RegisterFilter("generate_error_macros", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	// CHECK_BOUNDS(i, count, "track index");
+	errs = append(errs, registerFilter("generate_error_macros", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
 		code := `
 #define CHECK_NULL(ptr, msg) do { \
     if (!(ptr)) { \
@@ -29,8 +36,91 @@ func InitErrorFilters() {
         perror(msg); \
         exit(EXIT_FAILURE); \
     } \
+} while(0)
+
+#define CHECK_BOUNDS(index, size, msg) do { \
+    if ((intmax_t)(index) < 0 || (intmax_t)(index) >= (intmax_t)(size)) { \
+        fprintf(stderr, "Bounds check failed: %s (index: %jd, size: %jd) in %s\n", \
+                msg, (intmax_t)(index), (intmax_t)(size), __func__); \
+        exit(EXIT_FAILURE); \
+    } \
 } while(0)`
 
 		return pongo2.AsSafeValue(code), nil
-	})
+	}))
+
+	// Result-style errors for library-like code that should report
+	// failures to its caller instead of exiting. Include once at file
+	// scope. Functions return Result: OK() on success, ERR(code, fmt, ...)
+	// with a printf-style message on failure, and TRY(expr) returns early
+	// when a called function fails.
+	// Example usage:
+	// {{ "" | generate_result }}
+	// Then in code:
+	// Result load(const char *path) {
+	//     if (!path) return ERR(EINVAL, "no path given");
+	//     TRY(parse(path));
+	//     return OK();
+	// }
+	errs = append(errs, registerFilter("generate_result", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := `typedef struct {
+    bool ok;
+    int code;
+    char msg[256];
+} Result;
+
+#if defined(__GNUC__) || defined(__clang__)
+__attribute__((format(printf, 2, 3)))
+#endif
+static inline Result result_err(int code, const char *fmt, ...) {
+    Result r = {.ok = false, .code = code};
+    va_list args;
+    va_start(args, fmt);
+    vsnprintf(r.msg, sizeof(r.msg), fmt, args);
+    va_end(args);
+    return r;
+}
+
+#define OK() ((Result){.ok = true, .code = 0, .msg = ""})
+#define ERR(code, ...) result_err((code), __VA_ARGS__)
+#define TRY(expr) do { \
+    Result try_result_ = (expr); \
+    if (!try_result_.ok) { \
+        return try_result_; \
+    } \
+} while (0)`
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// check_null that returns ERR instead of exiting. The code is errno
+	// when the failed call set it, EINVAL otherwise. Needs
+	// {{ "" | generate_result }}.
+	// Example usage:
+	// {{ "config" | check_null_soft : "config loading" }}
+	errs = append(errs, registerFilter("check_null_soft", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(
+			`// check_null_soft: only valid inside a function returning Result.
+if ((%[1]s) == NULL) {
+    return ERR(errno ? errno : EINVAL, "NULL pointer in %%s: %[2]s", __func__);
+}`,
+			in.String(), cFormatEscape(param.String()))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// check_syscall that returns ERR with errno and its strerror text
+	// instead of exiting. Needs {{ "" | generate_result }}.
+	// Example usage:
+	// {{ "fd = open(path, O_RDONLY)" | check_syscall_soft : "file opening" }}
+	errs = append(errs, registerFilter("check_syscall_soft", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(
+			`// check_syscall_soft: only valid inside a function returning Result.
+if ((%[1]s) == -1) {
+    int soft_err = errno;
+    return ERR(soft_err, "System call failed in %[2]s: %%s", strerror(soft_err));
+}`,
+			in.String(), cFormatEscape(param.String()))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	return errors.Join(errs...)
 }
@@ -0,0 +1,37 @@
+package generators
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckBoundsMacro(t *testing.T) {
+	src, libs := render(t, `{{ "" | generate_error_macros }}
+int main(int argc, char **argv) {
+    int index = (int)strtol(argv[1], NULL, 10);
+    size_t count = 3;
+    CHECK_BOUNDS(index, count, "track index");
+    printf("ok %d\n", index);
+    return 0;
+}
+`)
+	bin := compileC(t, src, libs)
+	tests := []struct {
+		index string
+		ok    bool
+	}{
+		{"0", true},
+		{"2", true},
+		{"3", false},
+		{"-1", false},
+	}
+	for _, tt := range tests {
+		stdout, stderr, code := runC(t, bin, "", tt.index)
+		switch {
+		case tt.ok && (code != 0 || stdout != "ok "+tt.index+"\n"):
+			t.Errorf("index %s: got exit %d, stdout %q, stderr %q; want it accepted", tt.index, code, stdout, stderr)
+		case !tt.ok && (code == 0 || !strings.Contains(stderr, "(index: "+tt.index+", size: 3)")):
+			t.Errorf("index %s: got exit %d, stderr %q; want a bounds failure", tt.index, code, stderr)
+		}
+	}
+}
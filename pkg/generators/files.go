@@ -1,6 +1,7 @@
 package generators
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
@@ -11,31 +12,26 @@ func init() {
 	Register(InitFileFilters)
 }
 
-func InitFileFilters() {
-	// Safe file open with error checking
+func InitFileFilters() error {
+	var errs []error
+
+	// Safe file open with error checking. The filename is a literal, or a
+	// char* variable marked with $. With a third "soft" parameter a failure is reported
+	// and the FILE* left NULL instead of exiting.
 	// Example usage:
 	// FILE *config_file;
 	// {{ "config_file" | safe_fopen : "config.txt,r" }}
-	pongo2.RegisterFilter("safe_fopen", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
-		fileVar := in.String()
-		params := strings.Split(param.String(), ",")
-		if len(params) != 2 {
-			return nil, &pongo2.Error{OrigError: fmt.Errorf("safe_fopen needs filename,mode")}
-		}
-
-		code := fmt.Sprintf(
-			`%[1]s = fopen("%[2]s", "%[3]s");
-if (!%[1]s) {
-    fprintf(stderr, "Failed to open file: %s\n", "%[2]s");
-    exit(EXIT_FAILURE);
-}`,
-			fileVar, params[0], params[1])
-		return pongo2.AsSafeValue(code), nil
-	})
+	// {{ "cache_file" | safe_fopen : "$cache_path,r,soft" }}
+	errs = append(errs, registerFilter("safe_fopen", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code, err := safeFopen(append([]string{in.String()}, strings.Split(param.String(), ",")...))
+		return filterCode("safe_fopen", code, err)
+	}))
+	// {% cgen safe_fopen "report" "out, final.csv" "w" %}
+	errs = append(errs, registerCgen("safe_fopen", safeFopen))
 	// Example usage:
 	// DIR *dir;
 	// {{ "dir" | open_directory : "path" }}
-	pongo2.RegisterFilter("open_directory", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	errs = append(errs, registerFilter("open_directory", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
 		dirVar := in.String()
 		path := param.String()
 
@@ -47,10 +43,10 @@ if (!%[1]s) {
 }`,
 			dirVar, path)
 		return pongo2.AsSafeValue(code), nil
-	})
+	}))
 	// Example usage:
 	// {{ "dir" | close_directory }}
-	pongo2.RegisterFilter("close_directory", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	errs = append(errs, registerFilter("close_directory", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
 		dirVar := in.String()
 
 		code := fmt.Sprintf(
@@ -60,5 +56,192 @@ if (!%[1]s) {
 }`,
 			dirVar)
 		return pongo2.AsSafeValue(code), nil
-	})
+	}))
+
+	// Write len bytes to a file, replacing it. The path may be a literal or
+	// a $-marked char* variable.
+	// Example usage:
+	// {{ "out.bin" | write_file : "data,data_len" }}
+	// {{ "$path" | write_file : "report,strlen(report)" }}
+	errs = append(errs, registerFilter("write_file", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return writeFileCode("write_file", "wb", in, param)
+	}))
+
+	// Like write_file but appends to the file, creating it if needed.
+	// Example usage:
+	// {{ "app.log" | append_file : "line,strlen(line)" }}
+	errs = append(errs, registerFilter("append_file", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return writeFileCode("append_file", "ab", in, param)
+	}))
+
+	// Read a whole file into an AUTO_FREE, NUL-terminated buffer and declare
+	// its size (excluding the terminator). Streams that can't seek, like
+	// pipes, are read in growing chunks. Needs {{ "" | auto_free_generic }}.
+	// Example usage:
+	// {{ "config,config_size" | read_file_all : "config.json" }}
+	errs = append(errs, registerFilter("read_file_all", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		parts := strings.Split(in.String(), ",")
+		if len(parts) != 2 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("read_file_all needs buf,size as input")}
+		}
+		buf, size := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+
+		code := fmt.Sprintf(
+			`AUTO_FREE char *%[1]s = NULL;
+size_t %[2]s = 0;
+{
+    const char *path_%[1]s = %[3]s;
+    FILE *fp_%[1]s = fopen(path_%[1]s, "rb");
+    if (!fp_%[1]s) {
+        fprintf(stderr, "Failed to open file: %%s\n", path_%[1]s);
+        exit(EXIT_FAILURE);
+    }
+    long end_%[1]s = -1;
+    if (fseek(fp_%[1]s, 0, SEEK_END) == 0) {
+        end_%[1]s = ftell(fp_%[1]s);
+    }
+    // One byte of slack so a file of the expected size ends in a short read.
+    size_t cap_%[1]s = end_%[1]s >= 0 && fseek(fp_%[1]s, 0, SEEK_SET) == 0 ? (size_t)end_%[1]s + 1 : 4096;
+    clearerr(fp_%[1]s);
+    %[1]s = malloc(cap_%[1]s + 1);
+    if (!%[1]s) {
+        fprintf(stderr, "Failed to get memory for %[1]s\n");
+        fclose(fp_%[1]s);
+        exit(EXIT_FAILURE);
+    }
+    for (;;) {
+        size_t n_%[1]s = fread(%[1]s + %[2]s, 1, cap_%[1]s - %[2]s, fp_%[1]s);
+        %[2]s += n_%[1]s;
+        if (%[2]s < cap_%[1]s) {
+            break;
+        }
+        // Full buffer: grow and keep going in case there is more.
+        char *grown_%[1]s = realloc(%[1]s, cap_%[1]s * 2 + 1);
+        if (!grown_%[1]s) {
+            fprintf(stderr, "Failed to get memory for %[1]s\n");
+            free(%[1]s);
+            fclose(fp_%[1]s);
+            exit(EXIT_FAILURE);
+        }
+        %[1]s = grown_%[1]s;
+        cap_%[1]s = cap_%[1]s * 2;
+    }
+    if (ferror(fp_%[1]s)) {
+        fprintf(stderr, "Failed to read file: %%s\n", path_%[1]s);
+        free(%[1]s);
+        fclose(fp_%[1]s);
+        exit(EXIT_FAILURE);
+    }
+    fclose(fp_%[1]s);
+    %[1]s[%[2]s] = '\0';
+}`,
+			buf, size, quoteIfLiteral(param.String()))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// stat()-based checks. A missing path (ENOENT/ENOTDIR) gives false, or
+	// -1 for file_size and file_mtime. Any other error is printed with
+	// perror and exits, unless an optional second input name is given: that
+	// int is declared and set to errno instead (0 on success). The path may
+	// be a literal or a $-marked char* variable.
+	// Example usage:
+	// {{ "have_config" | file_exists : "config.json" }}
+	// {{ "log_size" | file_size : "$log_path" }}
+	// {{ "built_at,stat_err" | file_mtime : "output/app" }}
+	// {{ "is_dir" | is_directory : "$argv[1]" }}
+	errs = append(errs, registerFilter("file_exists", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return statCode("file_exists", in, param, "bool %s = false;", "%s = true;")
+	}))
+	errs = append(errs, registerFilter("file_size", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return statCode("file_size", in, param, "long long %s = -1;", "%s = (long long)stat_buf_%[1]s.st_size;")
+	}))
+	errs = append(errs, registerFilter("file_mtime", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return statCode("file_mtime", in, param, "time_t %s = (time_t)-1;", "%s = stat_buf_%[1]s.st_mtime;")
+	}))
+	errs = append(errs, registerFilter("is_directory", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return statCode("is_directory", in, param, "bool %s = false;", "%s = S_ISDIR(stat_buf_%[1]s.st_mode);")
+	}))
+
+	return errors.Join(errs...)
+}
+
+// statCode declares the result with decl, runs stat on the path and sets
+// the result with found on success. Both formats get the result name.
+func statCode(filter string, in *pongo2.Value, param *pongo2.Value, decl, found string) (*pongo2.Value, *pongo2.Error) {
+	parts := strings.Split(in.String(), ",")
+	if len(parts) > 2 {
+		return nil, &pongo2.Error{OrigError: fmt.Errorf("%s needs result[,err] as input", filter)}
+	}
+	out := strings.TrimSpace(parts[0])
+
+	onError := fmt.Sprintf(`perror(path_%[1]s);
+        exit(EXIT_FAILURE);`, out)
+	if len(parts) == 2 {
+		errVar := strings.TrimSpace(parts[1])
+		decl += "\nint " + errVar + " = 0;"
+		onError = errVar + " = errno;"
+	}
+
+	code := fmt.Sprintf(
+		`%[2]s
+{
+    const char *path_%[1]s = %[3]s;
+    struct stat stat_buf_%[1]s;
+    if (stat(path_%[1]s, &stat_buf_%[1]s) == 0) {
+        %[4]s
+    } else if (errno != ENOENT && errno != ENOTDIR) {
+        %[5]s
+    }
+}`,
+		out, fmt.Sprintf(decl, out), quoteIfLiteral(param.String()), fmt.Sprintf(found, out), onError)
+	return pongo2.AsSafeValue(code), nil
+}
+
+func writeFileCode(filter, mode string, in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	parts := strings.Split(param.String(), ",")
+	if len(parts) != 2 {
+		return nil, &pongo2.Error{OrigError: fmt.Errorf("%s needs data,len", filter)}
+	}
+	code := fmt.Sprintf(
+		`{
+    const char *out_path = %[1]s;
+    size_t out_len = (size_t)(%[3]s);
+    FILE *out_fp = fopen(out_path, "%[4]s");
+    if (!out_fp) {
+        fprintf(stderr, "Failed to open file: %%s\n", out_path);
+        exit(EXIT_FAILURE);
+    }
+    if (fwrite(%[2]s, 1, out_len, out_fp) != out_len) {
+        fprintf(stderr, "Short write to file: %%s\n", out_path);
+        fclose(out_fp);
+        exit(EXIT_FAILURE);
+    }
+    if (fclose(out_fp) != 0) {
+        fprintf(stderr, "Failed to close file: %%s\n", out_path);
+        exit(EXIT_FAILURE);
+    }
+}`,
+		quoteIfLiteral(in.String()), strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), mode)
+	return pongo2.AsSafeValue(code), nil
+}
+
+// safeFopen generates safe_fopen from the FILE* variable, filename, mode
+// and optional "soft".
+func safeFopen(args []string) (string, error) {
+	if len(args) != 3 && len(args) != 4 {
+		return "", fmt.Errorf("needs file, filename, mode[, soft]")
+	}
+	onError := "\n    exit(EXIT_FAILURE);"
+	if len(args) == 4 {
+		if mode := strings.TrimSpace(args[3]); mode != "soft" {
+			return "", fmt.Errorf("fourth argument must be soft, got %q", mode)
+		}
+		onError = ""
+	}
+	return fmt.Sprintf(
+		`%[1]s = fopen(%[2]s, %[3]s);
+if (!%[1]s) {
+    fprintf(stderr, "Failed to open file %%s (mode %%s): %%s\n", %[2]s, %[3]s, strerror(errno));%[4]s
+}`,
+		args[0], quoteIfLiteral(args[1]), cStringLiteral(strings.TrimSpace(args[2])), onError), nil
 }
@@ -0,0 +1,167 @@
+package generators
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func TestSafeFopen(t *testing.T) {
+	src, _ := render(t, `int main(void) {
+    const char *cache_path = "cache.bin";
+    FILE *data_file, *cache_file, *report;
+    {{ "data_file" | safe_fopen : "data,r" }}
+    {{ "cache_file" | safe_fopen : "$cache_path,r,soft" }}
+    {% cgen safe_fopen "report" "out, final.csv" "w" %}
+    return data_file && cache_file && report;
+}
+`)
+	for _, want := range []string{
+		`data_file = fopen("data", "r");`,
+		`cache_file = fopen(cache_path, "r");`,
+		`report = fopen("out, final.csv", "w");`,
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("generated C lacks %s:\n%s", want, src)
+		}
+	}
+	syntaxCheck(t, src)
+}
+
+func TestWriteFileReadBack(t *testing.T) {
+	dir := t.TempDir()
+	out := renderAndRunIn(t, dir, `{{ "" | auto_free_generic }}
+#include <string.h>
+int main(void) {
+    const char data[] = {'a', '\0', 'b', '\n'};
+    const char *path = "copy.bin";
+    char big[10000];
+    for (size_t i = 0; i < sizeof(big); i++) big[i] = (char)('a' + i % 26);
+    {{ "out.bin" | write_file : "data,sizeof(data)" }}
+    {{ "$path" | write_file : "big,sizeof(big)" }}
+    {{ "out.bin" | append_file : "\"tail\",4" }}
+    {{ "log.txt" | append_file : "\"first\\n\",6" }}
+    {{ "log.txt" | append_file : "\"second\\n\",7" }}
+    {{ "empty.txt" | write_file : "\"\",0" }}
+    {{ "bin,bin_size" | read_file_all : "out.bin" }}
+    {{ "copy,copy_size" | read_file_all : "$path" }}
+    {{ "log,log_size" | read_file_all : "log.txt" }}
+    {{ "none,none_size" | read_file_all : "empty.txt" }}
+    printf("%zu %d %s\n", bin_size, memcmp(bin, "a\0b\ntail", 8) == 0, bin + 4);
+    printf("%zu %d\n", copy_size, memcmp(copy, big, sizeof(big)) == 0);
+    printf("%zu %s", log_size, log);
+    printf("%zu %d\n", none_size, none[0] == '\0');
+    return 0;
+}
+`, sanitize)
+	if want := "8 1 tail\n10000 1\n13 first\nsecond\n0 1\n"; out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "out.bin")); err != nil || string(data) != "a\x00b\ntail" {
+		t.Errorf("out.bin holds %q, %v", data, err)
+	}
+}
+
+func TestReadFileAllMissing(t *testing.T) {
+	src, libs := render(t, `{{ "" | auto_free_generic }}
+int main(void) {
+    {{ "data,size" | read_file_all : "missing.txt" }}
+    return size == 0 && data == NULL ? 3 : 4;
+}
+`)
+	bin := compileC(t, src, libs, sanitize)
+	_, stderr, code := runC(t, bin, t.TempDir())
+	if code != 1 || stderr != "Failed to open file: missing.txt\n" {
+		t.Errorf("got exit %d, stderr %q", code, stderr)
+	}
+}
+
+func TestStatFiltersRender(t *testing.T) {
+	tests := []struct {
+		tpl   string
+		wants []string
+	}{
+		{`{{ "have_config" | file_exists : "config.json" }}`, []string{
+			"bool have_config = false;",
+			`const char *path_have_config = "config.json";`,
+			"if (stat(path_have_config, &stat_buf_have_config) == 0) {\n        have_config = true;",
+			"perror(path_have_config);",
+		}},
+		{`{{ "log_size" | file_size : "$log_path" }}`, []string{
+			"long long log_size = -1;",
+			"const char *path_log_size = log_path;",
+			"log_size = (long long)stat_buf_log_size.st_size;",
+		}},
+		{`{{ "built_at,stat_err" | file_mtime : "output/app" }}`, []string{
+			"time_t built_at = (time_t)-1;\nint stat_err = 0;",
+			"built_at = stat_buf_built_at.st_mtime;",
+			"} else if (errno != ENOENT && errno != ENOTDIR) {\n        stat_err = errno;",
+		}},
+		{`{{ "is_dir" | is_directory : "$argv[1]" }}`, []string{
+			"bool is_dir = false;",
+			"const char *path_is_dir = argv[1];",
+			"is_dir = S_ISDIR(stat_buf_is_dir.st_mode);",
+		}},
+	}
+	for _, tt := range tests {
+		src, _ := render(t, tt.tpl)
+		for _, want := range tt.wants {
+			if !strings.Contains(src, want) {
+				t.Errorf("%s gave\n%s\nwant it to contain\n%s", tt.tpl, src, want)
+			}
+		}
+		if strings.Contains(src, "stat_err = errno") != strings.Contains(tt.tpl, "stat_err") ||
+			strings.Contains(src, "perror") == strings.Contains(tt.tpl, "stat_err") {
+			t.Errorf("%s: errors should go to the errno variable when one is given, else to perror:\n%s", tt.tpl, src)
+		}
+	}
+
+	if err := InitAll(); err != nil {
+		t.Fatal(err)
+	}
+	tmpl := pongo2.Must(pongo2.FromString(`{{ "a,b,c" | file_size : "x" }}`))
+	if _, err := tmpl.Execute(nil); err == nil || !strings.Contains(err.Error(), "file_size needs result[,err] as input") {
+		t.Errorf("got %v, want an input error", err)
+	}
+}
+
+func TestStatFiltersRun(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "data.txt"), []byte("12345"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stamp := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(dir, "data.txt"), stamp, stamp); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	out := renderAndRunIn(t, dir, `int main(void) {
+    const char *name = "data.txt";
+    {{ "have_data" | file_exists : "$name" }}
+    {{ "have_none" | file_exists : "none.txt" }}
+    {{ "under_file,under_err" | file_exists : "data.txt/x" }}
+    {{ "size" | file_size : "data.txt" }}
+    {{ "none_size" | file_size : "none.txt" }}
+    {{ "mtime" | file_mtime : "data.txt" }}
+    {{ "none_mtime,mtime_err" | file_mtime : "none.txt" }}
+    {{ "sub_is_dir" | is_directory : "sub" }}
+    {{ "file_is_dir" | is_directory : "data.txt" }}
+    printf("%d %d %d %d\n", have_data, have_none, under_file, under_err);
+    printf("%lld %lld\n", size, none_size);
+    printf("%lld %lld %d\n", (long long)mtime, (long long)none_mtime, mtime_err);
+    printf("%d %d\n", sub_is_dir, file_is_dir);
+    return 0;
+}
+`, sanitize)
+	want := fmt.Sprintf("1 0 0 0\n5 -1\n%d -1 0\n1 0\n", stamp.Unix())
+	if out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+}
@@ -0,0 +1,334 @@
+package generators
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func init() {
+	Register(InitFSOpsFilters)
+}
+
+// The mkdir_all, copy_file, move_file and remove_temp_dir filters call
+// helpers emitted by fs_helpers. Paths are literals, or char* variables marked with $;
+// failures print the strerror text and exit.
+func InitFSOpsFilters() error {
+	var errs []error
+
+	// fs_mkdir_all, fs_copy_file, fs_move_file and fs_remove_tree helpers,
+	// include at file scope. Repeat uses in the same file emit nothing. The
+	// helpers return 0 or -1 with errno set, and never leave a partial
+	// destination behind.
+	// Example usage:
+	// {{ "" | fs_helpers }}
+	errs = append(errs, registerFilter("fs_helpers", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := `// Creates path and any missing parents. Existing directories are fine.
+static int fs_mkdir_all(const char *path, mode_t mode) {
+    size_t len = strlen(path);
+    if (len == 0) {
+        errno = ENOENT;
+        return -1;
+    }
+    char *buf = malloc(len + 1);
+    if (!buf) {
+        return -1;
+    }
+    memcpy(buf, path, len + 1);
+    for (char *p = buf + 1;; p++) {
+        if (*p != '/' && *p != '\0') {
+            continue;
+        }
+        char saved = *p;
+        *p = '\0';
+        if (mkdir(buf, mode) == -1 && errno != EEXIST) {
+            int err = errno;
+            free(buf);
+            errno = err;
+            return -1;
+        }
+        if (saved == '\0') {
+            break;
+        }
+        *p = saved;
+    }
+    free(buf);
+
+    struct stat st;
+    if (stat(path, &st) == -1) {
+        return -1;
+    }
+    if (!S_ISDIR(st.st_mode)) {
+        errno = ENOTDIR;
+        return -1;
+    }
+    return 0;
+}
+
+// Copies src to dst in 64 KB chunks, keeping the permission bits, and
+// syncs dst before closing it. dst is removed if anything fails.
+static int fs_copy_file(const char *src, const char *dst) {
+    char buf[64 * 1024];
+    int err;
+    int in = open(src, O_RDONLY);
+    if (in == -1) {
+        return -1;
+    }
+    struct stat st;
+    if (fstat(in, &st) == -1) {
+        err = errno;
+        close(in);
+        errno = err;
+        return -1;
+    }
+    int out = open(dst, O_WRONLY | O_CREAT | O_TRUNC, st.st_mode & 0777);
+    if (out == -1) {
+        err = errno;
+        close(in);
+        errno = err;
+        return -1;
+    }
+    for (;;) {
+        ssize_t n = read(in, buf, sizeof(buf));
+        if (n == 0) {
+            break;
+        }
+        if (n == -1) {
+            if (errno == EINTR) {
+                continue;
+            }
+            goto fail;
+        }
+        for (ssize_t off = 0; off < n;) {
+            ssize_t w = write(out, buf + off, (size_t)(n - off));
+            if (w == -1) {
+                if (errno == EINTR) {
+                    continue;
+                }
+                goto fail;
+            }
+            off += w;
+        }
+    }
+    if (fsync(out) == -1) {
+        goto fail;
+    }
+    if (close(out) == -1) {
+        out = -1;
+        goto fail;
+    }
+    close(in);
+    return 0;
+
+fail:
+    err = errno;
+    if (out != -1) {
+        close(out);
+    }
+    close(in);
+    unlink(dst);
+    errno = err;
+    return -1;
+}
+
+// Renames src to dst, copying and unlinking when they are on different
+// filesystems.
+static int fs_move_file(const char *src, const char *dst) {
+    if (rename(src, dst) == 0) {
+        return 0;
+    }
+    if (errno != EXDEV || fs_copy_file(src, dst) == -1) {
+        return -1;
+    }
+    if (unlink(src) == -1) {
+        int err = errno;
+        unlink(dst);
+        errno = err;
+        return -1;
+    }
+    return 0;
+}
+
+// Deletes path and, for a directory, everything below it. Symlinks are
+// removed, not followed. A missing path counts as success. This walks with
+// readdir rather than nftw so it needs no feature-test macros.
+static int fs_remove_tree(const char *path) {
+    struct stat st;
+    if (lstat(path, &st) == -1) {
+        return errno == ENOENT ? 0 : -1;
+    }
+    if (!S_ISDIR(st.st_mode)) {
+        return unlink(path);
+    }
+    DIR *dir = opendir(path);
+    if (!dir) {
+        return -1;
+    }
+    int rc = 0;
+    struct dirent *de;
+    while (rc == 0 && (de = readdir(dir))) {
+        if (strcmp(de->d_name, ".") == 0 || strcmp(de->d_name, "..") == 0) {
+            continue;
+        }
+        char child[PATH_MAX];
+        if (snprintf(child, sizeof(child), "%s/%s", path, de->d_name) >= (int)sizeof(child)) {
+            errno = ENAMETOOLONG;
+            rc = -1;
+            break;
+        }
+        rc = fs_remove_tree(child);
+    }
+    int err = errno;
+    closedir(dir);
+    if (rc == -1) {
+        errno = err;
+        return -1;
+    }
+    return rmdir(path);
+}`
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Mode defaults to 0755. Needs {{ "" | fs_helpers }}.
+	// Example usage:
+	// {{ "build/cache/objects" | mkdir_all }}
+	// {{ "$out_dir" | mkdir_all : "0700" }}
+	errs = append(errs, registerFilter("mkdir_all", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		mode := strings.TrimSpace(param.String())
+		if mode == "" {
+			mode = "0755"
+		}
+		code := fmt.Sprintf(
+			`{
+    const char *mkdir_path = %[1]s;
+    if (fs_mkdir_all(mkdir_path, %[2]s) == -1) {
+        fprintf(stderr, "Failed to create directory %%s: %%s\n", mkdir_path, strerror(errno));
+        exit(EXIT_FAILURE);
+    }
+}`,
+			quoteIfLiteral(in.String()), mode)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Needs {{ "" | fs_helpers }}.
+	// Example usage:
+	// {{ "config.json" | copy_file : "config.json.bak" }}
+	errs = append(errs, registerFilter("copy_file", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return fsTransferCode("fs_copy_file", "copy", in, param), nil
+	}))
+
+	// Works across filesystems. Needs {{ "" | fs_helpers }}.
+	// Example usage:
+	// {{ "$tmp_path" | move_file : "$final_path" }}
+	errs = append(errs, registerFilter("move_file", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return fsTransferCode("fs_move_file", "move", in, param), nil
+	}))
+
+	// Delete a file. A file that is already gone is not an error.
+	// Example usage:
+	// {{ "$lock_path" | remove_file }}
+	errs = append(errs, registerFilter("remove_file", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(
+			`{
+    const char *remove_path = %[1]s;
+    if (unlink(remove_path) == -1 && errno != ENOENT) {
+        fprintf(stderr, "Failed to remove %%s: %%s\n", remove_path, strerror(errno));
+        exit(EXIT_FAILURE);
+    }
+}`,
+			quoteIfLiteral(in.String()))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Create and open a fresh file under $TMPDIR (or /tmp) with mkstemp and
+	// declare its fd and path (a char[PATH_MAX]). The prefix is always
+	// embedded as a string literal unless already quoted.
+	// Example usage:
+	// {{ "tmp_fd,tmp_path" | temp_file : "cccp-" }}
+	errs = append(errs, registerFilter("temp_file", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		parts := strings.Split(in.String(), ",")
+		if len(parts) != 2 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("temp_file needs fd,path as input")}
+		}
+		fd, path := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		code := fmt.Sprintf(
+			`int %[1]s = -1;
+char %[2]s[PATH_MAX];
+{
+%[3]s
+    %[1]s = mkstemp(%[2]s);
+    if (%[1]s == -1) {
+        fprintf(stderr, "Failed to create temp file %%s: %%s\n", %[2]s, strerror(errno));
+        exit(EXIT_FAILURE);
+    }
+}`,
+			fd, path, tempTemplate(path, param))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Create a private (0700) directory under $TMPDIR (or /tmp) with mkdtemp
+	// and declare its path as a char[PATH_MAX].
+	// Example usage:
+	// {{ "work_dir" | temp_dir : "cccp-build-" }}
+	errs = append(errs, registerFilter("temp_dir", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		path := in.String()
+		code := fmt.Sprintf(
+			`char %[1]s[PATH_MAX];
+{
+%[2]s
+    if (!mkdtemp(%[1]s)) {
+        fprintf(stderr, "Failed to create temp directory %%s: %%s\n", %[1]s, strerror(errno));
+        exit(EXIT_FAILURE);
+    }
+}`,
+			path, tempTemplate(path, param))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Recursively delete a directory such as one made by temp_dir. Needs
+	// {{ "" | fs_helpers }}.
+	// Example usage:
+	// {{ "$work_dir" | remove_temp_dir }}
+	errs = append(errs, registerFilter("remove_temp_dir", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(
+			`if (fs_remove_tree(%[1]s) == -1) {
+    fprintf(stderr, "Failed to remove %%s: %%s\n", %[1]s, strerror(errno));
+    exit(EXIT_FAILURE);
+}`,
+			quoteIfLiteral(in.String()))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	return errors.Join(errs...)
+}
+
+// tempTemplate fills path with "$TMPDIR/<prefix>XXXXXX", exiting if it
+// doesn't fit.
+func tempTemplate(path string, prefix *pongo2.Value) string {
+	return fmt.Sprintf(
+		`    const char *tmpdir_%[1]s = getenv("TMPDIR");
+    if (!tmpdir_%[1]s || !*tmpdir_%[1]s) {
+        tmpdir_%[1]s = "/tmp";
+    }
+    if (snprintf(%[1]s, sizeof(%[1]s), "%%s/%%sXXXXXX", tmpdir_%[1]s, %[2]s) >= (int)sizeof(%[1]s)) {
+        fprintf(stderr, "Temp path too long in %%s\n", tmpdir_%[1]s);
+        exit(EXIT_FAILURE);
+    }`,
+		path, quoteString(prefix.String()))
+}
+
+func fsTransferCode(helper, verb string, in *pongo2.Value, param *pongo2.Value) *pongo2.Value {
+	code := fmt.Sprintf(
+		`{
+    const char *%[2]s_src = %[3]s;
+    const char *%[2]s_dst = %[4]s;
+    if (%[1]s(%[2]s_src, %[2]s_dst) == -1) {
+        fprintf(stderr, "Failed to %[2]s %%s to %%s: %%s\n", %[2]s_src, %[2]s_dst, strerror(errno));
+        exit(EXIT_FAILURE);
+    }
+}`,
+		helper, verb, quoteIfLiteral(in.String()), quoteIfLiteral(param.String()))
+	return pongo2.AsSafeValue(code)
+}
@@ -0,0 +1,131 @@
+package generators
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// fsopsTemplate creates the directory argv[4], copies argv[1] to argv[2]
+// and moves the copy to argv[3].
+const fsopsTemplate = `{{ "" | fs_helpers }}
+int main(int argc, char **argv) {
+    if (argc != 5) {
+        return 2;
+    }
+    const char *src = argv[1], *copy = argv[2], *moved = argv[3], *dir = argv[4];
+    {{ "$dir" | mkdir_all : "0700" }}
+    {{ "$src" | copy_file : "$copy" }}
+    {{ "$copy" | move_file : "$moved" }}
+    {{ "$copy" | remove_file }}
+    {{ "never-existed.txt" | remove_file }}
+    return 0;
+}
+`
+
+// bigFile is larger than fs_copy_file's 64 KB buffer and not a multiple of
+// it, so the copy takes several reads and a short last one.
+func bigFile(t *testing.T, path string) []byte {
+	t.Helper()
+	data := bytes.Repeat([]byte("0123456789abcdef\n"), 10000)
+	if err := os.WriteFile(path, data, 0o640); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func checkMoved(t *testing.T, copyPath, movedPath string, want []byte) {
+	t.Helper()
+	if _, err := os.Stat(copyPath); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("%s still exists after the move: %v", copyPath, err)
+	}
+	got, err := os.ReadFile(movedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s has %d bytes, want the %d bytes copied", movedPath, len(got), len(want))
+	}
+	info, err := os.Stat(movedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o640 {
+		t.Errorf("%s mode = %o, want 0640", movedPath, perm)
+	}
+}
+
+func TestCopyAndMoveFile(t *testing.T) {
+	src, libs := render(t, fsopsTemplate)
+	bin := compileC(t, src, libs, sanitize)
+
+	dir := t.TempDir()
+	want := bigFile(t, filepath.Join(dir, "in.txt"))
+	outDir := filepath.Join(dir, "out", "nested")
+	moved := filepath.Join(outDir, "moved.txt")
+	copyPath := filepath.Join(dir, "copy.txt")
+
+	_, stderr, code := runC(t, bin, dir, "in.txt", copyPath, moved, outDir)
+	if code != 0 {
+		t.Fatalf("program exited %d: %s", code, stderr)
+	}
+	checkMoved(t, copyPath, moved, want)
+	if got, err := os.ReadFile(filepath.Join(dir, "in.txt")); err != nil || !bytes.Equal(got, want) {
+		t.Errorf("source changed by the copy: %v", err)
+	}
+	if info, err := os.Stat(outDir); err != nil || info.Mode().Perm() != 0o700 {
+		t.Errorf("mkdir_all made %v, %v; want a 0700 directory", info, err)
+	}
+}
+
+func TestMoveFileAcrossFilesystems(t *testing.T) {
+	dir := t.TempDir()
+	other, err := os.MkdirTemp("/dev/shm", "cccp-")
+	if err != nil {
+		t.Skipf("no /dev/shm: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(other) })
+	var a, b syscall.Stat_t
+	if syscall.Stat(dir, &a) != nil || syscall.Stat(other, &b) != nil || a.Dev == b.Dev {
+		t.Skip("temp dir and /dev/shm are on the same filesystem")
+	}
+
+	src, libs := render(t, fsopsTemplate)
+	bin := compileC(t, src, libs, sanitize)
+	want := bigFile(t, filepath.Join(dir, "in.txt"))
+	copyPath := filepath.Join(dir, "copy.txt")
+	moved := filepath.Join(other, "moved.txt")
+
+	_, stderr, code := runC(t, bin, dir, "in.txt", copyPath, moved, other)
+	if code != 0 {
+		t.Fatalf("program exited %d: %s", code, stderr)
+	}
+	checkMoved(t, copyPath, moved, want)
+}
+
+func TestCopyFileFailureLeavesNoPartialFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "a-directory"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// Opening a directory for reading works; reading it fails after the
+	// destination was created.
+	src, libs := render(t, `{{ "" | fs_helpers }}
+int main(void) {
+    {{ "a-directory" | copy_file : "partial.txt" }}
+    return 0;
+}
+`)
+	bin := compileC(t, src, libs, sanitize)
+	_, stderr, code := runC(t, bin, dir)
+	if want := "Failed to copy a-directory to partial.txt: Is a directory\n"; code != 1 || stderr != want {
+		t.Errorf("got exit %d, stderr %q; want exit 1, stderr %q", code, stderr, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "partial.txt")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("partial destination left behind: %v", err)
+	}
+}
@@ -0,0 +1,247 @@
+package generators
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func init() {
+	Register(InitHashMapFilters)
+}
+
+// Hash maps from strings to a value type. map_create, at file scope,
+// declares a map instance named after its input plus the <name>_entry,
+// <name>_map and <name>_value types and <name>_* functions, so maps with
+// different value types can coexist. The other map_* filters work on a
+// map by name. Keys are C expressions; the map stores its own copies.
+// The functions are static inline so unused ones don't trigger warnings.
+// With the value type "rcstr" (see generate_rcstring) values are rcstr
+// pointers and the map owns one reference to each, dropped when a value
+// is overwritten or deleted and by map_free.
+func InitHashMapFilters() error {
+	var errs []error
+
+	// Example usage:
+	// {{ "ages" | map_create : "int" }}
+	// {{ "labels" | map_create : "rcstr" }}
+	errs = append(errs, registerFilter("map_create", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		name := in.String()
+		valueType := strings.TrimSpace(param.String())
+		if valueType == "" {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("map_create needs a value type")}
+		}
+
+		valueType, release := containerRelease(valueType)
+		code := fmt.Sprintf(
+			`typedef %[2]s %[1]s_value;
+
+static inline void %[1]s_release(%[1]s_value value) {
+    %[3]s
+}
+
+typedef struct %[1]s_entry {
+    char *key;
+    %[1]s_value value;
+    struct %[1]s_entry *next;
+} %[1]s_entry;
+
+typedef struct {
+    %[1]s_entry **buckets;
+    size_t cap;
+    size_t len;
+} %[1]s_map;
+
+static %[1]s_map %[1]s;
+
+static inline size_t %[1]s_hash(const char *key, size_t cap) {
+    unsigned long h = 2166136261UL;
+    for (const unsigned char *p = (const unsigned char *)key; *p; p++) {
+        h = (h ^ *p) * 16777619UL;
+    }
+    return (size_t)(h %% cap);
+}
+
+static inline %[1]s_entry *%[1]s_find(%[1]s_map *m, const char *key) {
+    if (m->cap == 0) {
+        return NULL;
+    }
+    for (%[1]s_entry *e = m->buckets[%[1]s_hash(key, m->cap)]; e; e = e->next) {
+        if (strcmp(e->key, key) == 0) {
+            return e;
+        }
+    }
+    return NULL;
+}
+
+// Grows the table so it stays at or below a 0.75 load factor.
+static inline void %[1]s_grow(%[1]s_map *m) {
+    size_t cap = m->cap ? m->cap * 2 : 16;
+    %[1]s_entry **buckets = calloc(cap, sizeof(*buckets));
+    if (!buckets) {
+        fprintf(stderr, "Failed to get memory for map %[1]s\n");
+        exit(EXIT_FAILURE);
+    }
+    for (size_t i = 0; i < m->cap; i++) {
+        %[1]s_entry *e = m->buckets[i];
+        while (e) {
+            %[1]s_entry *next = e->next;
+            size_t b = %[1]s_hash(e->key, cap);
+            e->next = buckets[b];
+            buckets[b] = e;
+            e = next;
+        }
+    }
+    free(m->buckets);
+    m->buckets = buckets;
+    m->cap = cap;
+}
+
+static inline void %[1]s_put(%[1]s_map *m, const char *key, %[1]s_value value) {
+    %[1]s_entry *e = %[1]s_find(m, key);
+    if (e) {
+        %[1]s_release(e->value);
+        e->value = value;
+        return;
+    }
+    if (m->cap == 0 || (m->len + 1) * 4 > m->cap * 3) {
+        %[1]s_grow(m);
+    }
+    e = malloc(sizeof(*e));
+    char *copy = e ? strdup(key) : NULL;
+    if (!copy) {
+        fprintf(stderr, "Failed to get memory for map %[1]s\n");
+        exit(EXIT_FAILURE);
+    }
+    size_t b = %[1]s_hash(key, m->cap);
+    e->key = copy;
+    e->value = value;
+    e->next = m->buckets[b];
+    m->buckets[b] = e;
+    m->len++;
+}
+
+static inline bool %[1]s_get(%[1]s_map *m, const char *key, %[1]s_value *out) {
+    %[1]s_entry *e = %[1]s_find(m, key);
+    if (e) {
+        *out = e->value;
+    }
+    return e != NULL;
+}
+
+static inline bool %[1]s_delete(%[1]s_map *m, const char *key) {
+    if (m->cap == 0) {
+        return false;
+    }
+    for (%[1]s_entry **link = &m->buckets[%[1]s_hash(key, m->cap)]; *link; link = &(*link)->next) {
+        %[1]s_entry *e = *link;
+        if (strcmp(e->key, key) == 0) {
+            *link = e->next;
+            %[1]s_release(e->value);
+            free(e->key);
+            free(e);
+            m->len--;
+            return true;
+        }
+    }
+    return false;
+}
+
+static inline void %[1]s_free(%[1]s_map *m) {
+    for (size_t i = 0; i < m->cap; i++) {
+        %[1]s_entry *e = m->buckets[i];
+        while (e) {
+            %[1]s_entry *next = e->next;
+            %[1]s_release(e->value);
+            free(e->key);
+            free(e);
+            e = next;
+        }
+    }
+    free(m->buckets);
+    m->buckets = NULL;
+    m->cap = 0;
+    m->len = 0;
+}`,
+			name, valueType, release)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Insert or overwrite. The value comes last so it may contain commas.
+	// Example usage:
+	// {{ "ages" | map_put : "name,age + 1" }}
+	errs = append(errs, registerFilter("map_put", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		parts := strings.SplitN(param.String(), ",", 2)
+		if len(parts) != 2 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("map_put needs key,value")}
+		}
+		code := fmt.Sprintf(`%[1]s_put(&%[1]s, %[2]s, %[3]s);`,
+			in.String(), strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Declares value (zeroed when missing) and a found bool.
+	// Example usage:
+	// {{ "age,found" | map_get : "ages,name" }}
+	errs = append(errs, registerFilter("map_get", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		outs := strings.Split(in.String(), ",")
+		parts := strings.SplitN(param.String(), ",", 2)
+		if len(outs) != 2 || len(parts) != 2 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("map_get needs value,found as input and map,key")}
+		}
+		out, found := strings.TrimSpace(outs[0]), strings.TrimSpace(outs[1])
+		name := strings.TrimSpace(parts[0])
+		code := fmt.Sprintf(
+			`%[1]s_value %[2]s = {0};
+bool %[3]s = %[1]s_get(&%[1]s, %[4]s, &%[2]s);`,
+			name, out, found, strings.TrimSpace(parts[1]))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Removing a missing key is a no-op.
+	// Example usage:
+	// {{ "ages" | map_delete : "name" }}
+	errs = append(errs, registerFilter("map_delete", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(`%[1]s_delete(&%[1]s, %[2]s);`, in.String(), param.String())
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Loop over all entries in no particular order; close with
+	// map_foreach_end. Don't put or delete while iterating.
+	// Example usage:
+	// {{ "ages" | map_foreach : "name,age" }}
+	//     printf("%s is %d\n", name, age);
+	// {{ "ages" | map_foreach_end }}
+	errs = append(errs, registerFilter("map_foreach", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		parts := strings.Split(param.String(), ",")
+		if len(parts) != 2 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("map_foreach needs key,value")}
+		}
+		code := fmt.Sprintf(
+			`for (size_t %[1]s_bucket = 0; %[1]s_bucket < %[1]s.cap; %[1]s_bucket++) {
+    for (%[1]s_entry *%[1]s_it = %[1]s.buckets[%[1]s_bucket]; %[1]s_it; %[1]s_it = %[1]s_it->next) {
+        const char *%[2]s = %[1]s_it->key;
+        %[1]s_value %[3]s = %[1]s_it->value;
+        {`,
+			in.String(), strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Example usage:
+	// {{ "ages" | map_foreach_end }}
+	errs = append(errs, registerFilter("map_foreach_end", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return pongo2.AsSafeValue("        }\n    }\n}"), nil
+	}))
+
+	// Frees every entry and key copy; the map is empty and reusable after.
+	// Example usage:
+	// {{ "ages" | map_free }}
+	errs = append(errs, registerFilter("map_free", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(`%[1]s_free(&%[1]s);`, in.String())
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,48 @@
+package generators
+
+import "testing"
+
+func TestHashMap(t *testing.T) {
+	out := renderAndRun(t, `{{ "" | generate_rcstring }}
+{{ "ages" | map_create : "int" }}
+{{ "labels" | map_create : "rcstr" }}
+int main(void) {
+    char key[32];
+    for (int i = 0; i < 1000; i++) {
+        snprintf(key, sizeof(key), "k%d", i);
+        {{ "ages" | map_put : "key,i" }}
+    }
+    {{ "ages" | map_put : "\"k7\",700" }}
+    {{ "ages" | map_delete : "\"k8\"" }}
+    {{ "ages" | map_delete : "\"missing\"" }}
+    {{ "seven,seven_found" | map_get : "ages,\"k7\"" }}
+    {{ "eight,eight_found" | map_get : "ages,\"k8\"" }}
+    printf("%d %d %d %d\n", seven, seven_found, eight, eight_found);
+    long sum = 0, count = 0;
+    {{ "ages" | map_foreach : "name,age" }}
+        sum += age;
+        count += name[0] == 'k';
+    {{ "ages" | map_foreach_end }}
+    printf("%ld %ld\n", count, sum);
+    {{ "ages" | map_free }}
+    {{ "again,again_found" | map_get : "ages,\"k7\"" }}
+    printf("%d\n", again_found);
+
+    {{ "shared" | rcstr_new : "hello" }}
+    {{ "labels" | map_put : "\"a\",rcstr_ref(shared)" }}
+    {{ "labels" | map_put : "\"b\",rcstr_ref(shared)" }}
+    {{ "labels" | map_put : "\"a\",rcstr_new(\"replaced\")" }}
+    {{ "label,label_found" | map_get : "labels,\"a\"" }}
+    printf("%s %zu\n", rcstr_cstr(label), shared->refs);
+    {{ "labels" | map_free }}
+    printf("%zu\n", shared->refs);
+    {{ "shared" | rcstr_unref }}
+    return 0;
+}
+`, sanitize)
+	// 0..999 is 499500; k8 is gone and k7 became 700.
+	want := "700 1 0 0\n999 500185\n0\nreplaced 2\n1\n"
+	if out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+}
@@ -0,0 +1,523 @@
+package generators
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func init() {
+	Register(InitHTTPFilters)
+}
+
+func InitHTTPFilters() error {
+	var errs []error
+
+	// Shared libcurl write callback plus AUTO_SLIST header-list and AUTO_CURL
+	// handle cleanup, include once at file scope before any http_*/curl_*
+	// call site. Link with -lcurl.
+	// Example usage:
+	// {{ "" | http_callback }}
+	errs = append(errs, registerFilter("http_callback", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := `struct http_buffer {
+    char *data;
+    size_t size;
+};
+
+static size_t http_write_callback(char *ptr, size_t size, size_t nmemb, void *userdata) {
+    struct http_buffer *buf = userdata;
+    size_t chunk = size * nmemb;
+    char *grown = realloc(buf->data, buf->size + chunk + 1);
+    if (!grown) {
+        return 0;  // tells curl to abort the transfer
+    }
+    buf->data = grown;
+    memcpy(buf->data + buf->size, ptr, chunk);
+    buf->size += chunk;
+    buf->data[buf->size] = '\0';
+    return chunk;
+}
+
+static void http_free_slist(struct curl_slist **list) {
+    if (*list) {
+        curl_slist_free_all(*list);
+        *list = NULL;
+    }
+}
+
+// Appends header to *list. If that fails the whole list is freed and set
+// to NULL, so a request never goes out with some of its headers missing.
+static int http_append_header(struct curl_slist **list, const char *header) {
+    struct curl_slist *grown = curl_slist_append(*list, header);
+    if (!grown) {
+        http_free_slist(list);
+        return 0;
+    }
+    *list = grown;
+    return 1;
+}
+
+static void http_free_curl(CURL **handle) {
+    if (*handle) {
+        curl_easy_cleanup(*handle);
+        *handle = NULL;
+    }
+}
+
+#if defined(__GNUC__) || defined(__clang__)
+#define AUTO_SLIST __attribute__((cleanup(http_free_slist)))
+#define AUTO_CURL __attribute__((cleanup(http_free_curl)))
+#else
+#define AUTO_SLIST
+#define AUTO_CURL
+#endif`
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// GET a URL and capture the response. Declares <response> (char*,
+	// caller frees, NULL on failure) and <response>_status (the HTTP status
+	// code). Redirects are followed. An optional header list (see
+	// curl_headers) can follow the response name. Use http_get_with_retry
+	// for flaky endpoints. Needs {{ "" | http_callback }}.
+	// Example usage:
+	// {{ "page" | http_get : "https://example.com/" }}
+	// {{ "page,api_headers" | http_get : "$url" }}
+	errs = append(errs, registerFilter("http_get", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		resp, headers := splitResponseArg(in.String())
+		url := quoteIfLiteral(param.String())
+		setHeaders := ""
+		if headers != "" {
+			setHeaders = fmt.Sprintf("    curl_easy_setopt(curl_%s, CURLOPT_HTTPHEADER, %s);\n", resp, headers)
+		}
+
+		code := fmt.Sprintf(
+			`char *%[1]s = NULL;
+long %[1]s_status = 0;
+{
+    CURL *curl_%[1]s = curl_easy_init();
+    if (!curl_%[1]s) {
+        fprintf(stderr, "Failed to initialize curl for %[1]s\n");
+        exit(EXIT_FAILURE);
+    }
+    struct http_buffer buf_%[1]s = {0};
+    curl_easy_setopt(curl_%[1]s, CURLOPT_URL, %[2]s);
+    curl_easy_setopt(curl_%[1]s, CURLOPT_WRITEFUNCTION, http_write_callback);
+    curl_easy_setopt(curl_%[1]s, CURLOPT_WRITEDATA, &buf_%[1]s);
+    curl_easy_setopt(curl_%[1]s, CURLOPT_FOLLOWLOCATION, 1L);
+%[3]s    CURLcode rc_%[1]s = curl_easy_perform(curl_%[1]s);
+    if (rc_%[1]s != CURLE_OK) {
+        fprintf(stderr, "GET %%s failed: %%s\n", %[2]s, curl_easy_strerror(rc_%[1]s));
+        free(buf_%[1]s.data);
+        buf_%[1]s.data = NULL;
+    } else {
+        curl_easy_getinfo(curl_%[1]s, CURLINFO_RESPONSE_CODE, &%[1]s_status);
+        if (%[1]s_status < 200 || %[1]s_status >= 300) {
+            fprintf(stderr, "GET %%s returned HTTP %%ld\n", %[2]s, %[1]s_status);
+        }
+    }
+    %[1]s = buf_%[1]s.data;
+    curl_easy_cleanup(curl_%[1]s);
+}`,
+			resp, url, setHeaders)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// POST a body and capture the response. Declares <response> (char*, caller
+	// frees, NULL on failure) and <response>_status (the HTTP status code).
+	// Every curl local is suffixed with the response name so several calls can
+	// share a scope. Needs {{ "" | http_callback }}.
+	// Example usage:
+	// {{ "reply" | http_post : "https://example.com/api,application/json,$payload" }}
+	// {{ "reply" | http_post : "https://example.com/api,text/plain,hello there" }}
+	// {{ "reply,api_headers" | http_post : "https://example.com/api,application/json,$payload" }}
+	// The body (everything after the second comma) is used as a C expression
+	// when it is marked with $, otherwise it is quoted as a string literal. An
+	// optional header list (see curl_headers) after the response name is
+	// copied into the request's headers. Running out of memory while
+	// building the headers fails the request like a transport error.
+	errs = append(errs, registerFilter("http_post", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		resp, extraHeaders := splitResponseArg(in.String())
+		params := strings.SplitN(param.String(), ",", 3)
+		if len(params) != 3 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("http_post needs url,content_type,body")}
+		}
+		url := quoteIfLiteral(params[0])
+		contentType := strings.TrimSpace(params[1])
+		body := quoteIfLiteral(params[2])
+
+		code := fmt.Sprintf(
+			`char *%[1]s = NULL;
+long %[1]s_status = 0;
+{
+    // Declared first so it outlives the handle that points at it.
+    AUTO_SLIST struct curl_slist *headers_%[1]s = NULL;
+    AUTO_CURL CURL *curl_%[1]s = curl_easy_init();
+    if (!curl_%[1]s) {
+        fprintf(stderr, "Failed to initialize curl for %[1]s\n");
+        exit(EXIT_FAILURE);
+    }
+    struct http_buffer buf_%[1]s = {0};
+    int headers_ok_%[1]s = http_append_header(&headers_%[1]s, "Content-Type: %[3]s");
+%[5]s    if (!headers_ok_%[1]s) {
+        fprintf(stderr, "POST %%s failed: out of memory building headers\n", %[2]s);
+    } else {
+        const char *body_%[1]s = %[4]s;
+        curl_easy_setopt(curl_%[1]s, CURLOPT_URL, %[2]s);
+        curl_easy_setopt(curl_%[1]s, CURLOPT_HTTPHEADER, headers_%[1]s);
+        curl_easy_setopt(curl_%[1]s, CURLOPT_POSTFIELDS, body_%[1]s);
+        curl_easy_setopt(curl_%[1]s, CURLOPT_POSTFIELDSIZE, (long)strlen(body_%[1]s));
+        curl_easy_setopt(curl_%[1]s, CURLOPT_WRITEFUNCTION, http_write_callback);
+        curl_easy_setopt(curl_%[1]s, CURLOPT_WRITEDATA, &buf_%[1]s);
+        CURLcode rc_%[1]s = curl_easy_perform(curl_%[1]s);
+        if (rc_%[1]s != CURLE_OK) {
+            fprintf(stderr, "POST %%s failed: %%s\n", %[2]s, curl_easy_strerror(rc_%[1]s));
+            free(buf_%[1]s.data);
+            buf_%[1]s.data = NULL;
+        } else {
+            curl_easy_getinfo(curl_%[1]s, CURLINFO_RESPONSE_CODE, &%[1]s_status);
+            if (%[1]s_status < 200 || %[1]s_status >= 300) {
+                fprintf(stderr, "POST %%s returned HTTP %%ld\n", %[2]s, %[1]s_status);
+            }
+        }
+    }
+    %[1]s = buf_%[1]s.data;
+}`,
+			resp, url, cEscape(contentType), body, copyHeaders(resp, extraHeaders))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Build a header list, freed automatically at scope exit. Headers are
+	// separated by |. With "list,handle" the list is also attached to that
+	// CURL* handle. Needs {{ "" | http_callback }}.
+	// Example usage:
+	// {{ "api_headers" | curl_headers : "Accept: application/json|X-Client: cccp" }}
+	// {{ "api_headers,curl" | curl_headers : "Accept: application/json" }}
+	errs = append(errs, registerFilter("curl_headers", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		list, handle := splitResponseArg(in.String())
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "AUTO_SLIST struct curl_slist *%s = NULL;\n", list)
+		for _, header := range strings.Split(param.String(), "|") {
+			header = strings.TrimSpace(header)
+			if header == "" {
+				continue
+			}
+			fmt.Fprintf(&b, "%s\n", appendHeader(list, cStringLiteral(header)))
+		}
+		if handle != "" {
+			fmt.Fprintf(&b, "curl_easy_setopt(%s, CURLOPT_HTTPHEADER, %s);\n", handle, list)
+		}
+		return pongo2.AsSafeValue(strings.TrimSuffix(b.String(), "\n")), nil
+	}))
+
+	// Append "Authorization: Bearer <token>" to a header list built with
+	// curl_headers. The token is a char* expression. With "list,handle" the
+	// list is re-attached to the handle, since appending to an empty list
+	// changes its head.
+	// Example usage:
+	// {{ "api_headers" | curl_bearer : "token" }}
+	errs = append(errs, registerFilter("curl_bearer", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		list, handle := splitResponseArg(in.String())
+		token := strings.TrimSpace(param.String())
+
+		code := fmt.Sprintf(
+			`{
+    char auth_%[1]s[1024];
+    int auth_len_%[1]s = snprintf(auth_%[1]s, sizeof(auth_%[1]s), "Authorization: Bearer %%s", %[2]s);
+    if (auth_len_%[1]s < 0 || (size_t)auth_len_%[1]s >= sizeof(auth_%[1]s)) {
+        fprintf(stderr, "Bearer token for %[1]s is too long\n");
+        exit(EXIT_FAILURE);
+    }
+    %[3]s
+}`,
+			list, token, appendHeader(list, "auth_"+list))
+		if handle != "" {
+			code += fmt.Sprintf("\ncurl_easy_setopt(%s, CURLOPT_HTTPHEADER, %s);", handle, list)
+		}
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Example usage:
+	// {{ "curl" | curl_timeout : "10" }}
+	errs = append(errs, registerFilter("curl_timeout", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		handle := in.String()
+		seconds := param.String()
+		code := fmt.Sprintf(
+			`curl_easy_setopt(%[1]s, CURLOPT_CONNECTTIMEOUT, (long)(%[2]s));
+curl_easy_setopt(%[1]s, CURLOPT_TIMEOUT, (long)(%[2]s));`,
+			handle, seconds)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Example usage:
+	// {{ "curl" | curl_follow_redirects : "5" }}
+	errs = append(errs, registerFilter("curl_follow_redirects", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		handle := in.String()
+		maxRedirs := param.String()
+		code := fmt.Sprintf(
+			`curl_easy_setopt(%[1]s, CURLOPT_FOLLOWLOCATION, 1L);
+curl_easy_setopt(%[1]s, CURLOPT_MAXREDIRS, (long)(%[2]s));`,
+			handle, maxRedirs)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Lower-level building blocks for requests the http_* filters don't
+	// cover. curl_init declares an AUTO_CURL handle that is cleaned up at
+	// scope exit. Needs {{ "" | http_callback }}.
+	// Example usage:
+	// {{ "curl" | curl_init }}
+	errs = append(errs, registerFilter("curl_init", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(
+			`AUTO_CURL CURL *%[1]s = curl_easy_init();
+if (!%[1]s) {
+    fprintf(stderr, "Failed to initialize curl for %[1]s\n");
+    exit(EXIT_FAILURE);
+}`,
+			strings.TrimSpace(in.String()))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Set an option, exiting if curl rejects it. The CURLOPT_ prefix is
+	// optional and the value is a C expression, so string literals need
+	// their quotes.
+	// Example usage:
+	// {{ "curl" | curl_setopt : "URL,url" }}
+	// {{ "curl" | curl_setopt : "CURLOPT_USERAGENT,\"cccp/1.0\"" }}
+	// {{ "curl" | curl_setopt : "NOBODY,1L" }}
+	errs = append(errs, registerFilter("curl_setopt", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		handle := strings.TrimSpace(in.String())
+		option, value, ok := strings.Cut(param.String(), ",")
+		option = strings.TrimSpace(option)
+		if !ok || option == "" {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("curl_setopt needs option,value")}
+		}
+		if !strings.HasPrefix(option, "CURLOPT_") {
+			option = "CURLOPT_" + option
+		}
+		code := fmt.Sprintf(
+			`{
+    CURLcode setopt_rc = curl_easy_setopt(%[1]s, %[2]s, %[3]s);
+    if (setopt_rc != CURLE_OK) {
+        fprintf(stderr, "Failed to set %[2]s on %[1]s: %%s\n", curl_easy_strerror(setopt_rc));
+        exit(EXIT_FAILURE);
+    }
+}`,
+			handle, option, strings.TrimSpace(value))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Run the request set up on a curl_init handle, exiting on a transport
+	// error. Declares <status> (long) with the HTTP status code.
+	// Example usage:
+	// {{ "status" | curl_perform : "curl" }}
+	errs = append(errs, registerFilter("curl_perform", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		status := strings.TrimSpace(in.String())
+		handle := strings.TrimSpace(param.String())
+		if handle == "" {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("curl_perform needs a curl handle")}
+		}
+		code := fmt.Sprintf(
+			`long %[1]s = 0;
+{
+    CURLcode rc_%[1]s = curl_easy_perform(%[2]s);
+    if (rc_%[1]s != CURLE_OK) {
+        fprintf(stderr, "Request on %[2]s failed: %%s\n", curl_easy_strerror(rc_%[1]s));
+        exit(EXIT_FAILURE);
+    }
+    curl_easy_getinfo(%[2]s, CURLINFO_RESPONSE_CODE, &%[1]s);
+}`,
+			status, handle)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// GET with retries and exponential backoff. Declares <response> (char*,
+	// caller frees, NULL unless the final status is 2xx) and
+	// <response>_status. Redirects are followed (up to 10) and each attempt
+	// times out after timeout_seconds (default 30). Transport errors, 5xx and
+	// 429 are retried; other statuses are not. An optional header list can
+	// follow the response name. Needs {{ "" | http_callback }}.
+	// Example usage:
+	// {{ "repos" | http_get_with_retry : "https://api.github.com/users/octocat/repos,3,500" }}
+	// {{ "repos,api_headers" | http_get_with_retry : "$url_var,5,250,10" }}
+	errs = append(errs, registerFilter("http_get_with_retry", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		resp, headers := splitResponseArg(in.String())
+		params := strings.Split(param.String(), ",")
+		if len(params) != 3 && len(params) != 4 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("http_get_with_retry needs url,attempts,backoff_ms[,timeout_seconds]")}
+		}
+		url := quoteIfLiteral(params[0])
+		attempts := strings.TrimSpace(params[1])
+		backoff := strings.TrimSpace(params[2])
+		timeout := "30"
+		if len(params) == 4 {
+			timeout = strings.TrimSpace(params[3])
+		}
+		setHeaders := ""
+		if headers != "" {
+			setHeaders = fmt.Sprintf("    curl_easy_setopt(curl_%s, CURLOPT_HTTPHEADER, %s);\n", resp, headers)
+		}
+
+		code := fmt.Sprintf(
+			`char *%[1]s = NULL;
+long %[1]s_status = 0;
+{
+    CURL *curl_%[1]s = curl_easy_init();
+    if (!curl_%[1]s) {
+        fprintf(stderr, "Failed to initialize curl for %[1]s\n");
+        exit(EXIT_FAILURE);
+    }
+    struct http_buffer buf_%[1]s = {0};
+    curl_easy_setopt(curl_%[1]s, CURLOPT_URL, %[2]s);
+    curl_easy_setopt(curl_%[1]s, CURLOPT_WRITEFUNCTION, http_write_callback);
+    curl_easy_setopt(curl_%[1]s, CURLOPT_WRITEDATA, &buf_%[1]s);
+    curl_easy_setopt(curl_%[1]s, CURLOPT_FOLLOWLOCATION, 1L);
+    curl_easy_setopt(curl_%[1]s, CURLOPT_MAXREDIRS, 10L);
+    curl_easy_setopt(curl_%[1]s, CURLOPT_CONNECTTIMEOUT, (long)(%[5]s));
+    curl_easy_setopt(curl_%[1]s, CURLOPT_TIMEOUT, (long)(%[5]s));
+%[6]s    long delay_ms_%[1]s = (long)(%[4]s);
+    int attempts_%[1]s = (int)(%[3]s);
+    for (int attempt_%[1]s = 1; attempt_%[1]s <= attempts_%[1]s; attempt_%[1]s++) {
+        free(buf_%[1]s.data);
+        buf_%[1]s.data = NULL;
+        buf_%[1]s.size = 0;
+        %[1]s_status = 0;
+
+        CURLcode rc_%[1]s = curl_easy_perform(curl_%[1]s);
+        if (rc_%[1]s == CURLE_OK) {
+            curl_easy_getinfo(curl_%[1]s, CURLINFO_RESPONSE_CODE, &%[1]s_status);
+            if (%[1]s_status >= 200 && %[1]s_status < 300) {
+                break;
+            }
+            fprintf(stderr, "GET %%s attempt %%d/%%d returned HTTP %%ld\n", %[2]s, attempt_%[1]s, attempts_%[1]s, %[1]s_status);
+            if (%[1]s_status < 500 && %[1]s_status != 429) {
+                break;  // client errors won't succeed on retry
+            }
+        } else {
+            fprintf(stderr, "GET %%s attempt %%d/%%d failed: %%s\n", %[2]s, attempt_%[1]s, attempts_%[1]s, curl_easy_strerror(rc_%[1]s));
+        }
+
+        if (attempt_%[1]s < attempts_%[1]s) {
+            struct timespec wait_%[1]s = {delay_ms_%[1]s / 1000, (delay_ms_%[1]s %% 1000) * 1000000L};
+            while (nanosleep(&wait_%[1]s, &wait_%[1]s) == -1 && errno == EINTR) {
+            }
+            delay_ms_%[1]s *= 2;
+        }
+    }
+    if (%[1]s_status < 200 || %[1]s_status >= 300) {
+        free(buf_%[1]s.data);
+        buf_%[1]s.data = NULL;
+    }
+    %[1]s = buf_%[1]s.data;
+    curl_easy_cleanup(curl_%[1]s);
+}`,
+			resp, url, attempts, backoff, timeout, setHeaders)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Stream a GET response straight to a file instead of memory. Declares
+	// <status> (long, 0 if the request never completed). The file is removed
+	// again if the transfer fails, the status isn't 2xx, or closing it fails.
+	// The URL and path can be literals or $-marked char* variables. Needs
+	// {{ "" | http_callback }}.
+	// Example usage:
+	// {{ "download_status" | http_download : "https://example.com/big.iso,big.iso" }}
+	// {{ "download_status" | http_download : "$url,$dest_path" }}
+	errs = append(errs, registerFilter("http_download", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		status := in.String()
+		params := strings.Split(param.String(), ",")
+		if len(params) != 2 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("http_download needs url,filepath")}
+		}
+		url := quoteIfLiteral(params[0])
+		path := quoteIfLiteral(params[1])
+
+		code := fmt.Sprintf(
+			`long %[1]s = 0;
+{
+    const char *path_%[1]s = %[3]s;
+    FILE *out_%[1]s = fopen(path_%[1]s, "wb");
+    if (!out_%[1]s) {
+        fprintf(stderr, "Failed to open %%s for writing\n", path_%[1]s);
+        exit(EXIT_FAILURE);
+    }
+    int ok_%[1]s = 1;
+    {
+        // The handle is cleaned up at the end of this block, before the
+        // file is closed.
+        AUTO_CURL CURL *curl_%[1]s = curl_easy_init();
+        if (!curl_%[1]s) {
+            fprintf(stderr, "Failed to initialize curl for %[1]s\n");
+            fclose(out_%[1]s);
+            remove(path_%[1]s);
+            exit(EXIT_FAILURE);
+        }
+        // No WRITEFUNCTION: curl fwrite()s into WRITEDATA and fails the
+        // transfer on a short write.
+        curl_easy_setopt(curl_%[1]s, CURLOPT_URL, %[2]s);
+        curl_easy_setopt(curl_%[1]s, CURLOPT_WRITEDATA, out_%[1]s);
+        curl_easy_setopt(curl_%[1]s, CURLOPT_FOLLOWLOCATION, 1L);
+        CURLcode rc_%[1]s = curl_easy_perform(curl_%[1]s);
+        if (rc_%[1]s != CURLE_OK) {
+            fprintf(stderr, "Download of %%s failed: %%s\n", %[2]s, curl_easy_strerror(rc_%[1]s));
+            ok_%[1]s = 0;
+        } else {
+            curl_easy_getinfo(curl_%[1]s, CURLINFO_RESPONSE_CODE, &%[1]s);
+            if (%[1]s < 200 || %[1]s >= 300) {
+                fprintf(stderr, "Download of %%s returned HTTP %%ld\n", %[2]s, %[1]s);
+                ok_%[1]s = 0;
+            }
+        }
+    }
+    if (fclose(out_%[1]s) != 0) {
+        perror("Failed to close downloaded file");
+        ok_%[1]s = 0;
+    }
+    if (!ok_%[1]s) {
+        remove(path_%[1]s);
+    }
+}`,
+			status, url, path)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	return errors.Join(errs...)
+}
+
+// splitResponseArg splits a filter input of the form "name" or
+// "name,extra" into its two parts.
+func splitResponseArg(arg string) (string, string) {
+	name, extra, _ := strings.Cut(arg, ",")
+	return strings.TrimSpace(name), strings.TrimSpace(extra)
+}
+
+// appendHeader generates a checked curl_slist_append of header (a C string
+// expression) onto list.
+func appendHeader(list, header string) string {
+	return fmt.Sprintf(
+		`{
+    struct curl_slist *grown_%[1]s = curl_slist_append(%[1]s, %[2]s);
+    if (!grown_%[1]s) {
+        fprintf(stderr, "Failed to add header to %[1]s\n");
+        exit(EXIT_FAILURE);
+    }
+    %[1]s = grown_%[1]s;
+}`,
+		list, header)
+}
+
+// copyHeaders generates a loop appending every entry of the user's header
+// list onto the request's own list, stopping if one can't be added, or
+// nothing when there is no list.
+func copyHeaders(resp, extraHeaders string) string {
+	if extraHeaders == "" {
+		return ""
+	}
+	return fmt.Sprintf(
+		`    for (struct curl_slist *h = %[2]s; h && headers_ok_%[1]s; h = h->next) {
+        headers_ok_%[1]s = http_append_header(&headers_%[1]s, h->data);
+    }
+`,
+		resp, extraHeaders)
+}
@@ -0,0 +1,267 @@
+package generators
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// requireLibcurl skips the test unless libcurl's headers and library are
+// installed.
+func requireLibcurl(t *testing.T) {
+	t.Helper()
+	requireCC(t, "#include <curl/curl.h>\nint main(void) { curl_global_init(CURL_GLOBAL_DEFAULT); return 0; }",
+		[]string{"-lcurl"})
+}
+
+const httpProgram = `{{ "" | http_callback }}
+{{ "" | http_callback }}
+int main(int argc, char **argv) {
+    const char *url = argc > 1 ? argv[1] : "http://localhost/";
+    const char *payload = "{}";
+    {{ "page" | http_get : "https://example.com/" }}
+    {{ "other" | http_get : "$url" }}
+    {{ "reply" | http_post : "$url,application/json,$payload" }}
+    {{ "curl" | curl_init }}
+    {{ "curl" | curl_setopt : "URL,url" }}
+    {{ "curl" | curl_setopt : "NOBODY,1L" }}
+    {{ "status" | curl_perform : "curl" }}
+    printf("%ld %ld %ld %ld\n", page_status, other_status, reply_status, status);
+    free(page);
+    free(other);
+    free(reply);
+    return 0;
+}
+`
+
+func TestHTTPRender(t *testing.T) {
+	src, libs := render(t, httpProgram)
+	for _, want := range []string{
+		"#include <curl/curl.h>",
+		`curl_easy_setopt(curl_page, CURLOPT_URL, "https://example.com/");`,
+		"curl_easy_setopt(curl_other, CURLOPT_URL, url);",
+		"const char *body_reply = payload;",
+		"AUTO_CURL CURL *curl = curl_easy_init();",
+		"curl_easy_setopt(curl, CURLOPT_NOBODY, 1L);",
+		"curl_easy_perform(curl);",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("generated C lacks %s", want)
+		}
+	}
+	if count := strings.Count(src, "static size_t http_write_callback"); count != 1 {
+		t.Errorf("http_callback emitted %d times, want once", count)
+	}
+	if !slices.Equal(libs, []string{"-lcurl"}) {
+		t.Errorf("got libs %q, want -lcurl", libs)
+	}
+}
+
+func TestHTTPCompiles(t *testing.T) {
+	requireLibcurl(t)
+	src, libs := render(t, httpProgram)
+	compileC(t, src, libs)
+}
+
+func TestHTTPRetryAndDownloadCompile(t *testing.T) {
+	requireLibcurl(t)
+	src, libs := render(t, `{{ "" | http_callback }}
+int main(void) {
+    const char *url = "http://localhost/";
+    {{ "api_headers" | curl_headers : "Accept: application/json" }}
+    {{ "repos,api_headers" | http_get_with_retry : "$url,3,100,5" }}
+    {{ "download_status" | http_download : "$url,out.bin" }}
+    free(repos);
+    return repos_status == 200 && download_status == 200 ? 0 : 1;
+}
+`)
+	compileC(t, src, libs)
+}
+
+// fakeCurlHeader and fakeCurl stand in for libcurl so requests can run
+// without a network or libcurl installed. Appending the header
+// "X-Fail: oom" fails like an allocation failure, a perform prints what
+// would be sent and answers 200 with "ok", and the live handle and list
+// node counts show what was never cleaned up.
+const fakeCurlHeader = `typedef void CURL;
+typedef enum { CURLE_OK, CURLE_WRITE_ERROR } CURLcode;
+typedef enum {
+    CURLOPT_URL, CURLOPT_HTTPHEADER, CURLOPT_POSTFIELDS, CURLOPT_POSTFIELDSIZE,
+    CURLOPT_WRITEFUNCTION, CURLOPT_WRITEDATA, CURLOPT_FOLLOWLOCATION
+} CURLoption;
+typedef enum { CURLINFO_RESPONSE_CODE } CURLINFO;
+struct curl_slist {
+    char *data;
+    struct curl_slist *next;
+};
+CURL *curl_easy_init(void);
+void curl_easy_cleanup(CURL *handle);
+CURLcode curl_easy_setopt(CURL *handle, CURLoption option, ...);
+CURLcode curl_easy_perform(CURL *handle);
+CURLcode curl_easy_getinfo(CURL *handle, CURLINFO info, ...);
+const char *curl_easy_strerror(CURLcode code);
+struct curl_slist *curl_slist_append(struct curl_slist *list, const char *data);
+void curl_slist_free_all(struct curl_slist *list);
+extern int fake_curl_handles, fake_curl_nodes;
+`
+
+const fakeCurl = `
+#include <stdarg.h>
+
+int fake_curl_handles, fake_curl_nodes;
+
+struct fake_curl {
+    const char *url, *body;
+    struct curl_slist *headers;
+    size_t (*write)(char *, size_t, size_t, void *);
+    void *data;
+};
+
+CURL *curl_easy_init(void) {
+    fake_curl_handles++;
+    return calloc(1, sizeof(struct fake_curl));
+}
+
+void curl_easy_cleanup(CURL *handle) {
+    fake_curl_handles--;
+    free(handle);
+}
+
+CURLcode curl_easy_setopt(CURL *handle, CURLoption option, ...) {
+    struct fake_curl *c = handle;
+    va_list args;
+    va_start(args, option);
+    switch (option) {
+    case CURLOPT_URL: c->url = va_arg(args, const char *); break;
+    case CURLOPT_HTTPHEADER: c->headers = va_arg(args, struct curl_slist *); break;
+    case CURLOPT_POSTFIELDS: c->body = va_arg(args, const char *); break;
+    case CURLOPT_WRITEFUNCTION: c->write = va_arg(args, size_t (*)(char *, size_t, size_t, void *)); break;
+    case CURLOPT_WRITEDATA: c->data = va_arg(args, void *); break;
+    default: break;
+    }
+    va_end(args);
+    return CURLE_OK;
+}
+
+CURLcode curl_easy_perform(CURL *handle) {
+    struct fake_curl *c = handle;
+    printf("> %s %s [", c->body ? "POST" : "GET", c->url);
+    for (struct curl_slist *h = c->headers; h; h = h->next) {
+        printf("%s%s", h->data, h->next ? "|" : "");
+    }
+    printf("] %s\n", c->body ? c->body : "");
+    char reply[] = "ok";
+    if (c->write) {
+        return c->write(reply, 1, 2, c->data) == 2 ? CURLE_OK : CURLE_WRITE_ERROR;
+    }
+    return fwrite(reply, 1, 2, c->data) == 2 ? CURLE_OK : CURLE_WRITE_ERROR;
+}
+
+CURLcode curl_easy_getinfo(CURL *handle, CURLINFO info, ...) {
+    (void)handle;
+    (void)info;
+    va_list args;
+    va_start(args, info);
+    *va_arg(args, long *) = 200;
+    va_end(args);
+    return CURLE_OK;
+}
+
+const char *curl_easy_strerror(CURLcode code) {
+    return code == CURLE_OK ? "no error" : "write error";
+}
+
+struct curl_slist *curl_slist_append(struct curl_slist *list, const char *data) {
+    if (strcmp(data, "X-Fail: oom") == 0) {
+        return NULL;
+    }
+    struct curl_slist *node = malloc(sizeof(*node));
+    node->data = strdup(data);
+    node->next = NULL;
+    fake_curl_nodes++;
+    if (!list) {
+        return node;
+    }
+    struct curl_slist *last = list;
+    while (last->next) {
+        last = last->next;
+    }
+    last->next = node;
+    return list;
+}
+
+void curl_slist_free_all(struct curl_slist *list) {
+    while (list) {
+        struct curl_slist *next = list->next;
+        free(list->data);
+        free(list);
+        fake_curl_nodes--;
+        list = next;
+    }
+}
+`
+
+// renderFakeCurl renders tpl against fakeCurl and returns the program.
+func renderFakeCurl(t *testing.T, tpl string) string {
+	t.Helper()
+	include := t.TempDir()
+	if err := os.Mkdir(filepath.Join(include, "curl"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(include, "curl", "curl.h"), []byte(fakeCurlHeader), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	src, _ := render(t, tpl)
+	return compileC(t, src+fakeCurl, nil, "-I"+include, sanitize)
+}
+
+func TestHTTPPostHeaders(t *testing.T) {
+	bin := renderFakeCurl(t, `{{ "" | http_callback }}
+int main(void) {
+    const char *payload = "{}";
+    {
+        {{ "api_headers" | curl_headers : "Accept: application/json|X-Client: cccp" }}
+        {{ "reply,api_headers" | http_post : "http://fake/api,application/json,$payload" }}
+        printf("%s %ld\n", reply, reply_status);
+        free(reply);
+
+        struct curl_slist oom = {(char *)"X-Fail: oom", NULL};
+        struct curl_slist extra = {(char *)"X-Before: 1", &oom};
+        {{ "failed,&extra" | http_post : "http://fake/api,text/plain,hello" }}
+        printf("%d %ld\n", failed == NULL, failed_status);
+    }
+    printf("live %d %d\n", fake_curl_handles, fake_curl_nodes);
+    return 0;
+}
+`)
+	stdout, stderr, code := runC(t, bin, "")
+	if code != 0 {
+		t.Fatalf("program exited %d: %s", code, stderr)
+	}
+	wantOut := "> POST http://fake/api [Content-Type: application/json|Accept: application/json|X-Client: cccp] {}\n" +
+		"ok 200\n1 0\nlive 0 0\n"
+	wantErr := "POST http://fake/api failed: out of memory building headers\n"
+	if stdout != wantOut || stderr != wantErr {
+		t.Errorf("got stdout\n%s\nstderr\n%s\nwant stdout\n%s\nstderr\n%s", stdout, stderr, wantOut, wantErr)
+	}
+}
+
+func TestHTTPDownloadCleansUpHandle(t *testing.T) {
+	bin := renderFakeCurl(t, `{{ "" | http_callback }}
+int main(void) {
+    {{ "download_status" | http_download : "http://fake/file,out.bin" }}
+    printf("%ld live %d\n", download_status, fake_curl_handles);
+    return 0;
+}
+`)
+	dir := t.TempDir()
+	stdout, stderr, code := runC(t, bin, dir)
+	if code != 0 || stdout != "> GET http://fake/file [] \n200 live 0\n" {
+		t.Errorf("got exit %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "out.bin")); err != nil || string(data) != "ok" {
+		t.Errorf("downloaded file holds %q, %v; want ok", data, err)
+	}
+}
@@ -0,0 +1,164 @@
+package generators
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func init() {
+	Register(InitJSONFilters)
+}
+
+// The json_* filters generate code against the cJSON API. Link with -lcjson.
+// Key paths are dot-separated; numeric segments index into arrays, so
+// "items.0.name" is root["items"][0]["name"]. Strings returned by the
+// getters point into the parsed tree and are valid until json_free.
+func InitJSONFilters() error {
+	var errs []error
+
+	// Example usage:
+	// {{ "root" | json_parse : "response" }}
+	errs = append(errs, registerFilter("json_parse", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		root := in.String()
+		src := param.String()
+		code := fmt.Sprintf(
+			`cJSON *%[1]s = cJSON_Parse(%[2]s);
+if (!%[1]s) {
+    const char *json_err_%[1]s = cJSON_GetErrorPtr();
+    fprintf(stderr, "Failed to parse JSON in %[2]s near: %%.20s\n", json_err_%[1]s ? json_err_%[1]s : "(unknown)");
+    exit(EXIT_FAILURE);
+}`,
+			root, src)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Example usage:
+	// {{ "login" | json_get_string : "root,owner.login" }}
+	errs = append(errs, registerFilter("json_get_string", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return jsonGetter("json_get_string", "const char *", "NULL", "cJSON_IsString", "string", "valuestring", in, param)
+	}))
+
+	// Example usage:
+	// {{ "stars" | json_get_int : "root,stargazers_count" }}
+	errs = append(errs, registerFilter("json_get_int", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return jsonGetter("json_get_int", "int ", "0", "cJSON_IsNumber", "number", "valueint", in, param)
+	}))
+
+	// Example usage:
+	// {{ "item_count" | json_get_array_len : "root,items" }}
+	errs = append(errs, registerFilter("json_get_array_len", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		out := in.String()
+		root, path, err := jsonPathArgs("json_get_array_len", param)
+		if err != nil {
+			return nil, err
+		}
+		code := fmt.Sprintf(
+			`int %[1]s = 0;
+{
+%[2]s
+    %[1]s = cJSON_GetArraySize(node_%[1]s);
+}`,
+			out, jsonLookup("node_"+out, root, path, "cJSON_IsArray", "array"))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Loop over an array; close the loop with json_array_end.
+	// Example usage:
+	// {{ "repo" | json_array_foreach : "root,items" }}
+	//     {{ "name" | json_get_string : "repo,name" }}
+	//     printf("%s\n", name);
+	// {{ "" | json_array_end }}
+	errs = append(errs, registerFilter("json_array_foreach", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		item := in.String()
+		root, path, err := jsonPathArgs("json_array_foreach", param)
+		if err != nil {
+			return nil, err
+		}
+		code := fmt.Sprintf(
+			`{
+%[2]s
+    const cJSON *%[1]s = NULL;
+    cJSON_ArrayForEach(%[1]s, array_%[1]s) {`,
+			item, jsonLookup("array_"+item, root, path, "cJSON_IsArray", "array"))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Example usage:
+	// {{ "" | json_array_end }}
+	errs = append(errs, registerFilter("json_array_end", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return pongo2.AsSafeValue("    }\n}"), nil
+	}))
+
+	// Example usage:
+	// {{ "root" | json_free }}
+	errs = append(errs, registerFilter("json_free", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		root := in.String()
+		code := fmt.Sprintf(
+			`cJSON_Delete(%[1]s);
+%[1]s = NULL;`,
+			root)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	return errors.Join(errs...)
+}
+
+func jsonPathArgs(filter string, param *pongo2.Value) (string, string, *pongo2.Error) {
+	parts := strings.Split(param.String(), ",")
+	if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+		return "", "", &pongo2.Error{OrigError: fmt.Errorf("%s needs root,key.path", filter)}
+	}
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), nil
+}
+
+func jsonGetter(filter, cType, zero, check, kind, field string, in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	out := in.String()
+	root, path, err := jsonPathArgs(filter, param)
+	if err != nil {
+		return nil, err
+	}
+	code := fmt.Sprintf(
+		`%[2]s%[1]s = %[3]s;
+{
+%[4]s
+    %[1]s = node_%[1]s->%[5]s;
+}`,
+		out, cType, zero, jsonLookup("node_"+out, root, path, check, kind), field)
+	return pongo2.AsSafeValue(code), nil
+}
+
+// jsonLookup generates (indented for a block body) the declaration of node
+// as the element at path under root, exiting with a message naming the
+// missing key or the type mismatch.
+func jsonLookup(node, root, path, check, kind string) string {
+	var b strings.Builder
+	quotedPath := cStringLiteral(path)
+	fmt.Fprintf(&b, "    const cJSON *%s = %s;\n", node, root)
+
+	for _, segment := range strings.Split(path, ".") {
+		if index, err := strconv.Atoi(segment); err == nil {
+			fmt.Fprintf(&b, "    %s = cJSON_GetArrayItem(%s, %d);\n", node, node, index)
+		} else {
+			fmt.Fprintf(&b, "    %s = cJSON_GetObjectItemCaseSensitive(%s, %s);\n", node, node, cStringLiteral(segment))
+		}
+		fmt.Fprintf(&b,
+			`    if (!%[1]s) {
+        fprintf(stderr, "JSON key %%s not found (missing %%s)\n", %[2]s, %[3]s);
+        exit(EXIT_FAILURE);
+    }
+`,
+			node, quotedPath, cStringLiteral(segment))
+	}
+
+	fmt.Fprintf(&b,
+		`    if (!%[1]s(%[2]s)) {
+        fprintf(stderr, "JSON key %%s is not a %[4]s\n", %[3]s);
+        exit(EXIT_FAILURE);
+    }`,
+		check, node, quotedPath, kind)
+	return b.String()
+}
@@ -0,0 +1,181 @@
+package generators
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func init() {
+	Register(InitListFilters)
+}
+
+// Singly linked lists. list_create, at file scope, declares a list
+// instance named after its input plus the <name>_node, <name>_list and
+// <name>_value types and static inline <name>_* functions. The other
+// list_* filters work on a list by name. With the element type "rcstr"
+// (see generate_rcstring) the list owns one reference per element, dropped
+// by list_remove_if and list_free.
+func InitListFilters() error {
+	var errs []error
+
+	// Example usage:
+	// {{ "names" | list_create : "char *" }}
+	// {{ "tags" | list_create : "rcstr" }}
+	errs = append(errs, registerFilter("list_create", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		elemType := strings.TrimSpace(param.String())
+		if elemType == "" {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("list_create needs an element type")}
+		}
+
+		elemType, release := containerRelease(elemType)
+		code := fmt.Sprintf(
+			`typedef %[2]s %[1]s_value;
+
+static inline void %[1]s_release(%[1]s_value value) {
+    %[3]s
+}
+
+typedef struct %[1]s_node {
+    %[1]s_value value;
+    struct %[1]s_node *next;
+} %[1]s_node;
+
+typedef struct {
+    %[1]s_node *head;
+    %[1]s_node *tail;
+    size_t length;
+} %[1]s_list;
+
+static %[1]s_list %[1]s;
+
+static inline %[1]s_node *%[1]s_new_node(%[1]s_value value) {
+    %[1]s_node *node = malloc(sizeof(*node));
+    if (!node) {
+        fprintf(stderr, "Failed to get memory for list %[1]s\n");
+        exit(EXIT_FAILURE);
+    }
+    node->value = value;
+    node->next = NULL;
+    return node;
+}
+
+static inline void %[1]s_append(%[1]s_list *l, %[1]s_value value) {
+    %[1]s_node *node = %[1]s_new_node(value);
+    if (l->tail) {
+        l->tail->next = node;
+    } else {
+        l->head = node;
+    }
+    l->tail = node;
+    l->length++;
+}
+
+static inline void %[1]s_prepend(%[1]s_list *l, %[1]s_value value) {
+    %[1]s_node *node = %[1]s_new_node(value);
+    node->next = l->head;
+    l->head = node;
+    if (!l->tail) {
+        l->tail = node;
+    }
+    l->length++;
+}`,
+			in.String(), elemType, release)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Example usage:
+	// {{ "names" | list_append : "strdup(line)" }}
+	errs = append(errs, registerFilter("list_append", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(`%[1]s_append(&%[1]s, %[2]s);`, in.String(), param.String())
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Example usage:
+	// {{ "names" | list_prepend : "\"first\"" }}
+	errs = append(errs, registerFilter("list_prepend", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(`%[1]s_prepend(&%[1]s, %[2]s);`, in.String(), param.String())
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Loop over the elements in order; close with list_foreach_end. Don't
+	// add or remove elements while iterating.
+	// Example usage:
+	// {{ "names" | list_foreach : "name" }}
+	//     puts(name);
+	// {{ "names" | list_foreach_end }}
+	errs = append(errs, registerFilter("list_foreach", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(
+			`for (%[1]s_node *%[1]s_it = %[1]s.head; %[1]s_it; %[1]s_it = %[1]s_it->next) {
+    %[1]s_value %[2]s = %[1]s_it->value;
+    {`,
+			in.String(), strings.TrimSpace(param.String()))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Example usage:
+	// {{ "names" | list_foreach_end }}
+	errs = append(errs, registerFilter("list_foreach_end", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return pongo2.AsSafeValue("    }\n}"), nil
+	}))
+
+	// Remove every element for which the predicate, a C expression over a
+	// variable named item, is true. Removed elements themselves are not
+	// freed, except that rcstr elements are unref'd.
+	// Example usage:
+	// {{ "names" | list_remove_if : "strncmp(item, \"tmp\", 3) == 0" }}
+	errs = append(errs, registerFilter("list_remove_if", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(
+			`{
+    %[1]s_node **%[1]s_link = &%[1]s.head;
+    %[1]s.tail = NULL;
+    while (*%[1]s_link) {
+        %[1]s_node *%[1]s_cur = *%[1]s_link;
+        %[1]s_value item = %[1]s_cur->value;
+        (void)item;
+        if (%[2]s) {
+            *%[1]s_link = %[1]s_cur->next;
+            %[1]s_release(item);
+            free(%[1]s_cur);
+            %[1]s.length--;
+        } else {
+            %[1]s.tail = %[1]s_cur;
+            %[1]s_link = &%[1]s_cur->next;
+        }
+    }
+}`,
+			in.String(), param.String())
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Free every node, running the optional destructor (a C expression
+	// over item) on each element first; rcstr elements are unref'd when
+	// there is none. The list is empty and reusable after.
+	// Example usage:
+	// {{ "names" | list_free }}
+	// {{ "names" | list_free : "free(item)" }}
+	errs = append(errs, registerFilter("list_free", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		destroy := fmt.Sprintf("\n        %[1]s_release(%[1]s_cur->value);", in.String())
+		if d := strings.TrimSpace(param.String()); d != "" {
+			destroy = fmt.Sprintf("\n        %[1]s_value item = %[1]s_cur->value;\n        %[2]s;", in.String(), d)
+		}
+		code := fmt.Sprintf(
+			`{
+    %[1]s_node *%[1]s_cur = %[1]s.head;
+    while (%[1]s_cur) {
+        %[1]s_node *%[1]s_next = %[1]s_cur->next;%[2]s
+        free(%[1]s_cur);
+        %[1]s_cur = %[1]s_next;
+    }
+    %[1]s.head = NULL;
+    %[1]s.tail = NULL;
+    %[1]s.length = 0;
+}`,
+			in.String(), destroy)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,46 @@
+package generators
+
+import "testing"
+
+func TestLinkedList(t *testing.T) {
+	out := renderAndRun(t, `{{ "" | generate_rcstring }}
+{{ "nums" | list_create : "int" }}
+{{ "names" | list_create : "char *" }}
+{{ "tags" | list_create : "rcstr" }}
+int main(void) {
+    for (int i = 1; i <= 6; i++) {
+        {{ "nums" | list_append : "i" }}
+    }
+    {{ "nums" | list_prepend : "0" }}
+    {{ "nums" | list_remove_if : "item % 2 == 0" }}
+    {{ "nums" | list_append : "7" }}
+    {{ "nums" | list_foreach : "n" }}
+        printf("%d ", n);
+    {{ "nums" | list_foreach_end }}
+    printf("(%zu)\n", nums.length);
+    {{ "nums" | list_free }}
+    printf("%zu %d\n", nums.length, nums.head == NULL && nums.tail == NULL);
+
+    {{ "names" | list_append : "strdup(\"tmp1\")" }}
+    {{ "names" | list_append : "strdup(\"keep\")" }}
+    {{ "names" | list_prepend : "strdup(\"first\")" }}
+    {{ "names" | list_foreach : "name" }}
+        printf("%s ", name);
+    {{ "names" | list_foreach_end }}
+    printf("\n");
+    {{ "names" | list_free : "free(item)" }}
+
+    {{ "tag" | rcstr_new : "shared" }}
+    {{ "tags" | list_append : "rcstr_ref(tag)" }}
+    {{ "tags" | list_append : "rcstr_ref(tag)" }}
+    {{ "tags" | list_remove_if : "item == tag" }}
+    printf("%zu %zu\n", tags.length, tag->refs);
+    {{ "tag" | rcstr_unref }}
+    return 0;
+}
+`, sanitize)
+	want := "1 3 5 7 (4)\n0 1\nfirst tmp1 keep \n0 1\n"
+	if out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+}
@@ -0,0 +1,110 @@
+package generators
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func init() {
+	Register(InitLockFilters)
+}
+
+func InitLockFilters() error {
+	var errs []error
+
+	// Open (creating if needed) and exclusively flock a file, waiting for
+	// other holders. Declares the fd; release it with release_file_lock.
+	// Example usage:
+	// {{ "lock_fd" | with_file_lock : "/tmp/app.lock" }}
+	// ...
+	// {{ "lock_fd" | release_file_lock }}
+	errs = append(errs, registerFilter("with_file_lock", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(
+			`int %[1]s = -1;
+{
+    const char *lock_path_%[1]s = %[2]s;
+%[3]s
+}`,
+			in.String(), quoteIfLiteral(param.String()), lockOpen(in.String(), "lock_path_"+in.String(), "O_CREAT | O_RDWR"))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Example usage:
+	// {{ "lock_fd" | release_file_lock }}
+	errs = append(errs, registerFilter("release_file_lock", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(
+			`if (%[1]s != -1) {
+    flock(%[1]s, LOCK_UN);
+    close(%[1]s);
+    %[1]s = -1;
+}`,
+			in.String())
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Append line plus a newline to a file under an exclusive lock, so
+	// cooperating processes never interleave lines. The lock is released
+	// and the file closed even when the write fails.
+	// Example usage:
+	// {{ "app.log" | append_line_locked : "message" }}
+	errs = append(errs, registerFilter("append_line_locked", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(
+			`{
+    const char *append_path = %[1]s;
+    const char *append_line = %[2]s;
+    int append_fd = -1;
+%[3]s
+    size_t append_len = strlen(append_line);
+    int append_ok = lseek(append_fd, 0, SEEK_END) != -1;
+    for (int part = 0; append_ok && part < 2; part++) {
+        const char *buf = part == 0 ? append_line : "\n";
+        size_t len = part == 0 ? append_len : 1;
+        while (len > 0) {
+            ssize_t n = write(append_fd, buf, len);
+            if (n == -1) {
+                if (errno == EINTR) {
+                    continue;
+                }
+                append_ok = 0;
+                break;
+            }
+            buf += n;
+            len -= (size_t)n;
+        }
+    }
+    int append_err = errno;
+    flock(append_fd, LOCK_UN);
+    close(append_fd);
+    if (!append_ok) {
+        fprintf(stderr, "Failed to append to %%s: %%s\n", append_path, strerror(append_err));
+        exit(EXIT_FAILURE);
+    }
+}`,
+			quoteIfLiteral(in.String()), param.String(), lockOpen("append_fd", "append_path", "O_CREAT | O_WRONLY | O_APPEND"))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	return errors.Join(errs...)
+}
+
+// lockOpen opens path into fd and takes an exclusive flock, retrying on
+// EINTR and exiting with the strerror text on failure.
+func lockOpen(fd, path, flags string) string {
+	return fmt.Sprintf(
+		`    // flock is advisory: it only keeps out processes that also lock.
+    %[1]s = open(%[2]s, %[3]s, 0644);
+    if (%[1]s == -1) {
+        fprintf(stderr, "Failed to open %%s for locking: %%s\n", %[2]s, strerror(errno));
+        exit(EXIT_FAILURE);
+    }
+    while (flock(%[1]s, LOCK_EX) == -1) {
+        if (errno != EINTR) {
+            fprintf(stderr, "Failed to lock %%s: %%s\n", %[2]s, strerror(errno));
+            close(%[1]s);
+            exit(EXIT_FAILURE);
+        }
+    }`,
+		fd, path, flags)
+}
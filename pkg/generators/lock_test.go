@@ -0,0 +1,106 @@
+package generators
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func TestFileLockExcludesOtherProcesses(t *testing.T) {
+	out := renderAndRunIn(t, t.TempDir(), `#include <sys/wait.h>
+int main(void) {
+    int locked[2], release[2];
+    if (pipe(locked) == -1 || pipe(release) == -1) {
+        return 2;
+    }
+    pid_t pid = fork();
+    if (pid == 0) {
+        {{ "child_fd" | with_file_lock : "app.lock" }}
+        char c = 'L';
+        if (write(locked[1], &c, 1) != 1 || read(release[0], &c, 1) != 1) {
+            _exit(2);
+        }
+        {{ "child_fd" | release_file_lock }}
+        _exit(child_fd == -1 ? 0 : 3);
+    }
+
+    char c;
+    if (read(locked[0], &c, 1) != 1) {
+        return 2;
+    }
+    int try_fd = open("app.lock", O_RDWR);
+    int rc = flock(try_fd, LOCK_EX | LOCK_NB);
+    printf("while held: %d %d\n", rc, rc == -1 && errno == EWOULDBLOCK);
+    close(try_fd);
+
+    if (write(release[1], &c, 1) != 1) {
+        return 2;
+    }
+    int status;
+    waitpid(pid, &status, 0);
+    printf("child: %d\n", WIFEXITED(status) ? WEXITSTATUS(status) : -1);
+
+    {{ "lock_fd" | with_file_lock : "app.lock" }}
+    printf("after release: %d\n", lock_fd != -1);
+    {{ "lock_fd" | release_file_lock }}
+    return 0;
+}
+`, sanitize)
+	if want := "while held: -1 1\nchild: 0\nafter release: 1\n"; out != want {
+		t.Errorf("got\n%s\nwant\n%s", out, want)
+	}
+}
+
+func TestAppendLineLockedDoesNotInterleave(t *testing.T) {
+	const writers, lines, width = 4, 300, 5000
+	dir := t.TempDir()
+	src, libs := renderContext(t, `#include <sys/wait.h>
+int main(void) {
+    for (int w = 0; w < {{ writers }}; w++) {
+        if (fork() == 0) {
+            char *line = malloc({{ width }} + 1);
+            memset(line, 'a' + w, {{ width }});
+            line[{{ width }}] = '\0';
+            for (int i = 0; i < {{ lines }}; i++) {
+                {{ "log.txt" | append_line_locked : "line" }}
+            }
+            free(line);
+            _exit(0);
+        }
+    }
+    int status, failed = 0;
+    while (wait(&status) > 0) {
+        failed |= !WIFEXITED(status) || WEXITSTATUS(status) != 0;
+    }
+    return failed;
+}
+`, pongo2.Context{"writers": writers, "lines": lines, "width": width})
+	bin := compileC(t, src, libs, sanitize)
+	if _, stderr, code := runC(t, bin, dir); code != 0 {
+		t.Fatalf("program exited %d: %s", code, stderr)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "log.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(got) != writers*lines {
+		t.Fatalf("got %d lines, want %d", len(got), writers*lines)
+	}
+	counts := map[byte]int{}
+	for i, line := range got {
+		if len(line) != width || strings.Count(line, line[:1]) != width {
+			t.Fatalf("line %d is interleaved: %d bytes starting %q", i+1, len(line), line[:min(len(line), 20)])
+		}
+		counts[line[0]]++
+	}
+	for w := range writers {
+		if c := counts[byte('a'+w)]; c != lines {
+			t.Errorf("writer %c wrote %d lines, want %d", 'a'+w, c, lines)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package generators
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func init() {
+	Register(InitLoggingFilters)
+}
+
+var logLevels = []string{"DEBUG", "INFO", "WARN", "ERROR"}
+
+func InitLoggingFilters() error {
+	var errs []error
+
+	// Leveled logging, include once at file scope. The input is the default
+	// level (INFO when empty). Messages below log_level are dropped; call
+	// log_init() at startup to read LOG_LEVEL (a level name or 0-3) from
+	// the environment. Output goes to stderr, with the level colored when
+	// it's a terminal, unless log_to_file(path) redirects it. Don't combine
+	// with <syslog.h>, which defines LOG_DEBUG and LOG_INFO too.
+	// Example usage:
+	// {{ "WARN" | generate_logging }}
+	// Then in code:
+	// log_init();
+	// LOG_INFO("listening on port %d", port);
+	// LOG_ERROR("failed to open %s", path);
+	errs = append(errs, registerFilter("generate_logging", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		level := strings.ToUpper(strings.TrimSpace(in.String()))
+		if level == "" {
+			level = "INFO"
+		}
+		found := false
+		for _, l := range logLevels {
+			found = found || l == level
+		}
+		if !found {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("generate_logging level must be one of %s, got %q", strings.Join(logLevels, ", "), level)}
+		}
+
+		code := fmt.Sprintf(
+			`enum { LOG_LEVEL_DEBUG, LOG_LEVEL_INFO, LOG_LEVEL_WARN, LOG_LEVEL_ERROR };
+
+static int log_level = LOG_LEVEL_%[1]s;
+static FILE *log_stream = NULL;
+static int log_color = -1;
+
+static void log_init(void) {
+    static const char *names[] = {"DEBUG", "INFO", "WARN", "ERROR"};
+    const char *env = getenv("LOG_LEVEL");
+    if (env && *env) {
+        for (int i = 0; i < 4; i++) {
+            if (strcasecmp(env, names[i]) == 0 || (env[0] == '0' + i && env[1] == '\0')) {
+                log_level = i;
+            }
+        }
+    }
+    log_color = isatty(fileno(stderr));
+}
+
+static void log_to_file(const char *path) {
+    FILE *fp = fopen(path, "a");
+    if (!fp) {
+        fprintf(stderr, "Failed to open log file: %%s\n", path);
+        exit(EXIT_FAILURE);
+    }
+    setvbuf(fp, NULL, _IOLBF, 0);
+    if (log_stream) {
+        fclose(log_stream);
+    }
+    log_stream = fp;
+    log_color = 0;
+}
+
+#if defined(__GNUC__) || defined(__clang__)
+__attribute__((format(printf, 4, 5)))
+#endif
+static void log_write(int level, const char *file, int line, const char *fmt, ...) {
+    static const char *names[] = {"DEBUG", "INFO", "WARN", "ERROR"};
+    static const char *colors[] = {"\033[36m", "\033[32m", "\033[33m", "\033[31m"};
+    if (level < log_level) {
+        return;
+    }
+    FILE *out = log_stream ? log_stream : stderr;
+    if (log_color == -1) {
+        log_color = isatty(fileno(stderr));
+    }
+
+    char stamp[32] = "";
+    time_t now = time(NULL);
+    struct tm tm;
+    if (localtime_r(&now, &tm)) {
+        strftime(stamp, sizeof(stamp), "%%Y-%%m-%%dT%%H:%%M:%%S%%z", &tm);
+    }
+    if (log_color && out == stderr) {
+        fprintf(out, "%%s %%s%%-5s\033[0m %%s:%%d: ", stamp, colors[level], names[level], file, line);
+    } else {
+        fprintf(out, "%%s %%-5s %%s:%%d: ", stamp, names[level], file, line);
+    }
+    va_list args;
+    va_start(args, fmt);
+    vfprintf(out, fmt, args);
+    va_end(args);
+    fputc('\n', out);
+}
+
+#define LOG_DEBUG(...) log_write(LOG_LEVEL_DEBUG, __FILE__, __LINE__, __VA_ARGS__)
+#define LOG_INFO(...) log_write(LOG_LEVEL_INFO, __FILE__, __LINE__, __VA_ARGS__)
+#define LOG_WARN(...) log_write(LOG_LEVEL_WARN, __FILE__, __LINE__, __VA_ARGS__)
+#define LOG_ERROR(...) log_write(LOG_LEVEL_ERROR, __FILE__, __LINE__, __VA_ARGS__)`,
+			level)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,100 @@
+package generators
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const loggingTemplate = `{{ "WARN" | generate_logging }}
+int main(int argc, char **argv) {
+    log_init();
+    LOG_DEBUG("debug %d", 1);
+    LOG_INFO("info %s", "two");
+    LOG_WARN("warn %zu", sizeof(int));
+    LOG_ERROR("error %s=%ld", "code", 42L);
+    if (argc > 1) {
+        log_to_file(argv[1]);
+        LOG_ERROR("to file %c", 'x');
+    }
+    return 0;
+}
+`
+
+func TestLoggingFormatChecks(t *testing.T) {
+	src, libs := render(t, loggingTemplate)
+	compileC(t, src, libs, "-Wall", "-Wextra", "-Wformat", "-Werror=format", "-Werror")
+
+	// The format attribute on log_write makes a mismatched argument a
+	// compile error rather than a crash at run time.
+	bad, _ := render(t, `{{ "" | generate_logging }}
+int main(void) {
+    LOG_INFO("%d", "not an int");
+    return 0;
+}
+`)
+	cmd := exec.Command(lookupCC(t), "-Wall", "-Wformat", "-Werror=format", "-fsyntax-only", "-x", "c", "-")
+	cmd.Stdin = strings.NewReader(bad)
+	out, err := cmd.CombinedOutput()
+	if err == nil || !strings.Contains(string(out), "-Werror=format") {
+		t.Errorf("mismatched LOG_INFO argument compiled: %v\n%s", err, out)
+	}
+}
+
+func TestLoggingLevels(t *testing.T) {
+	src, libs := render(t, loggingTemplate)
+	bin := compileC(t, src, libs, sanitize)
+	line := regexp.MustCompile(`^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d[+-]\d{4} (DEBUG|INFO |WARN |ERROR) \S*/main\.c:\d+: (.*)$`)
+	messages := func(t *testing.T, out string) []string {
+		t.Helper()
+		var got []string
+		for _, l := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+			m := line.FindStringSubmatch(l)
+			if m == nil {
+				t.Fatalf("malformed log line %q", l)
+			}
+			got = append(got, strings.TrimSpace(m[1])+" "+m[2])
+		}
+		return got
+	}
+
+	tests := []struct {
+		level string
+		want  []string
+	}{
+		{"", []string{"WARN warn 4", "ERROR error code=42"}},
+		{"debug", []string{"DEBUG debug 1", "INFO info two", "WARN warn 4", "ERROR error code=42"}},
+		{"1", []string{"INFO info two", "WARN warn 4", "ERROR error code=42"}},
+		{"ERROR", []string{"ERROR error code=42"}},
+	}
+	for _, tt := range tests {
+		t.Run("LOG_LEVEL="+tt.level, func(t *testing.T) {
+			t.Setenv("LOG_LEVEL", tt.level)
+			_, stderr, code := runC(t, bin, "")
+			if code != 0 {
+				t.Fatalf("program exited %d: %s", code, stderr)
+			}
+			if got := messages(t, stderr); strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("log_to_file", func(t *testing.T) {
+		t.Setenv("LOG_LEVEL", "")
+		path := filepath.Join(t.TempDir(), "app.log")
+		if _, stderr, code := runC(t, bin, "", path); code != 0 {
+			t.Fatalf("program exited %d: %s", code, stderr)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := messages(t, string(data)); len(got) != 1 || got[0] != "ERROR to file x" {
+			t.Errorf("log file holds %q", got)
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package generators
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
@@ -11,7 +12,9 @@ func init() {
 	Register(InitMemoryFilters)
 }
 
-func InitMemoryFilters() {
+func InitMemoryFilters() error {
+	var errs []error
+
 	// Example usage:
 	// {{ "" | auto_free_generic }}  // Include once at top of file
 	//
@@ -19,7 +22,7 @@ func InitMemoryFilters() {
 	// AUTO_FREE char* buffer = malloc(100);  // Automatically freed!
 	//
 	// Note: Only works on GCC/Clang, falls back to no-op on other compilers
-	pongo2.RegisterFilter("auto_free_generic", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	errs = append(errs, registerFilter("auto_free_generic", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
 		code := `#if defined(__GNUC__) || defined(__clang__)
 #define AUTO_FREE __attribute__((cleanup(auto_free_generic)))
 #else
@@ -30,12 +33,12 @@ static void auto_free_generic(void *p) {
     free(*(void**)p); 
 }`
 		return pongo2.AsSafeValue(code), nil
-	})
+	}))
 
 	// Generates safe malloc with error checking
 	// Example usage:
 	// {{ "buffer" | get_memory : "1024" }}
-	pongo2.RegisterFilter("get_memory", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	errs = append(errs, registerFilter("get_memory", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
 		dest := in.String()
 		size := param.String()
 		code := fmt.Sprintf(
@@ -46,7 +49,7 @@ if (!%[1]s) {
 }`,
 			dest, size)
 		return pongo2.AsSafeValue(code), nil
-	})
+	}))
 
 	// Extend your AUTO_FREE to handle files, DIR*, etc
 	// {{ "" | generate_auto_cleanup }}
@@ -54,7 +57,7 @@ if (!%[1]s) {
 	// AUTO_FREE char *buffer = malloc(100);
 	// AUTO_FILE FILE *logfile = fopen("log.txt", "w");
 	// AUTO_DIR DIR *dir = opendir("/path");
-	pongo2.RegisterFilter("generate_auto_cleanup", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	errs = append(errs, registerFilter("generate_auto_cleanup", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
 		code := `#include <stdlib.h>  // for free
 #include <stdio.h>   // for FILE, fclose  
 #include <dirent.h>  // for DIR, closedir
@@ -79,10 +82,10 @@ static void auto_close_dir(void *p) { if (*(DIR**)p) closedir(*(DIR**)p); }
 #endif`
 
 		return pongo2.AsSafeValue(code), nil
-	})
+	}))
 	// Example usage:
 	// {{ "playlist[track_count]" | copy_string : "\"../\"" }}
-	pongo2.RegisterFilter("copy_string", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	errs = append(errs, registerFilter("copy_string", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
 		dest := in.String()
 		src := param.String()
 
@@ -91,7 +94,7 @@ static void auto_close_dir(void *p) { if (*(DIR**)p) closedir(*(DIR**)p); }
 %[1]s[sizeof(%[1]s) - 1] = '\0';`,
 			dest, src)
 		return pongo2.AsSafeValue(code), nil
-	})
+	}))
 
 	// Example usage:
 	// struct Config *config;
@@ -101,7 +104,7 @@ static void auto_close_dir(void *p) { if (*(DIR**)p) closedir(*(DIR**)p); }
 	// char *buffer;
 	// {{ "buffer" | get_zeroed_memory : "1024" }}
 	// buffer is now all zeros instead of uninitialized
-	pongo2.RegisterFilter("get_zeroed_memory", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	errs = append(errs, registerFilter("get_zeroed_memory", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
 		dest := in.String()
 		size := param.String()
 
@@ -113,11 +116,11 @@ if (!%[1]s) {
 }`,
 			dest, size)
 		return pongo2.AsSafeValue(code), nil
-	})
+	}))
 
 	// Example usage:
 	// {{ "playlist" | auto_cleanup_array : "track_count" }}
-	pongo2.RegisterFilter("auto_cleanup_array", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	errs = append(errs, registerFilter("auto_cleanup_array", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
 		arrayVar := in.String()
 		countVar := param.String()
 
@@ -131,7 +134,7 @@ if (!%[1]s) {
 %[2]s = 0;`,
 			arrayVar, countVar)
 		return pongo2.AsSafeValue(code), nil
-	})
+	}))
 
 	// Example usage:
 	// FILE* config = load_config();
@@ -139,7 +142,7 @@ if (!%[1]s) {
 	// char* input = get_user_input();
 	// {{ "input" | check_null : "user input" }}
 	// {{ "buffer" | check_null : "buffer validation" }}
-	pongo2.RegisterFilter("check_null", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	errs = append(errs, registerFilter("check_null", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
 		ptr := in.String()
 		context := param.String()
 		code := fmt.Sprintf(
@@ -147,9 +150,9 @@ if (!%[1]s) {
     fprintf(stderr, "NULL pointer in %%s: %[2]s\n", __func__); 
     exit(EXIT_FAILURE); 
 }`,
-			ptr, context)
+			ptr, cFormatEscape(context))
 		return pongo2.AsSafeValue(code), nil
-	})
+	}))
 
 	// Example usage:
 	// int fd = {{ "open(\"data.txt\", O_RDONLY)" | check_syscall : "file opening" }};
@@ -158,7 +161,7 @@ if (!%[1]s) {
 	// int sockfd = {{ "socket(AF_INET, SOCK_STREAM, 0)" | check_syscall : "socket creation" }};
 	// Process operations
 	// {{ "fork()" | check_syscall : "process forking" }}
-	pongo2.RegisterFilter("check_syscall", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	errs = append(errs, registerFilter("check_syscall", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
 		call := in.String()
 		context := param.String()
 		code := fmt.Sprintf(
@@ -166,64 +169,61 @@ if (!%[1]s) {
     perror("System call failed in %[2]s"); 
     exit(EXIT_FAILURE); 
 }`,
-			call, context)
+			call, cEscape(context))
 		return pongo2.AsSafeValue(code), nil
-	})
+	}))
 
 	// Example usage:
 	// for (int i = 0; i < count; i++) {
 	//      {{ "i,array_size" | check_bounds }}
 	//      process_item(array[i]);
 	// }
-	pongo2.RegisterFilter("check_bounds", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
-		parts := strings.Split(in.String(), ",")
-		if len(parts) != 2 {
-			return nil, &pongo2.Error{OrigError: fmt.Errorf("check_bounds needs index,size")}
-		}
-		index, size := parts[0], parts[1]
-		code := fmt.Sprintf(
-			`if (%[1]s >= %[2]s) { 
-    fprintf(stderr, "Index %%zu out of bounds (size: %%zu) in %%s\n", (size_t)%[1]s, (size_t)%[2]s, __func__); 
-    exit(EXIT_FAILURE); 
-}`,
-			index, size)
-		return pongo2.AsSafeValue(code), nil
-	})
+	errs = append(errs, registerFilter("check_bounds", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code, err := checkBounds(strings.Split(in.String(), ","))
+		return filterCode("check_bounds", code, err)
+	}))
+	// {% cgen check_bounds "lookup(table, key)" "table_len" %}
+	errs = append(errs, registerCgen("check_bounds", checkBounds))
 
+	// Exit unless min <= value <= max. Values are compared as intmax_t, so
+	// negative values and unsigned bounds mix correctly as long as they fit.
 	// Example usage:
-	// {{ "" | generate_error_macros }}
-	pongo2.RegisterFilter("generate_error_macros", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
-		code := `#include <stdio.h>
-#include <stdlib.h>
-
-#define CHECK_NULL(ptr, msg) do { \
-    if (!(ptr)) { \
-        fprintf(stderr, "NULL pointer: %s in %s\n", msg, __func__); \
-        exit(EXIT_FAILURE); \
-    } \
-} while (0)
-
-#define CHECK_SYS_CALL(result, msg) do { \
-    if ((result) == -1) { \
-        perror(msg); \
-        exit(EXIT_FAILURE); \
-    } \
-} while(0)
-
-#define CHECK_BOUNDS(index, size, msg) do { \
-    if ((index) >= (size)) { \
-        fprintf(stderr, "Bounds check failed: %s (index: %%zu, size: %%zu) in %%s\n", \
-                msg, (size_t)(index), (size_t)(size), __func__); \
-        exit(EXIT_FAILURE); \
-    } \
-} while(0)`
+	// {{ "port,1,65535" | check_range }}
+	// {% cgen check_range "level" "-5" "limits(cfg, 1)" %}
+	errs = append(errs, registerFilter("check_range", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code, err := checkRange(strings.Split(in.String(), ","))
+		return filterCode("check_range", code, err)
+	}))
+	errs = append(errs, registerCgen("check_range", checkRange))
 
-		return pongo2.AsSafeValue(code), nil
-	})
+	// Exit unless a string is one of the |-separated allowed values. A NULL
+	// string is never allowed.
+	// Example usage:
+	// {{ "mode" | check_enum : "fast|safe|debug" }}
+	errs = append(errs, registerFilter("check_enum", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code, err := checkEnum([]string{in.String(), param.String()})
+		return filterCode("check_enum", code, err)
+	}))
+	errs = append(errs, registerCgen("check_enum", checkEnum))
+
+	// Clamp a variable into [min, max] instead of exiting, comparing as
+	// intmax_t. Pass "log" to report each clamp on stderr.
+	// Example usage:
+	// {{ "workers,1,64" | clamp }}
+	// {{ "volume,0,100" | clamp : "log" }}
+	errs = append(errs, registerFilter("clamp", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		args := strings.Split(in.String(), ",")
+		if mode := strings.TrimSpace(param.String()); mode != "" {
+			args = append(args, mode)
+		}
+		code, err := clamp(args)
+		return filterCode("clamp", code, err)
+	}))
+	errs = append(errs, registerCgen("clamp", clamp))
 
 	// Add this to your error handling package
 
-	pongo2.RegisterFilter("check_args", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	errs = append(errs, registerFilter("check_args", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
 		condition := in.String()
 		message := param.String()
 		code := fmt.Sprintf(
@@ -232,24 +232,119 @@ if (!%[1]s) {
     fprintf(stderr, "Usage: %%s <source> <dest>\n", argv[0]); 
     exit(EXIT_FAILURE); 
 }`,
-			condition, message)
+			condition, cFormatEscape(message))
 		return pongo2.AsSafeValue(code), nil
-	})
+	}))
 
 	// For the read/write size validation, use this:
-	pongo2.RegisterFilter("check_min_size", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
-		parts := strings.Split(in.String(), ",")
-		if len(parts) != 2 {
-			return nil, &pongo2.Error{OrigError: fmt.Errorf("check_min_size needs actual,expected")}
-		}
-		actual, expected := parts[0], parts[1]
-		code := fmt.Sprintf(
-			`if (%[1]s < %[2]s) { 
-    fprintf(stderr, "Size check failed: got %%zd, expected at least %%zd in %%s\n", 
-            (size_t)%[1]s, (size_t)%[2]s, __func__); 
+	errs = append(errs, registerFilter("check_min_size", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code, err := checkMinSize(strings.Split(in.String(), ","))
+		return filterCode("check_min_size", code, err)
+	}))
+	// {% cgen check_min_size "read(fd, buf, sizeof(buf))" "header_size" %}
+	errs = append(errs, registerCgen("check_min_size", checkMinSize))
+
+	return errors.Join(errs...)
+}
+
+func checkBounds(args []string) (string, error) {
+	if len(args) != 2 {
+		return "", fmt.Errorf("needs index, size")
+	}
+	// Compared as intmax_t: a negative index cast to size_t would wrap and
+	// could pass as in range.
+	return fmt.Sprintf(
+		`if ((intmax_t)(%[1]s) < 0 || (intmax_t)(%[1]s) >= (intmax_t)(%[2]s)) { 
+    fprintf(stderr, "Index %%jd out of bounds (size: %%jd) in %%s\n", (intmax_t)(%[1]s), (intmax_t)(%[2]s), __func__); 
     exit(EXIT_FAILURE); 
 }`,
-			actual, expected)
-		return pongo2.AsSafeValue(code), nil
-	})
+		args[0], args[1]), nil
+}
+
+func checkMinSize(args []string) (string, error) {
+	if len(args) != 2 {
+		return "", fmt.Errorf("needs actual, expected")
+	}
+	// The actual size is evaluated once, since it is often a read() call,
+	// and compared as intmax_t so a -1 error result fails the check.
+	return fmt.Sprintf(
+		`{
+    intmax_t size_got = (intmax_t)(%[1]s);
+    if (size_got < (intmax_t)(%[2]s)) {
+        fprintf(stderr, "Size check failed: got %%jd, expected at least %%jd in %%s\n",
+                size_got, (intmax_t)(%[2]s), __func__);
+        exit(EXIT_FAILURE);
+    }
+}`,
+		args[0], args[1]), nil
+}
+
+func checkRange(args []string) (string, error) {
+	if len(args) != 3 {
+		return "", fmt.Errorf("needs value, min, max")
+	}
+	value := strings.TrimSpace(args[0])
+	return fmt.Sprintf(
+		`{
+    intmax_t range_value = (intmax_t)(%[1]s);
+    intmax_t range_min = (intmax_t)(%[2]s);
+    intmax_t range_max = (intmax_t)(%[3]s);
+    if (range_value < range_min || range_value > range_max) {
+        fprintf(stderr, "%%s is %%jd, expected %%jd to %%jd in %%s\n", %[4]s, range_value, range_min, range_max, __func__);
+        exit(EXIT_FAILURE);
+    }
+}`,
+		value, args[1], args[2], cStringLiteral(value)), nil
+}
+
+func checkEnum(args []string) (string, error) {
+	if len(args) != 2 {
+		return "", fmt.Errorf("needs value, allowed")
+	}
+	value := strings.TrimSpace(args[0])
+	var allowed, tests []string
+	for _, option := range strings.Split(args[1], "|") {
+		if option = strings.TrimSpace(option); option != "" {
+			allowed = append(allowed, option)
+			tests = append(tests, fmt.Sprintf("strcmp(enum_value, %s) != 0", cStringLiteral(option)))
+		}
+	}
+	if len(allowed) == 0 {
+		return "", fmt.Errorf("needs at least one allowed value")
+	}
+	return fmt.Sprintf(
+		`{
+    const char *enum_value = %[1]s;
+    if (!enum_value || (%[2]s)) {
+        fprintf(stderr, "%%s is \"%%s\", expected one of %%s in %%s\n", %[3]s, enum_value ? enum_value : "(null)", %[4]s, __func__);
+        exit(EXIT_FAILURE);
+    }
+}`,
+		value, strings.Join(tests, " && "), cStringLiteral(value), cStringLiteral(strings.Join(allowed, ", "))), nil
+}
+
+func clamp(args []string) (string, error) {
+	if len(args) != 3 && len(args) != 4 {
+		return "", fmt.Errorf("needs value, min, max[, log]")
+	}
+	logClamp := ""
+	if len(args) == 4 {
+		if mode := strings.TrimSpace(args[3]); mode != "log" {
+			return "", fmt.Errorf("fourth argument must be log, got %q", mode)
+		}
+		logClamp = fmt.Sprintf(`
+        fprintf(stderr, "Clamped %%s from %%jd to %%jd in %%s\n", %s, clamp_value, clamp_to, __func__);`,
+			cStringLiteral(strings.TrimSpace(args[0])))
+	}
+	return fmt.Sprintf(
+		`{
+    intmax_t clamp_value = (intmax_t)(%[1]s);
+    intmax_t clamp_min = (intmax_t)(%[2]s);
+    intmax_t clamp_max = (intmax_t)(%[3]s);
+    intmax_t clamp_to = clamp_value < clamp_min ? clamp_min : clamp_value > clamp_max ? clamp_max : clamp_value;
+    if (clamp_to != clamp_value) {%[4]s
+        %[1]s = clamp_to;
+    }
+}`,
+		strings.TrimSpace(args[0]), args[1], args[2], logClamp), nil
 }
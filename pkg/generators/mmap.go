@@ -0,0 +1,124 @@
+package generators
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func init() {
+	Register(InitMmapFilters)
+}
+
+// Memory-mapped files, for reading large files without copying them
+// through stdio. The mapping outlives the fd, which is closed right away.
+func InitMmapFilters() error {
+	var errs []error
+
+	// Declares a read-only const char* mapping and its size_t size. The
+	// contents are not NUL-terminated. An empty file gives NULL and 0.
+	// Example usage:
+	// {{ "data,data_size" | mmap_file : "big.log" }}
+	// ...
+	// {{ "data,data_size" | munmap_file }}
+	errs = append(errs, registerFilter("mmap_file", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return mmapCode("mmap_file", in, param, false)
+	}))
+
+	// Like mmap_file but writable and shared: changes go to the file. The
+	// size is fixed; writes past it are invalid. Unmap with
+	// {{ "ptr,size" | munmap_file : "sync" }} to flush changes first.
+	// Example usage:
+	// {{ "db,db_size" | mmap_file_writable : "counters.bin" }}
+	errs = append(errs, registerFilter("mmap_file_writable", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return mmapCode("mmap_file_writable", in, param, true)
+	}))
+
+	// Unmap and reset to NULL/0. NULL mappings (empty files) are skipped.
+	// Pass "sync" to msync a writable mapping to disk first.
+	// Example usage:
+	// {{ "data,data_size" | munmap_file }}
+	// {{ "db,db_size" | munmap_file : "sync" }}
+	errs = append(errs, registerFilter("munmap_file", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		parts := strings.Split(in.String(), ",")
+		if len(parts) != 2 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("munmap_file needs ptr,size as input")}
+		}
+		ptr, size := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		sync := ""
+		switch mode := strings.TrimSpace(param.String()); mode {
+		case "":
+		case "sync":
+			sync = fmt.Sprintf(`
+    if (msync((void *)%[1]s, %[2]s, MS_SYNC) == -1) {
+        perror("msync %[1]s");
+        exit(EXIT_FAILURE);
+    }`, ptr, size)
+		default:
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("munmap_file parameter must be empty or sync, got %q", mode)}
+		}
+		code := fmt.Sprintf(
+			`if (%[1]s) {%[3]s
+    if (munmap((void *)%[1]s, %[2]s) == -1) {
+        perror("munmap %[1]s");
+        exit(EXIT_FAILURE);
+    }
+    %[1]s = NULL;
+    %[2]s = 0;
+}`,
+			ptr, size, sync)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	return errors.Join(errs...)
+}
+
+func mmapCode(filter string, in, param *pongo2.Value, writable bool) (*pongo2.Value, *pongo2.Error) {
+	parts := strings.Split(in.String(), ",")
+	if len(parts) != 2 {
+		return nil, &pongo2.Error{OrigError: fmt.Errorf("%s needs ptr,size as input", filter)}
+	}
+	ptrType, openFlags, prot, share := "const char", "O_RDONLY", "PROT_READ", "MAP_PRIVATE"
+	if writable {
+		ptrType, openFlags, prot, share = "char", "O_RDWR", "PROT_READ | PROT_WRITE", "MAP_SHARED"
+	}
+	code := fmt.Sprintf(
+		`// An empty file maps to NULL with size 0, since mmap of length 0 fails.
+%[4]s *%[1]s = NULL;
+size_t %[2]s = 0;
+{
+    const char *path_%[1]s = %[3]s;
+    int fd_%[1]s = open(path_%[1]s, %[5]s);
+    if (fd_%[1]s == -1) {
+        fprintf(stderr, "Failed to open %%s: %%s\n", path_%[1]s, strerror(errno));
+        exit(EXIT_FAILURE);
+    }
+    struct stat stat_buf_%[1]s;
+    if (fstat(fd_%[1]s, &stat_buf_%[1]s) == -1) {
+        fprintf(stderr, "Failed to stat %%s: %%s\n", path_%[1]s, strerror(errno));
+        close(fd_%[1]s);
+        exit(EXIT_FAILURE);
+    }
+    if (!S_ISREG(stat_buf_%[1]s.st_mode)) {
+        fprintf(stderr, "Not a regular file: %%s\n", path_%[1]s);
+        close(fd_%[1]s);
+        exit(EXIT_FAILURE);
+    }
+    if (stat_buf_%[1]s.st_size > 0) {
+        %[2]s = (size_t)stat_buf_%[1]s.st_size;
+        void *map_%[1]s = mmap(NULL, %[2]s, %[6]s, %[7]s, fd_%[1]s, 0);
+        if (map_%[1]s == MAP_FAILED) {
+            fprintf(stderr, "Failed to map %%s: %%s\n", path_%[1]s, strerror(errno));
+            close(fd_%[1]s);
+            exit(EXIT_FAILURE);
+        }
+        %[1]s = map_%[1]s;
+    }
+    close(fd_%[1]s);
+}`,
+		strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), quoteIfLiteral(param.String()),
+		ptrType, openFlags, prot, share)
+	return pongo2.AsSafeValue(code), nil
+}
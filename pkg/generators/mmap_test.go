@@ -0,0 +1,62 @@
+package generators
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMmapCountsNewlines(t *testing.T) {
+	dir := t.TempDir()
+	big := strings.Repeat("a line of text\n", 50000) + "no newline at the end"
+	files := map[string]string{"big.txt": big, "empty.txt": "", "counters.bin": "0000"}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// mtime as a name checks the generated stat buffer doesn't collide
+	// with the st_mtime macro.
+	out := renderAndRunIn(t, dir, `#include <string.h>
+int main(void) {
+    const char *path = "big.txt";
+    {{ "mtime,mtime_size" | mmap_file : "$path" }}
+    size_t lines = 0;
+    for (const char *p = mtime; p && (p = memchr(p, '\n', mtime_size - (size_t)(p - mtime))); p++) {
+        lines++;
+    }
+    printf("%zu %zu\n", lines, mtime_size);
+    {{ "mtime,mtime_size" | munmap_file }}
+    printf("%d %zu\n", mtime == NULL, mtime_size);
+
+    {{ "empty,empty_size" | mmap_file : "empty.txt" }}
+    printf("%d %zu\n", empty == NULL, empty_size);
+    {{ "empty,empty_size" | munmap_file }}
+
+    {{ "db,db_size" | mmap_file_writable : "counters.bin" }}
+    memcpy(db + 1, "42", 2);
+    {{ "db,db_size" | munmap_file : "sync" }}
+    return 0;
+}
+`, sanitize)
+	if want := "50000 750021\n1 0\n1 0\n"; out != want {
+		t.Errorf("got\n%s\nwant\n%s", out, want)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "counters.bin")); err != nil || string(data) != "0420" {
+		t.Errorf("writable mapping left %q, %v; want 0420", data, err)
+	}
+}
+
+func TestMmapMissingFile(t *testing.T) {
+	src, libs := render(t, `int main(void) {
+    {{ "data,data_size" | mmap_file : "missing.txt" }}
+    return data_size != 0;
+}
+`)
+	bin := compileC(t, src, libs)
+	if _, stderr, code := runC(t, bin, t.TempDir()); code != 1 || stderr != "Failed to open missing.txt: No such file or directory\n" {
+		t.Errorf("got exit %d, stderr %q", code, stderr)
+	}
+}
@@ -0,0 +1,361 @@
+package generators
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func init() {
+	Register(InitNetFilters)
+}
+
+// TCP (IPv4 and IPv6) and UDP (IPv4) over BSD sockets. Locals are
+// suffixed with the fd variable, so several sockets can share a function.
+func InitNetFilters() error {
+	var errs []error
+
+	// Declares a listening socket on all interfaces, with SO_REUSEADDR so a
+	// restarted server can bind again right away.
+	// Example usage:
+	// {{ "server_fd" | tcp_listen : "8080" }}
+	// {{ "server_fd" | tcp_listen : "port" }}
+	errs = append(errs, registerFilter("tcp_listen", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		port := strings.TrimSpace(param.String())
+		if port == "" {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("tcp_listen needs a port")}
+		}
+		code := fmt.Sprintf(
+			`int %[1]s = socket(AF_INET6, SOCK_STREAM, 0);
+{
+    int family_%[1]s = AF_INET6;
+    if (%[1]s == -1 && errno == EAFNOSUPPORT) {
+        family_%[1]s = AF_INET;
+        %[1]s = socket(AF_INET, SOCK_STREAM, 0);
+    }
+    if (%[1]s == -1) {
+        perror("socket");
+        exit(EXIT_FAILURE);
+    }
+    int opt_%[1]s = 1;
+    if (setsockopt(%[1]s, SOL_SOCKET, SO_REUSEADDR, &opt_%[1]s, sizeof(opt_%[1]s)) == -1) {
+        perror("setsockopt SO_REUSEADDR");
+        exit(EXIT_FAILURE);
+    }
+    struct sockaddr_storage addr_%[1]s;
+    socklen_t addr_len_%[1]s;
+    memset(&addr_%[1]s, 0, sizeof(addr_%[1]s));
+    if (family_%[1]s == AF_INET6) {
+        opt_%[1]s = 0;
+        setsockopt(%[1]s, IPPROTO_IPV6, IPV6_V6ONLY, &opt_%[1]s, sizeof(opt_%[1]s));
+        struct sockaddr_in6 *in6_%[1]s = (struct sockaddr_in6 *)&addr_%[1]s;
+        in6_%[1]s->sin6_family = AF_INET6;
+        in6_%[1]s->sin6_addr = in6addr_any;
+        in6_%[1]s->sin6_port = htons((uint16_t)(%[2]s));
+        addr_len_%[1]s = sizeof(*in6_%[1]s);
+    } else {
+        struct sockaddr_in *in4_%[1]s = (struct sockaddr_in *)&addr_%[1]s;
+        in4_%[1]s->sin_family = AF_INET;
+        in4_%[1]s->sin_addr.s_addr = htonl(INADDR_ANY);
+        in4_%[1]s->sin_port = htons((uint16_t)(%[2]s));
+        addr_len_%[1]s = sizeof(*in4_%[1]s);
+    }
+    if (bind(%[1]s, (struct sockaddr *)&addr_%[1]s, addr_len_%[1]s) == -1) {
+        fprintf(stderr, "Failed to bind port %%d: %%s\n", (int)(%[2]s), strerror(errno));
+        exit(EXIT_FAILURE);
+    }
+    if (listen(%[1]s, SOMAXCONN) == -1) {
+        perror("listen");
+        exit(EXIT_FAILURE);
+    }
+}`,
+			in.String(), port)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Accept connections forever, with the client fd declared inside the
+	// loop. tcp_accept_loop_end closes it at the end of each pass, so a
+	// body that breaks out of the loop has to close it first.
+	// Example usage:
+	// {{ "client_fd" | tcp_accept_loop : "server_fd" }}
+	//     ...
+	// {{ "client_fd" | tcp_accept_loop_end }}
+	errs = append(errs, registerFilter("tcp_accept_loop", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		listener := strings.TrimSpace(param.String())
+		if listener == "" {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("tcp_accept_loop needs the listening fd")}
+		}
+		code := fmt.Sprintf(
+			`for (;;) {
+    int %[1]s = accept(%[2]s, NULL, NULL);
+    if (%[1]s == -1) {
+        if (errno == EINTR || errno == ECONNABORTED) {
+            continue;
+        }
+        perror("accept");
+        exit(EXIT_FAILURE);
+    }`,
+			in.String(), listener)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Example usage:
+	// {{ "client_fd" | tcp_accept_loop_end }}
+	errs = append(errs, registerFilter("tcp_accept_loop_end", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return pongo2.AsSafeValue(fmt.Sprintf("    close(%s);\n}", in.String())), nil
+	}))
+
+	// Declares a socket connected to host:port, trying each address
+	// getaddrinfo returns until one connects. A host variable is marked
+	// with $.
+	// Example usage:
+	// {{ "conn_fd" | tcp_connect : "example.com,80" }}
+	// {{ "conn_fd" | tcp_connect : "localhost,8080" }}
+	// {{ "conn_fd" | tcp_connect : "$host,port" }}
+	errs = append(errs, registerFilter("tcp_connect", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		parts := strings.Split(param.String(), ",")
+		if len(parts) != 2 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("tcp_connect needs host,port")}
+		}
+		code := fmt.Sprintf(
+			`int %[1]s = -1;
+{
+    const char *host_%[1]s = %[2]s;
+    char port_%[1]s[16];
+    snprintf(port_%[1]s, sizeof(port_%[1]s), "%%d", (int)(%[3]s));
+    struct addrinfo hints_%[1]s, *res_%[1]s = NULL;
+    memset(&hints_%[1]s, 0, sizeof(hints_%[1]s));
+    hints_%[1]s.ai_family = AF_UNSPEC;
+    hints_%[1]s.ai_socktype = SOCK_STREAM;
+    int rc_%[1]s = getaddrinfo(host_%[1]s, port_%[1]s, &hints_%[1]s, &res_%[1]s);
+    if (rc_%[1]s != 0) {
+        fprintf(stderr, "Failed to resolve %%s: %%s\n", host_%[1]s, gai_strerror(rc_%[1]s));
+        exit(EXIT_FAILURE);
+    }
+    int err_%[1]s = 0;
+    for (struct addrinfo *ai = res_%[1]s; ai && %[1]s == -1; ai = ai->ai_next) {
+        %[1]s = socket(ai->ai_family, ai->ai_socktype, ai->ai_protocol);
+        if (%[1]s == -1) {
+            err_%[1]s = errno;
+            continue;
+        }
+        while (connect(%[1]s, ai->ai_addr, ai->ai_addrlen) == -1) {
+            if (errno == EINTR) {
+                continue;
+            }
+            err_%[1]s = errno;
+            close(%[1]s);
+            %[1]s = -1;
+            break;
+        }
+    }
+    freeaddrinfo(res_%[1]s);
+    if (%[1]s == -1) {
+        fprintf(stderr, "Failed to connect to %%s:%%s: %%s\n", host_%[1]s, port_%[1]s, strerror(err_%[1]s));
+        exit(EXIT_FAILURE);
+    }
+}`,
+			in.String(), quoteIfLiteral(parts[0]), strings.TrimSpace(parts[1]))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Send the whole buffer, looping over partial sends.
+	// Example usage:
+	// {{ "conn_fd" | send_all : "line,line_len" }}
+	errs = append(errs, registerFilter("send_all", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		parts := strings.Split(param.String(), ",")
+		if len(parts) != 2 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("send_all needs buf,len")}
+		}
+		code := fmt.Sprintf(
+			`{
+    const char *send_buf_%[1]s = (const char *)(%[2]s);
+    size_t send_left_%[1]s = (size_t)(%[3]s);
+    while (send_left_%[1]s > 0) {
+        ssize_t sent_%[1]s = send(%[1]s, send_buf_%[1]s, send_left_%[1]s, 0);
+        if (sent_%[1]s == -1) {
+            if (errno == EINTR) {
+                continue;
+            }
+            perror("send");
+            exit(EXIT_FAILURE);
+        }
+        send_buf_%[1]s += sent_%[1]s;
+        send_left_%[1]s -= (size_t)sent_%[1]s;
+    }
+}`,
+			in.String(), strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Read one line, newline included, into a char array declared here.
+	// Declares <buf>_len: 0 at end of stream, and a line longer than the
+	// buffer comes back in pieces without a newline.
+	// Example usage:
+	// {{ "line" | recv_line : "conn_fd,1024" }}
+	errs = append(errs, registerFilter("recv_line", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		parts := strings.Split(param.String(), ",")
+		if len(parts) != 2 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("recv_line needs fd,max_len")}
+		}
+		code := fmt.Sprintf(
+			`char %[1]s[%[3]s];
+size_t %[1]s_len = 0;
+while (%[1]s_len + 1 < sizeof(%[1]s)) {
+    ssize_t got_%[1]s = recv(%[2]s, %[1]s + %[1]s_len, 1, 0);
+    if (got_%[1]s == -1) {
+        if (errno == EINTR) {
+            continue;
+        }
+        perror("recv");
+        exit(EXIT_FAILURE);
+    }
+    if (got_%[1]s == 0) {
+        break;
+    }
+    if (%[1]s[%[1]s_len++] == '\n') {
+        break;
+    }
+}
+%[1]s[%[1]s_len] = '\0';`,
+			in.String(), strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Declares an IPv4 UDP socket. The optional parameter is a receive
+	// timeout in milliseconds (SO_RCVTIMEO), after which udp_recv_from
+	// gives up instead of blocking forever.
+	// Example usage:
+	// {{ "udp_fd" | udp_socket }}
+	// {{ "udp_fd" | udp_socket : "500" }}
+	errs = append(errs, registerFilter("udp_socket", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		fd := in.String()
+		code := fmt.Sprintf(
+			`int %[1]s = socket(AF_INET, SOCK_DGRAM, 0);
+if (%[1]s == -1) {
+    perror("socket");
+    exit(EXIT_FAILURE);
+}`,
+			fd)
+		if timeout := strings.TrimSpace(param.String()); timeout != "" {
+			code += fmt.Sprintf(
+				`
+{
+    long timeout_ms_%[1]s = (long)(%[2]s);
+    struct timeval timeout_%[1]s = {timeout_ms_%[1]s / 1000, (timeout_ms_%[1]s %% 1000) * 1000};
+    if (setsockopt(%[1]s, SOL_SOCKET, SO_RCVTIMEO, &timeout_%[1]s, sizeof(timeout_%[1]s)) == -1) {
+        perror("setsockopt SO_RCVTIMEO");
+        exit(EXIT_FAILURE);
+    }
+}`,
+				fd, timeout)
+		}
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Bind a udp_socket to a port on all interfaces, 0 for any free port.
+	// Example usage:
+	// {{ "udp_fd" | udp_bind : "9999" }}
+	errs = append(errs, registerFilter("udp_bind", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		port := strings.TrimSpace(param.String())
+		if port == "" {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("udp_bind needs a port")}
+		}
+		code := fmt.Sprintf(
+			`{
+    struct sockaddr_in addr_%[1]s;
+    memset(&addr_%[1]s, 0, sizeof(addr_%[1]s));
+    addr_%[1]s.sin_family = AF_INET;
+    addr_%[1]s.sin_addr.s_addr = htonl(INADDR_ANY);
+    addr_%[1]s.sin_port = htons((uint16_t)(%[2]s));
+    if (bind(%[1]s, (struct sockaddr *)&addr_%[1]s, sizeof(addr_%[1]s)) == -1) {
+        fprintf(stderr, "Failed to bind UDP port %%d: %%s\n", (int)(%[2]s), strerror(errno));
+        exit(EXIT_FAILURE);
+    }
+}`,
+			in.String(), port)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Send one datagram to host:port. As with tcp_connect, a host
+	// variable is marked with $.
+	// Example usage:
+	// {{ "udp_fd" | udp_send_to : "127.0.0.1,9999,msg,strlen(msg)" }}
+	errs = append(errs, registerFilter("udp_send_to", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		parts := strings.Split(param.String(), ",")
+		if len(parts) != 4 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("udp_send_to needs host,port,buf,len")}
+		}
+		code := fmt.Sprintf(
+			`{
+    const char *host_%[1]s = %[2]s;
+    char port_%[1]s[16];
+    snprintf(port_%[1]s, sizeof(port_%[1]s), "%%d", (int)(%[3]s));
+    struct addrinfo hints_%[1]s, *res_%[1]s = NULL;
+    memset(&hints_%[1]s, 0, sizeof(hints_%[1]s));
+    hints_%[1]s.ai_family = AF_INET;
+    hints_%[1]s.ai_socktype = SOCK_DGRAM;
+    hints_%[1]s.ai_flags = AI_NUMERICSERV;
+    int rc_%[1]s = getaddrinfo(host_%[1]s, port_%[1]s, &hints_%[1]s, &res_%[1]s);
+    if (rc_%[1]s != 0) {
+        fprintf(stderr, "Failed to resolve %%s: %%s\n", host_%[1]s, gai_strerror(rc_%[1]s));
+        exit(EXIT_FAILURE);
+    }
+    ssize_t sent_%[1]s;
+    do {
+        sent_%[1]s = sendto(%[1]s, %[4]s, (size_t)(%[5]s), 0, res_%[1]s->ai_addr, res_%[1]s->ai_addrlen);
+    } while (sent_%[1]s == -1 && errno == EINTR);
+    freeaddrinfo(res_%[1]s);
+    if (sent_%[1]s == -1) {
+        perror("sendto");
+        exit(EXIT_FAILURE);
+    }
+}`,
+			in.String(), quoteIfLiteral(parts[0]), strings.TrimSpace(parts[1]),
+			strings.TrimSpace(parts[2]), strings.TrimSpace(parts[3]))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Receive one datagram into a char array declared here, NUL-terminated
+	// so text payloads can be used as strings, and put the sender's address
+	// in <from>. Declares <buf>_len, which is -1 if a udp_socket timeout
+	// expired first. Longer datagrams are truncated.
+	// Example usage:
+	// {{ "packet,sender" | udp_recv_from : "udp_fd,1500" }}
+	errs = append(errs, registerFilter("udp_recv_from", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		names := strings.Split(in.String(), ",")
+		parts := strings.Split(param.String(), ",")
+		if len(names) != 2 || len(parts) != 2 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("udp_recv_from needs buf,from as input and fd,max_len as parameter")}
+		}
+		code := fmt.Sprintf(
+			`char %[1]s[(%[4]s) + 1];
+char %[2]s[INET_ADDRSTRLEN] = "";
+ssize_t %[1]s_len;
+{
+    struct sockaddr_in from_addr_%[1]s;
+    socklen_t from_len_%[1]s;
+    do {
+        from_len_%[1]s = sizeof(from_addr_%[1]s);
+        %[1]s_len = recvfrom(%[3]s, %[1]s, sizeof(%[1]s) - 1, 0, (struct sockaddr *)&from_addr_%[1]s, &from_len_%[1]s);
+    } while (%[1]s_len == -1 && errno == EINTR);
+    if (%[1]s_len == -1) {
+        if (errno != EAGAIN && errno != EWOULDBLOCK) {
+            perror("recvfrom");
+            exit(EXIT_FAILURE);
+        }
+        %[1]s[0] = '\0';
+    } else {
+        %[1]s[%[1]s_len] = '\0';
+        inet_ntop(AF_INET, &from_addr_%[1]s.sin_addr, %[2]s, sizeof(%[2]s));
+    }
+}`,
+			strings.TrimSpace(names[0]), strings.TrimSpace(names[1]),
+			strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	return errors.Join(errs...)
+}
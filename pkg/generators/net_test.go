@@ -0,0 +1,110 @@
+package generators
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+// freePort returns a loopback port that was free a moment ago, for
+// generated programs that bind a fixed port.
+func freePort(t *testing.T, network string) int {
+	t.Helper()
+	if network == "udp" {
+		c, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		if err != nil {
+			t.Skipf("no loopback UDP: %v", err)
+		}
+		defer c.Close()
+		return c.LocalAddr().(*net.UDPAddr).Port
+	}
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("no loopback TCP: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestTCPEcho(t *testing.T) {
+	port := freePort(t, "tcp")
+	src, libs := renderContext(t, `#include <ctype.h>
+#include <sys/wait.h>
+int main(void) {
+    {{ "server_fd" | tcp_listen : port }}
+    pid_t pid = fork();
+    if (pid == -1) {
+        perror("fork");
+        return 1;
+    }
+    if (pid == 0) {
+        close(server_fd);
+        {{ "conn_fd" | tcp_connect : addr }}
+        const char *msg = "hello\n";
+        {{ "conn_fd" | send_all : "msg,strlen(msg)" }}
+        {{ "reply" | recv_line : "conn_fd,64" }}
+        {{ "eof" | recv_line : "conn_fd,64" }}
+        printf("client: %s|%zu\n", reply, eof_len);
+        close(conn_fd);
+        return 0;
+    }
+    {{ "client_fd" | tcp_accept_loop : "server_fd" }}
+        {{ "head" | recv_line : "client_fd,4" }}
+        {{ "tail" | recv_line : "client_fd,64" }}
+        printf("server: %s|%s", head, tail);
+        fflush(stdout);
+        char reply[64];
+        int reply_len = snprintf(reply, sizeof(reply), "%s%s", head, tail);
+        for (int i = 0; i < reply_len; i++) reply[i] = (char)toupper((unsigned char)reply[i]);
+        {{ "client_fd" | send_all : "reply,reply_len" }}
+        close(client_fd);
+        break;
+    {{ "client_fd" | tcp_accept_loop_end }}
+    int status;
+    waitpid(pid, &status, 0);
+    close(server_fd);
+    return WIFEXITED(status) ? WEXITSTATUS(status) : 1;
+}
+`, pongo2.Context{"port": fmt.Sprint(port), "addr": fmt.Sprintf("127.0.0.1,%d", port)})
+	bin := compileC(t, src, libs, sanitize)
+	stdout, stderr, code := runC(t, bin, "")
+	if code != 0 {
+		t.Fatalf("program exited %d: %s\n%s", code, stderr, numbered(src))
+	}
+	if want := "server: hel|lo\nclient: HELLO\n|0\n"; stdout != want {
+		t.Errorf("got stdout %q, want %q", stdout, want)
+	}
+}
+
+func TestUDPRoundTrip(t *testing.T) {
+	port := freePort(t, "udp")
+	src, libs := renderContext(t, `int main(void) {
+    {{ "server_fd" | udp_socket : "2000" }}
+    {{ "server_fd" | udp_bind : port }}
+    {{ "client_fd" | udp_socket }}
+    const char *host = "127.0.0.1";
+    const char *msg = "ping";
+    {{ "client_fd" | udp_send_to : send_args }}
+    {{ "packet,sender" | udp_recv_from : "server_fd,2" }}
+    printf("%s %zd from %s\n", packet, packet_len, sender);
+    {{ "idle_fd" | udp_socket : "50" }}
+    {{ "idle_fd" | udp_bind : "0" }}
+    {{ "nothing,nobody" | udp_recv_from : "idle_fd,16" }}
+    printf("%zd [%s] [%s]\n", nothing_len, nothing, nobody);
+    close(server_fd);
+    close(client_fd);
+    close(idle_fd);
+    return 0;
+}
+`, pongo2.Context{"port": fmt.Sprint(port), "send_args": fmt.Sprintf("$host,%d,msg,strlen(msg)", port)})
+	bin := compileC(t, src, libs, sanitize)
+	stdout, stderr, code := runC(t, bin, "")
+	if code != 0 {
+		t.Fatalf("program exited %d: %s\n%s", code, stderr, numbered(src))
+	}
+	if want := "pi 2 from 127.0.0.1\n-1 [] []\n"; stdout != want {
+		t.Errorf("got stdout %q, want %q", stdout, want)
+	}
+}
@@ -0,0 +1,107 @@
+package generators
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func init() {
+	Register(InitNumberFilters)
+}
+
+func InitNumberFilters() error {
+	var errs []error
+
+	// Declares value (int) and ok (bool). ok is false for NULL or empty
+	// input, trailing junk, and values outside the int range; value stays 0.
+	// Example usage:
+	// {{ "port,port_ok" | parse_int : "argv[1]" }}
+	errs = append(errs, registerFilter("parse_int", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		value, ok, err := parseNumberOutputs("parse_int", in)
+		if err != nil {
+			return nil, err
+		}
+		code := fmt.Sprintf(
+			`int %[1]s = 0;
+bool %[2]s = false;
+{
+    const char *num_src_%[1]s = %[3]s;
+    if (num_src_%[1]s && *num_src_%[1]s) {
+        char *end_%[1]s;
+        errno = 0;
+        long parsed_%[1]s = strtol(num_src_%[1]s, &end_%[1]s, 10);
+        if (errno == 0 && end_%[1]s != num_src_%[1]s && *end_%[1]s == '\0' &&
+            parsed_%[1]s >= INT_MIN && parsed_%[1]s <= INT_MAX) {
+            %[1]s = (int)parsed_%[1]s;
+            %[2]s = true;
+        }
+    }
+}`,
+			value, ok, param.String())
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Declares value (double) and ok (bool), with the same rules as parse_int;
+	// overflow (ERANGE) is rejected.
+	// Example usage:
+	// {{ "ratio,ratio_ok" | parse_double : "input" }}
+	errs = append(errs, registerFilter("parse_double", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		value, ok, err := parseNumberOutputs("parse_double", in)
+		if err != nil {
+			return nil, err
+		}
+		code := fmt.Sprintf(
+			`double %[1]s = 0.0;
+bool %[2]s = false;
+{
+    const char *num_src_%[1]s = %[3]s;
+    if (num_src_%[1]s && *num_src_%[1]s) {
+        char *end_%[1]s;
+        errno = 0;
+        double parsed_%[1]s = strtod(num_src_%[1]s, &end_%[1]s);
+        if (errno == 0 && end_%[1]s != num_src_%[1]s && *end_%[1]s == '\0') {
+            %[1]s = parsed_%[1]s;
+            %[2]s = true;
+        }
+    }
+}`,
+			value, ok, param.String())
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Formats any integer expression into an exactly sized AUTO_FREE string.
+	// Needs {{ "" | auto_free_generic }}.
+	// Example usage:
+	// {{ "count_text" | int_to_string : "count + 1" }}
+	errs = append(errs, registerFilter("int_to_string", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		dest := in.String()
+		expr := param.String()
+		code := fmt.Sprintf(
+			`AUTO_FREE char *%[1]s = NULL;
+{
+    long long num_%[1]s = (long long)(%[2]s);
+    int len_%[1]s = snprintf(NULL, 0, "%%lld", num_%[1]s);
+    %[1]s = len_%[1]s < 0 ? NULL : malloc((size_t)len_%[1]s + 1);
+    if (!%[1]s) {
+        fprintf(stderr, "Failed to get memory for %[1]s\n");
+        exit(EXIT_FAILURE);
+    }
+    snprintf(%[1]s, (size_t)len_%[1]s + 1, "%%lld", num_%[1]s);
+}`,
+			dest, expr)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	return errors.Join(errs...)
+}
+
+func parseNumberOutputs(filter string, in *pongo2.Value) (string, string, *pongo2.Error) {
+	parts := strings.Split(in.String(), ",")
+	if len(parts) != 2 {
+		return "", "", &pongo2.Error{OrigError: fmt.Errorf("%s needs value,ok as input", filter)}
+	}
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), nil
+}
@@ -0,0 +1,37 @@
+package generators
+
+import "testing"
+
+func TestParseNumbers(t *testing.T) {
+	out := renderAndRun(t, `{{ "" | auto_free_generic }}
+static void check_int(const char *s) {
+    {{ "value,ok" | parse_int : "s" }}
+    printf("%d:%d ", value, ok);
+}
+
+static void check_double(const char *s) {
+    {{ "value,ok" | parse_double : "s" }}
+    printf("%g:%d ", value, ok);
+}
+
+int main(void) {
+    const char *ints[] = {"42", "-7", "", "12x", "2147483647", "2147483648", "-2147483648", NULL};
+    for (size_t i = 0; i < sizeof(ints) / sizeof(ints[0]); i++) check_int(ints[i]);
+    printf("\n");
+    const char *doubles[] = {"1.5", "-2e3", "abc", "1e999", "3.0.0", NULL};
+    for (size_t i = 0; i < sizeof(doubles) / sizeof(doubles[0]); i++) check_double(doubles[i]);
+    printf("\n");
+    long long big = -9000000000LL;
+    {{ "big_text" | int_to_string : "big" }}
+    {{ "zero_text" | int_to_string : "big * 0" }}
+    printf("%s %s\n", big_text, zero_text);
+    return 0;
+}
+`, sanitize)
+	want := "42:1 -7:1 0:0 0:0 2147483647:1 0:0 -2147483648:1 0:0 \n" +
+		"1.5:1 -2000:1 0:0 0:0 0:0 0:0 \n" +
+		"-9000000000 0\n"
+	if out != want {
+		t.Errorf("got output\n%s\nwant\n%s", out, want)
+	}
+}
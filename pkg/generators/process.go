@@ -0,0 +1,157 @@
+package generators
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func init() {
+	Register(InitProcessFilters)
+}
+
+// Exit statuses follow the shell: the exit code when the child exited,
+// 128 + the signal number when a signal killed it.
+func InitProcessFilters() error {
+	var errs []error
+
+	// Run a command through /bin/sh and capture its standard output, NUL
+	// terminated. Declares the AUTO_FREE output and the int exit status.
+	// Only use it with trusted commands; see shell_escape and
+	// run_command_argv. Needs {{ "" | auto_free_generic }}.
+	// Example usage:
+	// {{ "listing,status" | run_command : "ls -l /tmp" }}
+	// {{ "output,status" | run_command : "$cmd" }}
+	errs = append(errs, registerFilter("run_command", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		parts := strings.Split(in.String(), ",")
+		if len(parts) != 2 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("run_command needs out,status as input")}
+		}
+		out, status := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		code := fmt.Sprintf(
+			`AUTO_FREE char *%[1]s = NULL;
+int %[2]s = -1;
+{
+    const char *cmd_%[1]s = %[3]s;
+    FILE *pipe_%[1]s = popen(cmd_%[1]s, "r");
+    if (!pipe_%[1]s) {
+        fprintf(stderr, "Failed to run command: %%s: %%s\n", cmd_%[1]s, strerror(errno));
+        exit(EXIT_FAILURE);
+    }
+    size_t len_%[1]s = 0, cap_%[1]s = 4096;
+    %[1]s = malloc(cap_%[1]s + 1);
+    if (!%[1]s) {
+        fprintf(stderr, "Failed to get memory for %[1]s\n");
+        pclose(pipe_%[1]s);
+        exit(EXIT_FAILURE);
+    }
+    for (;;) {
+        size_t n_%[1]s = fread(%[1]s + len_%[1]s, 1, cap_%[1]s - len_%[1]s, pipe_%[1]s);
+        len_%[1]s += n_%[1]s;
+        if (len_%[1]s < cap_%[1]s) {
+            break;
+        }
+        char *grown_%[1]s = realloc(%[1]s, cap_%[1]s * 2 + 1);
+        if (!grown_%[1]s) {
+            fprintf(stderr, "Failed to get memory for %[1]s\n");
+            free(%[1]s);
+            pclose(pipe_%[1]s);
+            exit(EXIT_FAILURE);
+        }
+        %[1]s = grown_%[1]s;
+        cap_%[1]s = cap_%[1]s * 2;
+    }
+    %[1]s[len_%[1]s] = '\0';
+    int wait_%[1]s = pclose(pipe_%[1]s);
+    if (wait_%[1]s == -1) {
+        fprintf(stderr, "Failed to wait for command: %%s: %%s\n", cmd_%[1]s, strerror(errno));
+        exit(EXIT_FAILURE);
+    }
+    %[2]s = WIFEXITED(wait_%[1]s) ? WEXITSTATUS(wait_%[1]s) : 128 + WTERMSIG(wait_%[1]s);
+}`,
+			out, status, quoteIfLiteral(param.String()))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Run a program without a shell, so arguments from user input can't
+	// inject commands. The parameter is a NULL-terminated char *argv[];
+	// argv[0] is looked up in PATH. The child inherits stdin/stdout/stderr.
+	// Declares the int exit status, 127 when the program can't be run.
+	// Example usage:
+	// char *args[] = {"grep", "-c", pattern, path, NULL};
+	// {{ "status" | run_command_argv : "args" }}
+	errs = append(errs, registerFilter("run_command_argv", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		argv := strings.TrimSpace(param.String())
+		if argv == "" {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("run_command_argv needs an argv array")}
+		}
+		code := fmt.Sprintf(
+			`int %[1]s = -1;
+{
+    char **argv_%[1]s = %[2]s;
+    fflush(NULL);
+    pid_t pid_%[1]s = fork();
+    if (pid_%[1]s == -1) {
+        perror("fork");
+        exit(EXIT_FAILURE);
+    }
+    if (pid_%[1]s == 0) {
+        execvp(argv_%[1]s[0], argv_%[1]s);
+        fprintf(stderr, "Failed to run %%s: %%s\n", argv_%[1]s[0], strerror(errno));
+        _exit(127);
+    }
+    int wait_%[1]s;
+    while (waitpid(pid_%[1]s, &wait_%[1]s, 0) == -1) {
+        if (errno != EINTR) {
+            perror("waitpid");
+            exit(EXIT_FAILURE);
+        }
+    }
+    %[1]s = WIFEXITED(wait_%[1]s) ? WEXITSTATUS(wait_%[1]s) : 128 + WTERMSIG(wait_%[1]s);
+}`,
+			in.String(), argv)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Single-quote a string for /bin/sh, for when run_command can't be
+	// avoided: 'it'\''s' for it's. NULL stays NULL. Needs
+	// {{ "" | auto_free_generic }}.
+	// Example usage:
+	// {{ "quoted" | shell_escape : "$filename" }}
+	errs = append(errs, registerFilter("shell_escape", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(
+			`AUTO_FREE char *%[1]s = NULL;
+{
+    const char *esc_src_%[1]s = %[2]s;
+    if (esc_src_%[1]s) {
+        size_t esc_len_%[1]s = 2;
+        for (const char *c = esc_src_%[1]s; *c; c++) {
+            esc_len_%[1]s += *c == '\'' ? 4 : 1;
+        }
+        %[1]s = malloc(esc_len_%[1]s + 1);
+        if (!%[1]s) {
+            fprintf(stderr, "Failed to get memory for %[1]s\n");
+            exit(EXIT_FAILURE);
+        }
+        char *esc_out_%[1]s = %[1]s;
+        *esc_out_%[1]s++ = '\'';
+        for (const char *c = esc_src_%[1]s; *c; c++) {
+            if (*c == '\'') {
+                memcpy(esc_out_%[1]s, "'\\''", 4);
+                esc_out_%[1]s += 4;
+            } else {
+                *esc_out_%[1]s++ = *c;
+            }
+        }
+        *esc_out_%[1]s++ = '\'';
+        *esc_out_%[1]s = '\0';
+    }
+}`,
+			in.String(), quoteIfLiteral(param.String()))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,46 @@
+package generators
+
+import "testing"
+
+func TestRunCommand(t *testing.T) {
+	out := renderAndRun(t, `{{ "" | auto_free_generic }}
+int main(void) {
+    {{ "hello,hello_status" | run_command : "echo hello" }}
+    printf("[%s] %d\n", hello, hello_status);
+    {{ "none,failed" | run_command : "echo partial; exit 3" }}
+    printf("[%s] %d\n", none, failed);
+    const char *cmd = "kill -TERM $$";
+    {{ "killed_out,killed" | run_command : "$cmd" }}
+    printf("[%s] %d\n", killed_out, killed);
+    {{ "big,big_status" | run_command : "seq 1 5000" }}
+    printf("%zu %d %.2s\n", strlen(big), big_status, big + strlen(big) - 5);
+    return 0;
+}
+`, sanitize)
+	// seq 1 5000 prints 9 + 90*2 + 900*3 + 4001*4 digits plus 5000 newlines.
+	if want := "[hello\n] 0\n[partial\n] 3\n[] 143\n23893 0 50\n"; out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+}
+
+func TestRunCommandArgv(t *testing.T) {
+	out := renderAndRun(t, `{{ "" | auto_free_generic }}
+int main(void) {
+    char *ok_args[] = {"sh", "-c", "exit 0", NULL};
+    char *fail_args[] = {"sh", "-c", "exit 42", NULL};
+    char *missing_args[] = {"cccp-no-such-program", NULL};
+    {{ "ok" | run_command_argv : "ok_args" }}
+    {{ "failed" | run_command_argv : "fail_args" }}
+    {{ "missing" | run_command_argv : "missing_args" }}
+    const char *name = "it's a \"file\"";
+    {{ "quoted" | shell_escape : "$name" }}
+    {% format_alloc "cmd" "printf '%%s' %s" "$quoted" %}
+    {{ "echoed,echo_status" | run_command : "$cmd" }}
+    printf("%d %d %d [%s] %d\n", ok, failed, missing, echoed, strcmp(echoed, name) == 0);
+    return 0;
+}
+`, sanitize)
+	if want := "0 42 127 [it's a \"file\"] 1\n"; out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+}
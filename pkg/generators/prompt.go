@@ -0,0 +1,176 @@
+package generators
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func init() {
+	Register(InitPromptFilters)
+}
+
+// Prompts are written to stdout and answers read a line at a time from
+// stdin, without the newline. Prompt text is quoted for you, trailing
+// spaces included.
+func InitPromptFilters() error {
+	var errs []error
+
+	// Declares char out[max_len], empty at end of input. Whatever doesn't
+	// fit in the buffer is read and dropped.
+	// Example usage:
+	// {{ "name" | prompt_string : "64,Your name: " }}
+	errs = append(errs, registerFilter("prompt_string", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		parts := strings.SplitN(param.String(), ",", 2)
+		if len(parts) != 2 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("prompt_string needs max_len,prompt")}
+		}
+		out := in.String()
+		code := fmt.Sprintf(
+			`char %[1]s[%[2]s];
+{
+%[3]s
+}`,
+			out, strings.TrimSpace(parts[0]), promptReadLine(out, quoteText(parts[1])))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Declares value (int) and ok (bool), asking up to three times until
+	// the answer parses as with parse_int. ok is false after three bad
+	// answers or at end of input.
+	// Example usage:
+	// {{ "age,age_ok" | prompt_int : "Age: " }}
+	errs = append(errs, registerFilter("prompt_int", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		value, ok, err := parseNumberOutputs("prompt_int", in)
+		if err != nil {
+			return nil, err
+		}
+		line := "line_" + value
+		code := fmt.Sprintf(
+			`int %[1]s = 0;
+bool %[2]s = false;
+for (int attempt_%[1]s = 0; attempt_%[1]s < 3 && !%[2]s; attempt_%[1]s++) {
+    char %[3]s[64];
+%[4]s
+    if (feof(stdin) && %[3]s[0] == '\0') {
+        break;
+    }
+    char *end_%[1]s;
+    errno = 0;
+    long parsed_%[1]s = strtol(%[3]s, &end_%[1]s, 10);
+    if (errno == 0 && end_%[1]s != %[3]s && *end_%[1]s == '\0' &&
+        parsed_%[1]s >= INT_MIN && parsed_%[1]s <= INT_MAX) {
+        %[1]s = (int)parsed_%[1]s;
+        %[2]s = true;
+    } else {
+        printf("Please enter a whole number.\n");
+    }
+}`,
+			value, ok, line, promptReadLine(line, quoteText(param.String())))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Declares a bool from a yes/no question. The default ("y" or "n") is
+	// used for an empty answer or end of input, and shown as [Y/n] or
+	// [y/N] after the prompt. Other answers ask again.
+	// Example usage:
+	// {{ "overwrite" | confirm : "n,Overwrite existing file?" }}
+	errs = append(errs, registerFilter("confirm", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		parts := strings.SplitN(param.String(), ",", 2)
+		if len(parts) != 2 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("confirm needs default,prompt")}
+		}
+		var def, hint string
+		switch d := strings.ToLower(strings.TrimSpace(parts[0])); d {
+		case "y", "yes":
+			def, hint = "true", " [Y/n] "
+		case "n", "no":
+			def, hint = "false", " [y/N] "
+		default:
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("confirm default must be y or n, got %q", d)}
+		}
+		out := in.String()
+		line := "line_" + out
+		prompt := cStringLiteral(strings.TrimSpace(parts[1]) + hint)
+		code := fmt.Sprintf(
+			`bool %[1]s = %[2]s;
+for (;;) {
+    char %[3]s[16];
+%[4]s
+    if (%[3]s[0] == '\0') {
+        break;
+    }
+    if (strcasecmp(%[3]s, "y") == 0 || strcasecmp(%[3]s, "yes") == 0) {
+        %[1]s = true;
+        break;
+    }
+    if (strcasecmp(%[3]s, "n") == 0 || strcasecmp(%[3]s, "no") == 0) {
+        %[1]s = false;
+        break;
+    }
+}`,
+			out, def, line, promptReadLine(line, prompt))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Like prompt_string with echo turned off when stdin is a terminal.
+	// Echo is restored on every way out, including end of input and a
+	// read interrupted by a signal, so a SIGINT handler from on_signal or
+	// graceful_shutdown leaves the terminal usable. Clear the buffer with
+	// memset when done.
+	// Example usage:
+	// {{ "password" | prompt_password : "128,Password: " }}
+	errs = append(errs, registerFilter("prompt_password", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		parts := strings.SplitN(param.String(), ",", 2)
+		if len(parts) != 2 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("prompt_password needs max_len,prompt")}
+		}
+		out := in.String()
+		code := fmt.Sprintf(
+			`char %[1]s[%[2]s];
+{
+    struct termios saved_%[1]s;
+    bool restore_%[1]s = false;
+    if (tcgetattr(STDIN_FILENO, &saved_%[1]s) == 0) {
+        struct termios quiet_%[1]s = saved_%[1]s;
+        quiet_%[1]s.c_lflag &= ~(tcflag_t)ECHO;
+        quiet_%[1]s.c_lflag |= ECHONL;
+        restore_%[1]s = tcsetattr(STDIN_FILENO, TCSAFLUSH, &quiet_%[1]s) == 0;
+    }
+%[3]s
+    if (restore_%[1]s) {
+        tcsetattr(STDIN_FILENO, TCSAFLUSH, &saved_%[1]s);
+    }
+}`,
+			out, strings.TrimSpace(parts[0]), promptReadLine(out, quoteText(parts[1])))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	return errors.Join(errs...)
+}
+
+// promptReadLine prints a prompt and reads one line into the char array
+// buf, dropping the newline and anything past the buffer. buf is left
+// empty at end of input or when a signal interrupts the read.
+func promptReadLine(buf, prompt string) string {
+	return fmt.Sprintf(
+		`    fputs(%[2]s, stdout);
+    fflush(stdout);
+    if (!fgets(%[1]s, sizeof(%[1]s), stdin)) {
+        %[1]s[0] = '\0';
+        if (ferror(stdin)) {
+            clearerr(stdin);
+        }
+    } else {
+        size_t len_%[1]s = strcspn(%[1]s, "\n");
+        if (%[1]s[len_%[1]s] != '\n') {
+            int c;
+            while ((c = getchar()) != '\n' && c != EOF) {
+            }
+        }
+        %[1]s[len_%[1]s] = '\0';
+    }`,
+		buf, prompt)
+}
@@ -0,0 +1,95 @@
+package generators
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPromptFilters(t *testing.T) {
+	src, libs := render(t, `int main(void) {
+    {{ "name" | prompt_string : "8,Name: " }}
+    printf("[%s]\n", name);
+    {{ "age,age_ok" | prompt_int : "Age: " }}
+    printf("[%d %d]\n", age, age_ok);
+    {{ "sure" | confirm : "y,Sure?" }}
+    printf("[%d]\n", sure);
+    {{ "secret" | prompt_password : "16,Password: " }}
+    printf("[%s]\n", secret);
+    return 0;
+}
+`)
+	if !strings.Contains(src, `fputs("Sure? [Y/n] ", stdout);`) {
+		t.Errorf("confirm doesn't show the default:\n%s", numbered(src))
+	}
+	bin := compileC(t, src, libs, sanitize)
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "answers",
+			input: "Ada\n42\nn\nhunter2\n",
+			want:  "Name: [Ada]\nAge: [42 1]\nSure? [Y/n] [0]\nPassword: [hunter2]\n",
+		},
+		{
+			name:  "long name is cut and the rest dropped",
+			input: "Ada Lovelace\n7\n\n",
+			want:  "Name: [Ada Lov]\nAge: [7 1]\nSure? [Y/n] [1]\nPassword: []\n",
+		},
+		{
+			name:  "int asks again",
+			input: "x\nabc\n12x\n-3\nmaybe\nYES\n",
+			want: "Name: [x]\nAge: Please enter a whole number.\nAge: Please enter a whole number.\nAge: [-3 1]\n" +
+				"Sure? [Y/n] Sure? [Y/n] [1]\nPassword: []\n",
+		},
+		{
+			name:  "int gives up after three",
+			input: "x\na\nb\nc\nN\n",
+			want: "Name: [x]\nAge: Please enter a whole number.\nAge: Please enter a whole number.\n" +
+				"Age: Please enter a whole number.\n[0 0]\nSure? [Y/n] [0]\nPassword: []\n",
+		},
+		{
+			name:  "end of input",
+			input: "",
+			want:  "Name: []\nAge: [0 0]\nSure? [Y/n] [1]\nPassword: []\n",
+		},
+		{
+			name:  "last line without newline",
+			input: "Bob",
+			want:  "Name: [Bob]\nAge: [0 0]\nSure? [Y/n] [1]\nPassword: []\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, code := runCInput(t, bin, "", tt.input)
+			if code != 0 {
+				t.Fatalf("program exited %d: %s", code, stderr)
+			}
+			if stdout != tt.want {
+				t.Errorf("got\n%q\nwant\n%q", stdout, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromptPasswordRestoresEcho(t *testing.T) {
+	// Needs a terminal to run, so only check that the echo handling is
+	// generated and compiles.
+	src, _ := render(t, `int main(void) {
+    {{ "password" | prompt_password : "128,Password: " }}
+    memset(password, 0, sizeof(password));
+    return 0;
+}
+`)
+	syntaxCheck(t, src)
+	for _, want := range []string{
+		"quiet_password.c_lflag &= ~(tcflag_t)ECHO;",
+		"tcsetattr(STDIN_FILENO, TCSAFLUSH, &saved_password);",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("prompt_password output lacks %s:\n%s", want, numbered(src))
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package generators
+
+import (
+	"fmt"
+	"strings"
+)
+
+// cVar returns the C expression of an argument marked with a leading $
+// ($path, $entry->d_name, $argv[1]), and false for any other argument.
+func cVar(arg string) (string, bool) {
+	arg = strings.TrimSpace(arg)
+	if !strings.HasPrefix(arg, "$") {
+		return "", false
+	}
+	return strings.TrimSpace(arg[1:]), true
+}
+
+// quoteIfLiteral turns a filter argument into a C string expression: a
+// $-marked variable is used as is, anything else is text and becomes a
+// string literal unless it is already quoted. The marker is required
+// because a bare word like fixtures is as likely a name as a variable.
+func quoteIfLiteral(arg string) string {
+	if expr, ok := cVar(arg); ok {
+		return expr
+	}
+	return quoteString(arg)
+}
+
+// quoteString turns s into a C string literal unless it is already quoted.
+func quoteString(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, `"`) && strings.HasSuffix(s, `"`) && len(s) >= 2 {
+		return s
+	}
+	return cStringLiteral(s)
+}
+
+// quoteText is quoteString for arguments that aren't comma-split, so
+// leading and trailing spaces are part of the text and are kept.
+func quoteText(s string) string {
+	if trimmed := strings.TrimSpace(s); strings.HasPrefix(trimmed, `"`) && strings.HasSuffix(trimmed, `"`) && len(trimmed) >= 2 {
+		return trimmed
+	}
+	return cStringLiteral(s)
+}
+
+// cStringLiteral quotes s as a C string literal.
+func cStringLiteral(s string) string {
+	return `"` + cEscape(s) + `"`
+}
+
+// cEscape escapes s for use inside a C string literal: quotes, backslashes
+// and control characters. Octal escapes are used for the latter because,
+// unlike \x, they can't swallow a following hex digit.
+func cEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if c < 0x20 || c == 0x7f {
+				fmt.Fprintf(&b, `\%03o`, c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	return b.String()
+}
+
+// cFormatEscape is cEscape for text spliced into a printf-style format
+// string, where a % would otherwise be read as a conversion.
+func cFormatEscape(s string) string {
+	return strings.ReplaceAll(cEscape(s), "%", "%%")
+}
+
+// splitArgs splits a filter parameter on commas outside double-quoted
+// segments, so "buf,n,\"%d, %d\",a,b" gives four arguments with the format
+// intact. A backslash inside quotes escapes the next character.
+func splitArgs(s string) []string {
+	var args []string
+	start, inQuote := 0, false
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if inQuote {
+				i++
+			}
+		case '"':
+			inQuote = !inQuote
+		case ',':
+			if !inQuote {
+				args = append(args, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(args, s[start:])
+}
@@ -0,0 +1,112 @@
+package generators
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func TestQuoteIfLiteral(t *testing.T) {
+	tests := []struct {
+		arg, want string
+	}{
+		{"fixtures", `"fixtures"`},
+		{"hello", `"hello"`},
+		{" data ", `"data"`},
+		{"config.json", `"config.json"`},
+		{"/tmp/app.lock", `"/tmp/app.lock"`},
+		{`"already quoted"`, `"already quoted"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{"$path", "path"},
+		{" $entry->d_name ", "entry->d_name"},
+		{"$argv[1]", "argv[1]"},
+	}
+	for _, tt := range tests {
+		if got := quoteIfLiteral(tt.arg); got != tt.want {
+			t.Errorf("quoteIfLiteral(%q) = %s, want %s", tt.arg, got, tt.want)
+		}
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"fixtures", []string{"fixtures"}},
+		{"data,r", []string{"data", "r"}},
+		{"$line,,", []string{"$line", "", ""}},
+		{`buf,n,"%d, %d",a,b`, []string{"buf", "n", `"%d, %d"`, "a", "b"}},
+		{`buf,n,"a \"b, c\" d",x`, []string{"buf", "n", `"a \"b, c\" d"`, "x"}},
+		{`buf,n,"ends in \\",x`, []string{"buf", "n", `"ends in \\"`, "x"}},
+		{`"unterminated, still one`, []string{`"unterminated, still one`}},
+		{"", []string{""}},
+	}
+	for _, tt := range tests {
+		if got := splitArgs(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitArgs(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCEscape(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`say "hi"`, `say \"hi\"`},
+		{`C:\temp`, `C:\\temp`},
+		{"a\nb\r\tc", `a\nb\r\tc`},
+		{"\x01" + "7", `\0017`},
+		{"del\x7f", `del\177`},
+		{"100%", "100%"},
+		{"héllo", "héllo"},
+	}
+	for _, tt := range tests {
+		if got := cEscape(tt.in); got != tt.want {
+			t.Errorf("cEscape(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+	if got, want := cFormatEscape(`100% "done"`), `100%% \"done\"`; got != want {
+		t.Errorf("cFormatEscape = %s, want %s", got, want)
+	}
+	if got, want := quoteText(`  padded "text"  `), `"  padded \"text\"  "`; got != want {
+		t.Errorf("quoteText = %s, want %s", got, want)
+	}
+}
+
+// hostile is text that breaks C literals unless escaped.
+const hostile = "say \"hi\" \\ 100% done\n\ttab \x01" + "7"
+
+func TestEscapingHostileText(t *testing.T) {
+	src, libs := renderContext(t, `{{ "" | auto_free_generic }}
+{{ "" | generate_rcstring }}
+#include <unistd.h>
+int main(void) {
+    {{ hostile | write_string }}
+    {{ "" | newline }}
+    puts("{{ hostile | cescape }}");
+    printf("{{ hostile | cformat_escape }}\n");
+    {% format_alloc "msg" hostile_format %}
+    puts(msg);
+    {{ "s" | rcstr_new : hostile }}
+    puts(rcstr_cstr(s));
+    {{ "s" | rcstr_unref }}
+    {{ "out" | string_builder }}
+    {{ "out" | builder_append : hostile }}
+    {{ "text" | builder_result : "out" }}
+    puts(text);
+    return 0;
+}
+`, pongo2.Context{"hostile": hostile, "hostile_format": strings.ReplaceAll(hostile, "%", "%%")})
+	bin := compileC(t, src, libs, sanitize)
+	stdout, stderr, code := runC(t, bin, "")
+	if code != 0 {
+		t.Fatalf("program exited %d: %s\n%s", code, stderr, numbered(src))
+	}
+	want := strings.Repeat(hostile+"\n", 6)
+	if stdout != want {
+		t.Errorf("got output %q, want %q", stdout, want)
+	}
+}
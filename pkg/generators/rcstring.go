@@ -0,0 +1,113 @@
+package generators
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func init() {
+	Register(InitRCStringFilters)
+}
+
+// rcstrMode is the value type that makes map_create and list_create store
+// rcstr pointers and unref them when entries are overwritten or removed.
+const rcstrMode = "rcstr"
+
+// containerRelease returns the element type and the body of the
+// <name>_release function that map and list families call on values they
+// drop: rcstr_unref in rcstr mode, nothing otherwise.
+func containerRelease(valueType string) (string, string) {
+	if valueType == rcstrMode {
+		return "rcstr *", "rcstr_unref(value);"
+	}
+	return valueType, "(void)value;"
+}
+
+func InitRCStringFilters() error {
+	var errs []error
+
+	// Immutable reference-counted strings, include once at file scope
+	// (before any rcstr map or list). rcstr_new copies a C string with a
+	// count of 1, rcstr_ref adds a reference, rcstr_unref drops one and
+	// frees the string with the last. Maps and lists created with the
+	// "rcstr" value type own one reference per stored value.
+	// Example usage:
+	// {{ "" | generate_rcstring }}
+	errs = append(errs, registerFilter("generate_rcstring", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := `// The count is a plain size_t, not atomic: an rcstr must not be shared
+// between threads.
+typedef struct rcstr {
+    size_t refs;
+    size_t len;
+    char data[];
+} rcstr;
+
+// NULL gives an empty string.
+static inline rcstr *rcstr_new(const char *s) {
+    size_t len = s ? strlen(s) : 0;
+    rcstr *r = malloc(sizeof(*r) + len + 1);
+    if (!r) {
+        fprintf(stderr, "Failed to get memory for rcstr\n");
+        exit(EXIT_FAILURE);
+    }
+    r->refs = 1;
+    r->len = len;
+    if (len) {
+        memcpy(r->data, s, len);
+    }
+    r->data[len] = '\0';
+    return r;
+}
+
+static inline rcstr *rcstr_ref(rcstr *r) {
+    if (r) {
+        r->refs++;
+    }
+    return r;
+}
+
+static inline void rcstr_unref(rcstr *r) {
+    if (r && --r->refs == 0) {
+        free(r);
+    }
+}
+
+static inline const char *rcstr_cstr(const rcstr *r) {
+    return r ? r->data : NULL;
+}`
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Declares an rcstr* holding a copy of a literal or $-marked char* variable.
+	// Needs {{ "" | generate_rcstring }}.
+	// Example usage:
+	// {{ "greeting" | rcstr_new : "Hello" }}
+	// {{ "owned" | rcstr_new : "$line" }}
+	errs = append(errs, registerFilter("rcstr_new", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf("rcstr *%s = rcstr_new(%s);", in.String(), quoteIfLiteral(param.String()))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Add a reference, optionally declaring a second rcstr* sharing it.
+	// Example usage:
+	// {{ "greeting" | rcstr_ref }}
+	// {{ "alias" | rcstr_ref : "greeting" }}
+	errs = append(errs, registerFilter("rcstr_ref", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		if src := strings.TrimSpace(param.String()); src != "" {
+			return pongo2.AsSafeValue(fmt.Sprintf("rcstr *%s = rcstr_ref(%s);", in.String(), src)), nil
+		}
+		return pongo2.AsSafeValue(fmt.Sprintf("rcstr_ref(%s);", in.String())), nil
+	}))
+
+	// Drop a reference and set the variable to NULL.
+	// Example usage:
+	// {{ "greeting" | rcstr_unref }}
+	errs = append(errs, registerFilter("rcstr_unref", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return pongo2.AsSafeValue(fmt.Sprintf("rcstr_unref(%[1]s);\n%[1]s = NULL;", in.String())), nil
+	}))
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,20 @@
+package generators
+
+import "testing"
+
+func TestRcstrLifecycle(t *testing.T) {
+	out := renderAndRun(t, `{{ "" | generate_rcstring }}
+int main(void) {
+    {{ "greeting" | rcstr_new : "hello" }}
+    {{ "alias" | rcstr_ref : "greeting" }}
+    printf("%s %zu\n", rcstr_cstr(greeting), greeting->refs);
+    {{ "greeting" | rcstr_unref }}
+    printf("%s %zu %d\n", rcstr_cstr(alias), alias->refs, greeting == NULL);
+    {{ "alias" | rcstr_unref }}
+    return 0;
+}
+`, sanitize)
+	if want := "hello 2\nhello 1 1\n"; out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+}
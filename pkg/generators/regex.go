@@ -0,0 +1,109 @@
+package generators
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func init() {
+	Register(InitRegexFilters)
+}
+
+// The regex_* filters use POSIX extended regular expressions. The pattern
+// comes last in the parameter so it may contain commas, and it is always
+// embedded as a C string literal, escaped for you: quotes and backslashes
+// in it reach regcomp as written.
+func InitRegexFilters() error {
+	var errs []error
+
+	// Example usage:
+	// {{ "is_date" | regex_match : "input,^[0-9]{4}-[0-9]{2}-[0-9]{2}$" }}
+	errs = append(errs, registerFilter("regex_match", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		out := in.String()
+		parts := strings.SplitN(param.String(), ",", 2)
+		if len(parts) != 2 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("regex_match needs subject,pattern")}
+		}
+		subject, pattern := strings.TrimSpace(parts[0]), cStringLiteral(strings.TrimSpace(parts[1]))
+
+		code := fmt.Sprintf(
+			`bool %[1]s = false;
+{
+    regex_t re_%[1]s;
+%[3]s
+    const char *subject_%[1]s = %[2]s;
+    %[1]s = subject_%[1]s && regexec(&re_%[1]s, subject_%[1]s, 0, NULL, 0) == 0;
+    regfree(&re_%[1]s);
+}`,
+			out, subject, regexCompile("re_"+out, pattern, "REG_EXTENDED | REG_NOSUB"))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Extract capture group N (0 is the whole match) into an AUTO_FREE copy,
+	// NULL when there is no match or the group didn't participate. Needs
+	// {{ "" | auto_free_generic }}.
+	// Example usage:
+	// {{ "user" | regex_capture : "email,1,^([^@]+)@(.+)$" }}
+	errs = append(errs, registerFilter("regex_capture", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		out := in.String()
+		parts := strings.SplitN(param.String(), ",", 3)
+		if len(parts) != 3 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("regex_capture needs subject,group,pattern")}
+		}
+		subject, pattern := strings.TrimSpace(parts[0]), cStringLiteral(strings.TrimSpace(parts[2]))
+		group, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || group < 0 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("regex_capture group must be a non-negative integer, got %q", parts[1])}
+		}
+
+		groupCheck := "" // group 0 always exists
+		if group > 0 {
+			groupCheck = fmt.Sprintf("re_%s.re_nsub >= %d &&", out, group)
+		}
+
+		code := fmt.Sprintf(
+			`AUTO_FREE char *%[1]s = NULL;
+{
+    regex_t re_%[1]s;
+%[4]s
+    const char *subject_%[1]s = %[2]s;
+    regmatch_t match_%[1]s[%[3]d + 1];
+    if (subject_%[1]s && %[5]s
+        regexec(&re_%[1]s, subject_%[1]s, %[3]d + 1, match_%[1]s, 0) == 0 &&
+        match_%[1]s[%[3]d].rm_so != -1) {
+        size_t len_%[1]s = (size_t)(match_%[1]s[%[3]d].rm_eo - match_%[1]s[%[3]d].rm_so);
+        %[1]s = malloc(len_%[1]s + 1);
+        if (!%[1]s) {
+            fprintf(stderr, "Failed to get memory for %[1]s\n");
+            regfree(&re_%[1]s);
+            exit(EXIT_FAILURE);
+        }
+        memcpy(%[1]s, subject_%[1]s + match_%[1]s[%[3]d].rm_so, len_%[1]s);
+        %[1]s[len_%[1]s] = '\0';
+    }
+    regfree(&re_%[1]s);
+}`,
+			out, subject, group, regexCompile("re_"+out, pattern, "REG_EXTENDED"), groupCheck)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	return errors.Join(errs...)
+}
+
+// regexCompile generates a regcomp call (indented for a block body) that
+// exits with the regerror text when the pattern is invalid.
+func regexCompile(re, pattern, flags string) string {
+	return fmt.Sprintf(
+		`    int rc_%[1]s = regcomp(&%[1]s, %[2]s, %[3]s);
+    if (rc_%[1]s != 0) {
+        char err_%[1]s[256];
+        regerror(rc_%[1]s, &%[1]s, err_%[1]s, sizeof(err_%[1]s));
+        fprintf(stderr, "Invalid regex %%s: %%s\n", %[2]s, err_%[1]s);
+        exit(EXIT_FAILURE);
+    }`,
+		re, pattern, flags)
+}
@@ -0,0 +1,73 @@
+package generators
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func TestRegexPatternIsAlwaysEscaped(t *testing.T) {
+	tests := []struct {
+		tpl, want string
+	}{
+		{`{{ "ok" | regex_match : "input,^[a-z]+$" }}`, `regcomp(&re_ok, "^[a-z]+$", REG_EXTENDED | REG_NOSUB)`},
+		{`{{ "m" | regex_capture : "input,0,\"[^\"]*\"" }}`, `regcomp(&re_m, "\"[^\"]*\"", REG_EXTENDED)`},
+		{`{{ "d" | regex_match : pattern }}`, `regcomp(&re_d, "^[0-9]+\\.[0-9]+$", REG_EXTENDED | REG_NOSUB)`},
+	}
+	for _, tt := range tests {
+		src, _ := renderContext(t, tt.tpl, pongo2.Context{"pattern": `input,^[0-9]+\.[0-9]+$`})
+		if !strings.Contains(src, tt.want) {
+			t.Errorf("%s gave\n%s\nwant it to contain %s", tt.tpl, src, tt.want)
+		}
+	}
+}
+
+func TestRegexMatchAndCapture(t *testing.T) {
+	src, libs := renderContext(t, `{{ "" | auto_free_generic }}
+int main(void) {
+    const char *input = "2024-05-01";
+    const char *email = "ada@example.com";
+    const char *quoted = "say \"hi\" to C:\\tmp";
+    const char *none = NULL;
+    {{ "is_date" | regex_match : "input,^[0-9]{4}-[0-9]{2}-[0-9]{2}$" }}
+    {{ "is_email" | regex_match : "input,@" }}
+    {{ "null_match" | regex_match : "none,.*" }}
+    {{ "user" | regex_capture : "email,1,^([^@]+)@(.+)$" }}
+    {{ "domain" | regex_capture : "email,2,^([^@]+)@(.+)$" }}
+    {{ "missing" | regex_capture : "input,1,^([a-z]+)@" }}
+    {{ "too_far" | regex_capture : "email,3,^([^@]+)@(.+)$" }}
+    {{ "inner" | regex_capture : quote_pattern }}
+    {{ "dir" | regex_capture : slash_pattern }}
+    printf("%d %d %d\n", is_date, is_email, null_match);
+    printf("%s %s %d %d\n", user, domain, missing == NULL, too_far == NULL);
+    printf("[%s] [%s]\n", inner, dir);
+    return 0;
+}
+`, pongo2.Context{
+		"quote_pattern": `quoted,1,"([^"]*)"`,
+		"slash_pattern": `quoted,0,[A-Z]:\\[a-z]+`,
+	})
+	bin := compileC(t, src, libs, sanitize)
+	stdout, stderr, code := runC(t, bin, "")
+	if code != 0 {
+		t.Fatalf("program exited %d: %s\n%s", code, stderr, numbered(src))
+	}
+	if want := "1 0 0\nada example.com 1 1\n[hi] [C:\\tmp]\n"; stdout != want {
+		t.Errorf("got stdout %q, want %q", stdout, want)
+	}
+}
+
+func TestRegexInvalidPatternReportsRegerror(t *testing.T) {
+	src, libs := render(t, `int main(void) {
+    const char *input = "x";
+    {{ "bad" | regex_match : "input,([a-z]" }}
+    return bad ? 0 : 3;
+}
+`)
+	bin := compileC(t, src, libs, sanitize)
+	_, stderr, code := runC(t, bin, "")
+	if code != 1 || !strings.HasPrefix(stderr, "Invalid regex ([a-z]: ") || len(stderr) <= len("Invalid regex ([a-z]: \n") {
+		t.Errorf("got exit %d, stderr %q; want exit 1 with the regerror text", code, stderr)
+	}
+}
@@ -1,13 +1,35 @@
 package generators
 
-var initializers []func()
+import (
+	"errors"
+	"sync"
+)
 
-func Register(initFunc func()) {
+var (
+	initializers []func() error
+	initOnce     sync.Once
+	initErr      error
+)
+
+// Register adds an initializer that registers a family of filters and
+// tags. Names share one flat pongo2 namespace, so they carry their family
+// as an underscore prefix (string_trim, json_get_int, http_post); pongo2
+// refuses a second registration under the same name, which makes a
+// collision an InitAll error rather than a silent override.
+func Register(initFunc func() error) {
 	initializers = append(initializers, initFunc)
 }
 
-func InitAll() {
-	for _, init := range initializers {
-		init()
-	}
+// InitAll runs every registered initializer and returns their combined
+// errors. Only the first call does any work; later calls return the same
+// result, so it is safe to call from several places.
+func InitAll() error {
+	initOnce.Do(func() {
+		var errs []error
+		for _, init := range initializers {
+			errs = append(errs, init())
+		}
+		initErr = errors.Join(errs...)
+	})
+	return initErr
 }
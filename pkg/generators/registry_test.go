@@ -0,0 +1,84 @@
+package generators
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func TestInitAllIsIdempotent(t *testing.T) {
+	// A second run of the initializers would fail on every name, so two
+	// clean calls show only the first one did any work.
+	for i := 0; i < 2; i++ {
+		if err := InitAll(); err != nil {
+			t.Fatalf("InitAll call %d: %v", i+1, err)
+		}
+	}
+	if !pongo2.FilterExists("string_trim") {
+		t.Error("InitAll did not register the built-in filters")
+	}
+}
+
+func TestDuplicateRegistration(t *testing.T) {
+	if err := InitAll(); err != nil {
+		t.Fatalf("InitAll: %v", err)
+	}
+	noop := func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return in, nil
+	}
+	err := registerFilter("string_trim", noop)
+	if err == nil || !strings.Contains(err.Error(), `registering filter "string_trim"`) ||
+		!strings.Contains(err.Error(), "already") {
+		t.Errorf("duplicate filter: got %v, want an error naming string_trim", err)
+	}
+
+	err = registerCgen("safe_fopen", safeFopen)
+	if err == nil || !strings.Contains(err.Error(), `cgen generator "safe_fopen" registered twice`) {
+		t.Errorf("duplicate cgen generator: got %v, want an error naming safe_fopen", err)
+	}
+
+	err = registerTag("cgen", checkBounds)
+	if err == nil || !strings.Contains(err.Error(), `registering tag "cgen"`) {
+		t.Errorf("duplicate tag: got %v, want an error naming cgen", err)
+	}
+}
+
+func TestRegisteredNameConvention(t *testing.T) {
+	if err := InitAll(); err != nil {
+		t.Fatalf("InitAll: %v", err)
+	}
+	valid := regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)*$`)
+	for name := range requirements {
+		if !valid.MatchString(name) {
+			t.Errorf("%q isn't a lowercase underscore-separated name", name)
+		}
+		if pongo2.FilterExists(name) {
+			continue
+		}
+		// Not a filter, so it has to parse as a tag.
+		if _, err := pongo2.FromString("{% " + name + " %}"); err != nil && strings.Contains(err.Error(), "not found") {
+			t.Errorf("%q is neither a filter nor a tag: %v", name, err)
+		}
+	}
+}
+
+func TestFamilyPrefixedNamesRender(t *testing.T) {
+	src, libs := render(t, `{{ "name" | string_trim : "$raw" }}
+{{ "port" | json_get_int : "config,server.port" }}
+{{ "reply" | http_post : "https://example.com/api,application/json,$payload" }}
+`)
+	for _, want := range []string{
+		"const char *trim_src_name = raw;",
+		`cJSON_GetObjectItemCaseSensitive(node_port, "server")`,
+		`curl_easy_setopt(curl_reply, CURLOPT_URL, "https://example.com/api")`,
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("rendered C lacks %s:\n%s", want, numbered(src))
+		}
+	}
+	if got := strings.Join(libs, " "); got != "-lcjson -lcurl" {
+		t.Errorf("libs = %q, want -lcjson -lcurl", got)
+	}
+}
@@ -0,0 +1,98 @@
+package generators
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func init() {
+	Register(InitSignalFilters)
+}
+
+// Signals are handled with the async-signal-safe pattern: the handler only
+// sets a volatile sig_atomic_t flag that the program polls. signal_flag
+// declares the flag and its handler at file scope; on_signal and
+// graceful_shutdown install that handler from inside a function.
+func InitSignalFilters() error {
+	var errs []error
+
+	// Declares the flag and <flag>_handler. Asking for the same flag again
+	// in one file emits nothing, so templates can include it freely.
+	// Example usage:
+	// {{ "shutdown_requested" | signal_flag }}
+	errs = append(errs, registerFilter("signal_flag", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		flag := strings.TrimSpace(in.String())
+		if !firstUse("signal_flag:" + flag) {
+			return pongo2.AsSafeValue(""), nil
+		}
+		code := fmt.Sprintf(
+			`static volatile sig_atomic_t %[1]s = 0;
+
+static void %[1]s_handler(int sig) {
+    (void)sig;
+    %[1]s = 1;
+}`,
+			flag)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Set the flag when the signal arrives. Add "restart" to resume
+	// interrupted system calls (SA_RESTART) instead of failing them with
+	// EINTR. Needs {{ "flag" | signal_flag }}.
+	// Example usage:
+	// {{ "reload_requested" | on_signal : "SIGHUP" }}
+	// {{ "child_exited" | on_signal : "SIGCHLD,restart" }}
+	errs = append(errs, registerFilter("on_signal", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		parts := strings.Split(param.String(), ",")
+		if len(parts) > 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("on_signal needs signal[,restart]")}
+		}
+		restart := false
+		if len(parts) == 2 {
+			switch mode := strings.TrimSpace(parts[1]); mode {
+			case "restart":
+				restart = true
+			case "norestart", "":
+			default:
+				return nil, &pongo2.Error{OrigError: fmt.Errorf("on_signal mode must be restart or norestart, got %q", mode)}
+			}
+		}
+		return pongo2.AsSafeValue(sigactionCode(strings.TrimSpace(in.String()), strings.TrimSpace(parts[0]), restart)), nil
+	}))
+
+	// Set the flag on SIGINT or SIGTERM, for loops like
+	// while (!shutdown_requested) { ... }. Blocking calls are interrupted
+	// so the loop notices promptly. Needs {{ "flag" | signal_flag }}.
+	// Example usage:
+	// {{ "shutdown_requested" | graceful_shutdown }}
+	errs = append(errs, registerFilter("graceful_shutdown", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		flag := strings.TrimSpace(in.String())
+		code := sigactionCode(flag, "SIGINT", false) + "\n" + sigactionCode(flag, "SIGTERM", false)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	return errors.Join(errs...)
+}
+
+func sigactionCode(flag, signal string, restart bool) string {
+	flags := "0"
+	if restart {
+		flags = "SA_RESTART"
+	}
+	return fmt.Sprintf(
+		`{
+    struct sigaction sa_%[1]s;
+    memset(&sa_%[1]s, 0, sizeof(sa_%[1]s));
+    sa_%[1]s.sa_handler = %[1]s_handler;
+    sigemptyset(&sa_%[1]s.sa_mask);
+    sa_%[1]s.sa_flags = %[3]s;
+    if (sigaction(%[2]s, &sa_%[1]s, NULL) == -1) {
+        perror("sigaction %[2]s");
+        exit(EXIT_FAILURE);
+    }
+}`,
+		flag, signal, flags)
+}
@@ -0,0 +1,88 @@
+package generators
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestGracefulShutdown(t *testing.T) {
+	src, libs := render(t, `#include <errno.h>
+#include <unistd.h>
+{{ "shutdown_requested" | signal_flag }}
+{{ "shutdown_requested" | signal_flag }}
+int main(void) {
+    {{ "shutdown_requested" | graceful_shutdown }}
+    printf("ready\n");
+    fflush(stdout);
+    int interrupted = 0;
+    while (!shutdown_requested) {
+        char c;
+        if (read(STDIN_FILENO, &c, 1) == -1 && errno == EINTR) {
+            interrupted++;
+        }
+    }
+    printf("clean shutdown after %d interrupted read\n", interrupted);
+    return 0;
+}
+`)
+	if strings.Count(src, "shutdown_requested_handler(int sig)") != 1 {
+		t.Fatalf("signal_flag defined the handler more than once:\n%s", numbered(src))
+	}
+	bin := compileC(t, src, libs, sanitize)
+
+	for _, sig := range []syscall.Signal{syscall.SIGINT, syscall.SIGTERM} {
+		t.Run(sig.String(), func(t *testing.T) {
+			cmd := exec.Command(bin)
+			// Keep stdin open so the loop blocks in read until the signal.
+			stdin, err := cmd.StdinPipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer stdin.Close()
+			stdout, err := cmd.StdoutPipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			cmd.Stderr = os.Stderr
+			if err := cmd.Start(); err != nil {
+				t.Fatal(err)
+			}
+			lines := bufio.NewScanner(stdout)
+			if !lines.Scan() || lines.Text() != "ready" {
+				cmd.Process.Kill()
+				cmd.Wait()
+				t.Fatalf("program didn't start: %q %v", lines.Text(), lines.Err())
+			}
+			// The handler is installed before "ready" is printed, but give
+			// the program a moment to block in read.
+			time.Sleep(50 * time.Millisecond)
+			if err := cmd.Process.Signal(sig); err != nil {
+				t.Fatal(err)
+			}
+
+			var rest []string
+			for lines.Scan() {
+				rest = append(rest, lines.Text())
+			}
+			waited := make(chan error, 1)
+			go func() { waited <- cmd.Wait() }()
+			select {
+			case err := <-waited:
+				if err != nil {
+					t.Errorf("program didn't exit cleanly: %v", err)
+				}
+			case <-time.After(10 * time.Second):
+				cmd.Process.Kill()
+				t.Fatal("program still running after the signal")
+			}
+			if want := "clean shutdown after 1 interrupted read"; strings.Join(rest, "\n") != want {
+				t.Errorf("got %q, want %q", rest, want)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package generators
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
@@ -11,34 +12,26 @@ func init() {
 	Register(InitStringFilters)
 }
 
-func InitStringFilters() {
-	// Example usage:
-	// char src[] = "Hello World";
-	// char dest[20]; // Must be declared first!
-	//
-	// strncpy(dest, src, sizeof(dest) - 1);
-	// dest[sizeof(dest) - 1] = '\0';
-	//
-	// printf("Source: %s\n", src);
-	// printf("Copy: %s\n", dest);
-	pongo2.RegisterFilter("string_copy", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
-		dest := in.String()
-		src := param.String()
-		code := fmt.Sprintf("strncpy(%[1]s, %[2]s, sizeof(%[1]s) - 1);\n%[1]s[sizeof(%[1]s) - 1] = '\\0';",
-			dest, src)
-		return pongo2.AsSafeValue(code), nil
-	})
+func InitStringFilters() error {
+	var errs []error
 
 	// Example usage: --> Needs {{ "" | auto_free_generic }}
 	// const char* original_name = "Hello World";
-	// {{ "uppercase_copy" | string_upper_copy : "original_name" }}
+	// {{ "uppercase_copy" | string_upper_copy : "$original_name" }}
 	// printf("%s\n", uppercase_copy);
-	pongo2.RegisterFilter("string_upper_copy", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	// Or allocate from an arena (see arena_create) instead:
+	// {{ "uppercase_copy" | string_upper_copy : "$original_name,scratch" }}
+	errs = append(errs, registerFilter("string_upper_copy", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
 		dest := in.String()
-		src := param.String()
+		src, arena := arenaTarget(param.String())
+		src = quoteIfLiteral(src)
+		decl, copyExpr := "AUTO_FREE char *", fmt.Sprintf("%[1]s ? strdup(%[1]s) : NULL", src)
+		if arena != "" {
+			decl, copyExpr = "char *", fmt.Sprintf("%s_strdup(%s)", arena, src)
+		}
 		code := fmt.Sprintf(
 			`// copy a string and make it uppercase
-AUTO_FREE char *%[1]s = %[2]s ? strdup(%[2]s) : NULL;
+%[3]s%[1]s = %[2]s;
 if (%[1]s) {
     size_t len = strlen(%[1]s);
     for (size_t i = 0; i < len; i++) {  // Explicit length check
@@ -46,31 +39,44 @@ if (%[1]s) {
     }
     %[1]s[len] = '\0';  // Ensure null termination
 }`,
-			dest, src) // This line was missing the closing parenthesis
+			dest, copyExpr, decl) // This line was missing the closing parenthesis
 		return pongo2.AsSafeValue(code), nil
-	})
+	}))
 
 	// Example usage:
 	// {{ "Sensor reading: " | write_string }}
 	// {{ "42" | write_string }}
 	// {{ " units" | write_string }}
 	// Only provide write_string for optimal output
-	pongo2.RegisterFilter("write_string", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
-		str := in.String()
-		return pongo2.AsSafeValue(fmt.Sprintf(`write(1, "%s", %d);`, str, len(str))), nil
-	})
+	errs = append(errs, registerFilter("write_string", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		lit := cStringLiteral(in.String())
+		return pongo2.AsSafeValue(fmt.Sprintf(`write(1, %[1]s, sizeof(%[1]s) - 1);`, lit)), nil
+	}))
+
+	// Escape text for use inside a C string literal written directly in a
+	// template. cformat_escape also doubles %, for text inside a printf
+	// format.
+	// Example usage:
+	// puts("{{ title | cescape }}");
+	// printf("{{ title | cformat_escape }}: %d\n", count);
+	errs = append(errs, registerFilter("cescape", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return pongo2.AsSafeValue(cEscape(in.String())), nil
+	}))
+	errs = append(errs, registerFilter("cformat_escape", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return pongo2.AsSafeValue(cFormatEscape(in.String())), nil
+	}))
 
 	// {{ "" | newline }}
 	// Maybe one for newlines since it's common
-	pongo2.RegisterFilter("newline", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	errs = append(errs, registerFilter("newline", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
 		return pongo2.AsSafeValue(`write(1, "\n", 1);`), nil
-	})
+	}))
 
 	// Safe string copy with bounds checking
 	// Example usage:
 	// char path[256];
 	// {{ "path" | string_copy : "some_string" }}
-	pongo2.RegisterFilter("string_copy", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	errs = append(errs, registerFilter("string_copy", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
 		dest := in.String()
 		src := param.String()
 
@@ -79,32 +85,603 @@ if (%[1]s) {
 %[1]s[sizeof(%[1]s) - 1] = '\0';`,
 			dest, src)
 		return pongo2.AsSafeValue(code), nil
-	})
+	}))
 
+	// Bounded append: copies as much of src as fits after dest's current
+	// contents and always NUL-terminates, warning on truncation. The size
+	// defaults to sizeof(dest), which is only right for arrays; pass the
+	// buffer size for a char* destination.
 	// Example usage:
-	// {{ "" | snprintf_checked : "playlist[track_count],needed,\"%s/\",entry->d_name" }}
-	pongo2.RegisterFilter("snprintf_checked", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
-		// This one needs multiple parameters, so we'll handle it differently
-		// Let's assume param contains "dest,size,format,args..."
+	// char path[256] = "/tmp/";
+	// {{ "path" | string_append_bounded : "$name" }}
+	// {{ "buf" | string_append_bounded : "$suffix,buf_size" }}
+	errs = append(errs, registerFilter("string_append_bounded", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		dest := strings.TrimSpace(in.String())
 		parts := strings.Split(param.String(), ",")
-		if len(parts) < 3 {
-			return nil, &pongo2.Error{OrigError: fmt.Errorf("snprintf_checked needs dest,size,format[,args...]")}
+		if len(parts) > 2 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("string_append_bounded needs src[,size]")}
+		}
+		size := "sizeof(" + dest + ")"
+		if len(parts) == 2 {
+			size = strings.TrimSpace(parts[1])
+		}
+		code := fmt.Sprintf(
+			`{
+    size_t append_size = (size_t)(%[3]s);
+    size_t append_used = strnlen(%[1]s, append_size);
+    const char *append_src = %[2]s;
+    size_t append_len = strlen(append_src);
+    if (append_used >= append_size) {
+        fprintf(stderr, "Destination %[1]s is not terminated within its size in %%s\n", __func__);
+        exit(EXIT_FAILURE);
+    }
+    if (append_len >= append_size - append_used) {
+        append_len = append_size - append_used - 1;
+        fprintf(stderr, "String truncation detected in %%s\n", __func__);
+    }
+    memcpy(%[1]s + append_used, append_src, append_len);
+    %[1]s[append_used + append_len] = '\0';
+}`,
+			dest, quoteIfLiteral(parts[0]), size)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// A quoted format may contain commas and is checked against the argument
+	// count. Arguments for %s are text, quoted for you, unless marked as
+	// variables with $.
+	// Example usage:
+	// {{ "" | snprintf_checked : "playlist[track_count],needed,\"%s/\",$entry->d_name" }}
+	// {{ "" | snprintf_checked : "pos,sizeof(pos),\"%d, %d\",x,y" }}
+	errs = append(errs, registerFilter("snprintf_checked", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code, err := snprintfChecked(splitArgs(param.String()))
+		return filterCode("snprintf_checked", code, err)
+	}))
+	// The cgen form takes the format as text, quoted unless it already is.
+	// {% cgen snprintf_checked "buf" "sizeof(buf)" "%s, %s" "$last" "$first" %}
+	errs = append(errs, registerCgen("snprintf_checked", func(args []string) (string, error) {
+		if len(args) >= 3 {
+			args[2] = quoteText(args[2])
+		}
+		return snprintfChecked(args)
+	}))
+
+	// Split on every occurrence of the delimiter (a string, may itself be a
+	// comma). Consecutive delimiters give empty fields, a trailing delimiter
+	// gives a final empty field and an empty input gives count 0. Declares
+	// parts (char**) and count (size_t); release with string_split_free.
+	// Example usage:
+	// {{ "parts,part_count" | string_split : "$line,," }}
+	// {{ "words,word_count" | string_split : "$sentence, " }}
+	errs = append(errs, registerFilter("string_split", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		outs := strings.Split(in.String(), ",")
+		args := strings.SplitN(param.String(), ",", 2)
+		if len(outs) != 2 || len(args) != 2 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("string_split needs parts,count | input,delimiter")}
+		}
+		parts, count := strings.TrimSpace(outs[0]), strings.TrimSpace(outs[1])
+		src := quoteIfLiteral(args[0])
+		delim := args[1]
+		if !strings.HasPrefix(delim, `"`) {
+			delim = cStringLiteral(delim)
+		}
+
+		code := fmt.Sprintf(
+			`char **%[1]s = NULL;
+size_t %[2]s = 0;
+{
+    const char *split_src_%[1]s = %[3]s;
+    const char *split_delim_%[1]s = %[4]s;
+    size_t split_delim_len_%[1]s = strlen(split_delim_%[1]s);
+    if (split_src_%[1]s && *split_src_%[1]s) {
+        char *cursor_%[1]s = strdup(split_src_%[1]s);
+        size_t cap_%[1]s = 8;
+        %[1]s = malloc(cap_%[1]s * sizeof(char *));
+        if (!cursor_%[1]s || !%[1]s) {
+            fprintf(stderr, "Failed to get memory for splitting %%s\n", %[5]s);
+            exit(EXIT_FAILURE);
+        }
+        for (;;) {
+            if (%[2]s == cap_%[1]s) {
+                cap_%[1]s *= 2;
+                char **grown_%[1]s = realloc(%[1]s, cap_%[1]s * sizeof(char *));
+                if (!grown_%[1]s) {
+                    fprintf(stderr, "Failed to get memory for splitting %%s\n", %[5]s);
+                    exit(EXIT_FAILURE);
+                }
+                %[1]s = grown_%[1]s;
+            }
+            %[1]s[%[2]s++] = cursor_%[1]s;
+            char *hit_%[1]s = split_delim_len_%[1]s ? strstr(cursor_%[1]s, split_delim_%[1]s) : NULL;
+            if (!hit_%[1]s) {
+                break;
+            }
+            *hit_%[1]s = '\0';
+            cursor_%[1]s = hit_%[1]s + split_delim_len_%[1]s;
+        }
+    }
+}`,
+			parts, count, src, delim, cStringLiteral(src))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// All the parts share one buffer, which starts at parts[0].
+	// Example usage:
+	// {{ "parts,part_count" | string_split_free }}
+	errs = append(errs, registerFilter("string_split_free", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		outs := strings.Split(in.String(), ",")
+		if len(outs) != 2 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("string_split_free needs parts,count")}
+		}
+		parts, count := strings.TrimSpace(outs[0]), strings.TrimSpace(outs[1])
+		code := fmt.Sprintf(
+			`if (%[1]s) {
+    if (%[2]s > 0) {
+        free(%[1]s[0]);
+    }
+    free(%[1]s);
+    %[1]s = NULL;
+}
+%[2]s = 0;`,
+			parts, count)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Trimmed copy without leading/trailing whitespace, NULL when the input
+	// is NULL. Needs {{ "" | auto_free_generic }}, unless a trailing arena
+	// name (see arena_create) is given to allocate from instead.
+	// Example usage:
+	// {{ "clean" | string_trim : "$line" }}
+	// {{ "clean" | string_trim : "$line,scratch" }}
+	errs = append(errs, registerFilter("string_trim", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		dest := in.String()
+		src, arena := arenaTarget(param.String())
+		decl, alloc := "AUTO_FREE char *", "malloc"
+		if arena != "" {
+			decl, alloc = "char *", arena+"_alloc"
+		}
+		code := fmt.Sprintf(
+			`%[3]s%[1]s = NULL;
+{
+    const char *trim_src_%[1]s = %[2]s;
+    if (trim_src_%[1]s) {
+        while (isspace((unsigned char)*trim_src_%[1]s)) {
+            trim_src_%[1]s++;
+        }
+        size_t trim_len_%[1]s = strlen(trim_src_%[1]s);
+        while (trim_len_%[1]s > 0 && isspace((unsigned char)trim_src_%[1]s[trim_len_%[1]s - 1])) {
+            trim_len_%[1]s--;
+        }
+        %[1]s = %[4]s(trim_len_%[1]s + 1);
+        if (!%[1]s) {
+            fprintf(stderr, "Failed to get memory for %[1]s\n");
+            exit(EXIT_FAILURE);
+        }
+        memcpy(%[1]s, trim_src_%[1]s, trim_len_%[1]s);
+        %[1]s[trim_len_%[1]s] = '\0';
+    }
+}`,
+			dest, quoteIfLiteral(src), decl, alloc)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Copy of src[start:end] with Python-style indices: negative ones count
+	// from the end, both are clamped to the string, and an omitted start or
+	// end means the beginning or the end. The copy is NULL when the input
+	// is NULL or start ends up after end. Needs {{ "" | auto_free_generic }},
+	// unless a trailing arena name (see arena_create) is given to allocate
+	// from instead.
+	// Example usage:
+	// {{ "ext" | string_slice : "$filename,-3" }}
+	// {{ "head" | string_slice : "$line,0,width" }}
+	// {{ "inner" | string_slice : "$quoted,1,-1" }}
+	// {{ "inner" | string_slice : "$quoted,1,-1,scratch" }}
+	errs = append(errs, registerFilter("string_slice", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		dest := in.String()
+		src, arena := arenaTarget(param.String())
+		decl, alloc := "AUTO_FREE char *", "malloc"
+		if arena != "" {
+			decl, alloc = "char *", arena+"_alloc"
+		}
+		parts := strings.Split(src, ",")
+		if len(parts) != 2 && len(parts) != 3 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("string_slice needs src,start[,end][,arena]")}
+		}
+		start, end := strings.TrimSpace(parts[1]), ""
+		if len(parts) == 3 {
+			end = strings.TrimSpace(parts[2])
+		}
+		if start == "" {
+			start = "0"
+		}
+		if end == "" {
+			end = "slice_len_" + dest
+		}
+		code := fmt.Sprintf(
+			`%[5]s%[1]s = NULL;
+{
+    const char *slice_src_%[1]s = %[2]s;
+    if (slice_src_%[1]s) {
+        long long slice_len_%[1]s = (long long)strlen(slice_src_%[1]s);
+        long long slice_start_%[1]s = (long long)(%[3]s);
+        long long slice_end_%[1]s = (long long)(%[4]s);
+        if (slice_start_%[1]s < 0) {
+            slice_start_%[1]s += slice_len_%[1]s;
+        }
+        if (slice_end_%[1]s < 0) {
+            slice_end_%[1]s += slice_len_%[1]s;
+        }
+        slice_start_%[1]s = slice_start_%[1]s < 0 ? 0 : slice_start_%[1]s > slice_len_%[1]s ? slice_len_%[1]s : slice_start_%[1]s;
+        slice_end_%[1]s = slice_end_%[1]s < 0 ? 0 : slice_end_%[1]s > slice_len_%[1]s ? slice_len_%[1]s : slice_end_%[1]s;
+        if (slice_start_%[1]s <= slice_end_%[1]s) {
+            size_t slice_n_%[1]s = (size_t)(slice_end_%[1]s - slice_start_%[1]s);
+            %[1]s = %[6]s(slice_n_%[1]s + 1);
+            if (!%[1]s) {
+                fprintf(stderr, "Failed to get memory for %[1]s\n");
+                exit(EXIT_FAILURE);
+            }
+            memcpy(%[1]s, slice_src_%[1]s + slice_start_%[1]s, slice_n_%[1]s);
+            %[1]s[slice_n_%[1]s] = '\0';
+        }
+    }
+}`,
+			dest, quoteIfLiteral(parts[0]), start, end, decl, alloc)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Copy with every occurrence of old replaced by new, NULL when the input
+	// is NULL. An empty old string leaves the copy unchanged. Needs
+	// {{ "" | auto_free_generic }}.
+	// Example usage:
+	// {{ "fixed" | string_replace : "$path,\\,/" }}
+	// {{ "greeting" | string_replace : "$template,{name},$user_name" }}
+	errs = append(errs, registerFilter("string_replace", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		dest := in.String()
+		parts := strings.SplitN(param.String(), ",", 3)
+		if len(parts) != 3 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("string_replace needs input,old,new")}
+		}
+		src, old, repl := quoteIfLiteral(parts[0]), quoteIfLiteral(parts[1]), quoteIfLiteral(parts[2])
+		code := fmt.Sprintf(
+			`AUTO_FREE char *%[1]s = NULL;
+{
+    const char *rep_src_%[1]s = %[2]s;
+    const char *rep_old_%[1]s = %[3]s;
+    const char *rep_new_%[1]s = %[4]s;
+    if (rep_src_%[1]s) {
+        size_t old_len_%[1]s = strlen(rep_old_%[1]s);
+        size_t new_len_%[1]s = strlen(rep_new_%[1]s);
+        size_t hits_%[1]s = 0;
+        if (old_len_%[1]s > 0) {
+            for (const char *p = strstr(rep_src_%[1]s, rep_old_%[1]s); p; p = strstr(p + old_len_%[1]s, rep_old_%[1]s)) {
+                hits_%[1]s++;
+            }
+        }
+        size_t len_%[1]s = strlen(rep_src_%[1]s) - hits_%[1]s * old_len_%[1]s + hits_%[1]s * new_len_%[1]s;
+        %[1]s = malloc(len_%[1]s + 1);
+        if (!%[1]s) {
+            fprintf(stderr, "Failed to get memory for %[1]s (size: %%zu)\n", len_%[1]s + 1);
+            exit(EXIT_FAILURE);
+        }
+        char *out_%[1]s = %[1]s;
+        const char *rest_%[1]s = rep_src_%[1]s;
+        const char *hit_%[1]s;
+        while (old_len_%[1]s > 0 && (hit_%[1]s = strstr(rest_%[1]s, rep_old_%[1]s)) != NULL) {
+            memcpy(out_%[1]s, rest_%[1]s, (size_t)(hit_%[1]s - rest_%[1]s));
+            out_%[1]s += hit_%[1]s - rest_%[1]s;
+            memcpy(out_%[1]s, rep_new_%[1]s, new_len_%[1]s);
+            out_%[1]s += new_len_%[1]s;
+            rest_%[1]s = hit_%[1]s + old_len_%[1]s;
+        }
+        strcpy(out_%[1]s, rest_%[1]s);
+    }
+}`,
+			dest, src, old, repl)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// The predicates expand to a boolean C expression, false when either
+	// argument is NULL. Both arguments may be evaluated more than once.
+	// Example usage:
+	// if ({{ "path" | string_startswith : "/tmp/" }}) { ... }
+	// if ({{ "name" | string_endswith : ".c" }}) { ... }
+	// if ({{ "line" | string_contains : "ERROR" }}) { ... }
+	errs = append(errs, registerFilter("string_startswith", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		s, prefix := in.String(), quoteIfLiteral(param.String())
+		return pongo2.AsSafeValue(fmt.Sprintf(
+			"((%[1]s) && (%[2]s) && strncmp((%[1]s), (%[2]s), strlen(%[2]s)) == 0)",
+			s, prefix)), nil
+	}))
+
+	errs = append(errs, registerFilter("string_endswith", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		s, suffix := in.String(), quoteIfLiteral(param.String())
+		return pongo2.AsSafeValue(fmt.Sprintf(
+			"((%[1]s) && (%[2]s) && strlen(%[1]s) >= strlen(%[2]s) && strcmp((%[1]s) + strlen(%[1]s) - strlen(%[2]s), (%[2]s)) == 0)",
+			s, suffix)), nil
+	}))
+
+	errs = append(errs, registerFilter("string_contains", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		s, needle := in.String(), quoteIfLiteral(param.String())
+		return pongo2.AsSafeValue(fmt.Sprintf(
+			"((%[1]s) && (%[2]s) && strstr((%[1]s), (%[2]s)) != NULL)",
+			s, needle)), nil
+	}))
+
+	// asprintf-style formatting into an exactly sized AUTO_FREE string. This
+	// is a tag so the format and arguments can contain commas. The format is
+	// quoted for you unless already quoted. Arguments for %s are text unless
+	// marked with $, the others are C expressions; they are evaluated twice
+	// (once to measure, once to format). The number of arguments must match
+	// the format's conversions. Needs {{ "" | auto_free_generic }}.
+	// Example usage:
+	// {% format_alloc "greeting" "Hello %s, you are %d" "$name" "age + 1" %}
+	// {% format_alloc "banner" "no arguments, no problem" %}
+	errs = append(errs, registerTag("format_alloc", func(args []string) (string, error) {
+		if len(args) < 2 {
+			return "", fmt.Errorf("needs result, format[, args...]")
+		}
+		dest := args[0]
+		format, fmtArgs, err := formatCall(args[1:])
+		if err != nil {
+			return "", err
 		}
 
-		dest := parts[0]
-		size := parts[1]
-		format := parts[2]
-		args := ""
-		if len(parts) > 3 {
-			args = "," + strings.Join(parts[3:], ",")
+		code := fmt.Sprintf(
+			`AUTO_FREE char *%[1]s = NULL;
+{
+    int len_%[1]s = snprintf(NULL, 0, %[2]s%[3]s);
+    if (len_%[1]s < 0) {
+        fprintf(stderr, "Failed to format %[1]s\n");
+        exit(EXIT_FAILURE);
+    }
+    %[1]s = malloc((size_t)len_%[1]s + 1);
+    if (!%[1]s) {
+        fprintf(stderr, "Failed to get memory for %[1]s (size: %%d)\n", len_%[1]s + 1);
+        exit(EXIT_FAILURE);
+    }
+    if (snprintf(%[1]s, (size_t)len_%[1]s + 1, %[2]s%[3]s) < 0) {
+        fprintf(stderr, "Failed to format %[1]s\n");
+        exit(EXIT_FAILURE);
+    }
+}`,
+			dest, format, fmtArgs)
+		return code, nil
+	}))
+
+	// String builders: a growable, always NUL-terminated buffer declared as
+	// a local struct with data, length and capacity. Capacity doubles as
+	// needed; failures to allocate print and exit.
+	// Example usage:
+	// {{ "out" | string_builder }}
+	// {{ "out" | builder_append : "Hello, " }}
+	// {{ "out" | builder_append : "$name" }}
+	// {% append_format "out" " (%d unread)" "unread" %}
+	// {{ "message" | builder_result : "out" }}
+	errs = append(errs, registerFilter("string_builder", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(
+			`struct {
+    char *data;
+    size_t length;
+    size_t capacity;
+} %[1]s = {malloc(64), 0, 64};
+if (!%[1]s.data) {
+    fprintf(stderr, "Failed to get memory for %[1]s\n");
+    exit(EXIT_FAILURE);
+}
+%[1]s.data[0] = '\0';`,
+			in.String())
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Append a $-marked char* variable or literal text, which is quoted for
+	// you with its surrounding spaces kept.
+	// Example usage:
+	// {{ "out" | builder_append : "$name" }}
+	errs = append(errs, registerFilter("builder_append", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		sb := in.String()
+		src, ok := cVar(param.String())
+		if !ok {
+			src = quoteText(param.String())
 		}
+		code := fmt.Sprintf(
+			`{
+    const char *append_src = %[2]s;
+    size_t append_len = strlen(append_src);
+%[3]s
+    memcpy(%[1]s.data + %[1]s.length, append_src, append_len + 1);
+    %[1]s.length += append_len;
+}`,
+			sb, src, builderGrow(sb, "append_len"))
+		return pongo2.AsSafeValue(code), nil
+	}))
 
+	// printf-style append, measured first so the builder grows exactly
+	// once if needed. Arguments are evaluated twice.
+	// Example usage:
+	// {% append_format "out" "%s=%d\n" "$key" "value" %}
+	errs = append(errs, registerTag("append_format", func(args []string) (string, error) {
+		if len(args) < 2 {
+			return "", fmt.Errorf("needs builder, format[, args...]")
+		}
+		sb := args[0]
+		format, fmtArgs, err := formatCall(args[1:])
+		if err != nil {
+			return "", err
+		}
 		code := fmt.Sprintf(
-			`int _written = snprintf(%[1]s, %[2]s, %[3]s%[4]s);
-if (_written < 0 || _written >= (int)%[2]s) {
-    fprintf(stderr, "String truncation detected in %%s\n", __func__);
+			`{
+    int format_len = snprintf(NULL, 0, %[2]s%[3]s);
+    if (format_len < 0) {
+        fprintf(stderr, "Failed to format into %[1]s\n");
+        exit(EXIT_FAILURE);
+    }
+%[4]s
+    snprintf(%[1]s.data + %[1]s.length, %[1]s.capacity - %[1]s.length, %[2]s%[3]s);
+    %[1]s.length += (size_t)format_len;
 }`,
-			dest, size, format, args)
+			sb, format, fmtArgs, builderGrow(sb, "(size_t)format_len"))
+		return code, nil
+	}))
+
+	// Take the built string as an AUTO_FREE char*, leaving the builder
+	// empty. Needs {{ "" | auto_free_generic }}.
+	// Example usage:
+	// {{ "message" | builder_result : "out" }}
+	errs = append(errs, registerFilter("builder_result", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		sb := strings.TrimSpace(param.String())
+		code := fmt.Sprintf(
+			`AUTO_FREE char *%[1]s = %[2]s.data;
+%[2]s.data = NULL;
+%[2]s.length = 0;
+%[2]s.capacity = 0;`,
+			in.String(), sb)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Release a builder whose contents weren't taken with builder_result.
+	// Example usage:
+	// {{ "out" | builder_free }}
+	errs = append(errs, registerFilter("builder_free", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(
+			`free(%[1]s.data);
+%[1]s.data = NULL;
+%[1]s.length = 0;
+%[1]s.capacity = 0;`,
+			in.String())
 		return pongo2.AsSafeValue(code), nil
-	})
+	}))
+
+	return errors.Join(errs...)
+}
+
+// formatCall splits tag arguments into a quoted format and the remaining
+// arguments as ", a, b", or "" when there are none.
+func formatCall(args []string) (string, string, error) {
+	fmtArgs, err := formatArgs(args[0], args[1:])
+	if err != nil {
+		return "", "", err
+	}
+	return quoteText(args[0]), fmtArgs, nil
+}
+
+// formatArgs checks a printf format against its arguments and joins them
+// as ", a, b" (nothing when there are none). A $-marked argument is a C
+// expression. An unmarked argument for %s is text and is quoted, one for
+// any other conversion is C as written. Positional formats aren't
+// checked, so their unmarked arguments are all taken as C.
+func formatArgs(format string, args []string) (string, error) {
+	convs, positional, err := formatConversions(format)
+	if err != nil {
+		return "", err
+	}
+	if !positional && len(convs) != len(args) {
+		return "", fmt.Errorf("format %s has %d conversion(s) but %d argument(s) were given", quoteText(format), len(convs), len(args))
+	}
+	var b strings.Builder
+	for i, arg := range args {
+		if expr, ok := cVar(arg); ok {
+			arg = expr
+		} else if !positional && convs[i] == 's' {
+			arg = quoteIfLiteral(arg)
+		} else {
+			arg = strings.TrimSpace(arg)
+		}
+		b.WriteString(", ")
+		b.WriteString(arg)
+	}
+	return b.String(), nil
+}
+
+// formatConversions returns the conversion character each argument of a
+// printf format feeds, with '*' for a * width or precision. %% takes no
+// argument. Positional (%1$s) formats aren't checked.
+func formatConversions(format string) (convs []byte, positional bool, err error) {
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+		if i < len(format) && format[i] == '%' {
+			continue
+		}
+		start := i
+		for i < len(format) && strings.IndexByte("-+ #0'", format[i]) >= 0 {
+			i++
+		}
+		for i < len(format) && (format[i] == '*' || format[i] == '.' || format[i] >= '0' && format[i] <= '9' || format[i] == '$') {
+			if format[i] == '$' {
+				return nil, true, nil
+			}
+			if format[i] == '*' {
+				convs = append(convs, '*')
+			}
+			i++
+		}
+		for i < len(format) && strings.IndexByte("hljztLq", format[i]) >= 0 {
+			i++
+		}
+		if i >= len(format) || strings.IndexByte("diouxXeEfFgGaAcspn", format[i]) < 0 {
+			return nil, false, fmt.Errorf("bad conversion %q in format %s", "%"+format[start:min(i+1, len(format))], quoteText(format))
+		}
+		convs = append(convs, format[i])
+	}
+	return convs, false, nil
+}
+
+// snprintfChecked generates snprintf_checked from dest, size, format and
+// the format arguments.
+func snprintfChecked(parts []string) (string, error) {
+	if len(parts) < 3 {
+		return "", fmt.Errorf("needs dest, size, format[, args...]")
+	}
+	dest := parts[0]
+	size := parts[1]
+	format := strings.TrimSpace(parts[2])
+	fmtArgs := parts[3:]
+	for len(fmtArgs) > 0 && strings.TrimSpace(fmtArgs[len(fmtArgs)-1]) == "" {
+		fmtArgs = fmtArgs[:len(fmtArgs)-1]
+	}
+	// Only a literal format can be checked against its arguments; with
+	// any other the arguments are C, the $ marker optional.
+	var args string
+	for _, arg := range fmtArgs {
+		if expr, ok := cVar(arg); ok {
+			arg = expr
+		}
+		args += ", " + strings.TrimSpace(arg)
+	}
+	if strings.HasPrefix(format, `"`) {
+		var err error
+		if args, err = formatArgs(format, fmtArgs); err != nil {
+			return "", err
+		}
+	}
+
+	return fmt.Sprintf(
+		`{
+    int _written = snprintf(%[1]s, %[2]s, %[3]s%[4]s);
+    if (_written < 0 || _written >= (int)%[2]s) {
+        fprintf(stderr, "String truncation writing %[5]s in %%s\n", __func__);
+    }
+}`,
+		dest, size, format, args, cFormatEscape(strings.TrimSpace(dest))), nil
+}
+
+// builderGrow doubles a builder's capacity until extra more bytes and the
+// terminator fit.
+func builderGrow(sb, extra string) string {
+	return fmt.Sprintf(
+		`    if (%[1]s.length + %[2]s + 1 > %[1]s.capacity) {
+        size_t grown_cap = %[1]s.capacity ? %[1]s.capacity : 64;
+        while (%[1]s.length + %[2]s + 1 > grown_cap) {
+            grown_cap *= 2;
+        }
+        char *grown = realloc(%[1]s.data, grown_cap);
+        if (!grown) {
+            fprintf(stderr, "Failed to get memory for %[1]s\n");
+            exit(EXIT_FAILURE);
+        }
+        %[1]s.data = grown;
+        %[1]s.capacity = grown_cap;
+    }`,
+		sb, extra)
 }
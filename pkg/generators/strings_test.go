@@ -0,0 +1,278 @@
+package generators
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func TestStringPredicatesQuoteSingleWords(t *testing.T) {
+	tests := []struct {
+		tpl, want string
+	}{
+		{`{{ "line" | string_contains : "ERROR" }}`, `strstr((line), ("ERROR"))`},
+		{`{{ "name" | string_startswith : "lib" }}`, `strncmp((name), ("lib"), strlen("lib"))`},
+		{`{{ "name" | string_endswith : "c" }}`, `strlen("c")`},
+		{`{{ "line" | string_contains : "$needle" }}`, `strstr((line), (needle))`},
+		{`{{ "out" | string_replace : "$path,foo,bar" }}`, `rep_old_out = "foo";`},
+		{`{{ "out" | string_replace : "input,$old,new" }}`, `rep_src_out = "input";`},
+	}
+	for _, tt := range tests {
+		if got, _ := render(t, tt.tpl); !strings.Contains(got, tt.want) {
+			t.Errorf("%s gave\n%s\nwant it to contain %s", tt.tpl, got, tt.want)
+		}
+	}
+}
+
+func TestStringPredicatesAndReplace(t *testing.T) {
+	out := renderAndRun(t, `{{ "" | auto_free_generic }}
+int main(void) {
+    const char *line = "disk ERROR on sda";
+    const char *name = "libfoo.c";
+    const char *none = NULL;
+    printf("%d %d %d\n",
+        {{ "line" | string_contains : "ERROR" }},
+        {{ "line" | string_contains : "WARN" }},
+        {{ "none" | string_contains : "ERROR" }});
+    printf("%d %d\n",
+        {{ "name" | string_startswith : "lib" }},
+        {{ "name" | string_startswith : "foo" }});
+    printf("%d %d\n",
+        {{ "name" | string_endswith : "c" }},
+        {{ "name" | string_endswith : "h" }});
+    {{ "fixed" | string_replace : "$line,sda,sdb" }}
+    {{ "word" | string_replace : "hello,l,L" }}
+    printf("%s|%s\n", fixed, word);
+    return 0;
+}
+`, sanitize)
+	if want := "1 0 0\n1 0\n1 0\ndisk ERROR on sdb|heLLo\n"; out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+}
+
+func TestSnprintfCheckedTwiceInOneScope(t *testing.T) {
+	out := renderAndRun(t, `int main(void) {
+    char pos[16], tiny[4];
+    int x = 3, y = 4;
+    {{ "" | snprintf_checked : "pos,sizeof(pos),\"%d, %d\",x,y" }}
+    {{ "" | snprintf_checked : "tiny,sizeof(tiny),\"say \\\"%s\\\"\",\"hi\"" }}
+    printf("%s|%s\n", pos, tiny);
+    return 0;
+}
+`, sanitize)
+	if want := "3, 4|say\n"; out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+}
+
+func TestStringSliceArena(t *testing.T) {
+	src, _ := render(t, `{{ "scratch" | arena_create : "256" }}
+{{ "inner" | string_slice : "$quoted,1,-1,scratch" }}`)
+	if !strings.Contains(src, "char *inner = NULL;") || strings.Contains(src, "AUTO_FREE char *inner") ||
+		!strings.Contains(src, "inner = scratch_alloc(") {
+		t.Errorf("string_slice did not allocate from the arena:\n%s", src)
+	}
+
+	out := renderAndRun(t, `{{ "" | auto_free_generic }}
+{{ "scratch" | arena_create : "256" }}
+int main(void) {
+    const char *quoted = "\"hello\"";
+    const char *filename = "main.c";
+    {{ "inner" | string_slice : "$quoted,1,-1,scratch" }}
+    {{ "head" | string_slice : "$filename,,2,scratch" }}
+    {{ "ext" | string_slice : "$filename,-1" }}
+    printf("%s|%s|%s\n", inner, head, ext);
+    {{ "scratch" | arena_destroy }}
+    return 0;
+}
+`, sanitize)
+	if want := "hello|ma|c\n"; out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+}
+
+func TestFormatConversions(t *testing.T) {
+	tests := []struct {
+		format     string
+		convs      string
+		positional bool
+		err        bool
+	}{
+		{`"%d items in %s"`, "ds", false, false},
+		{`"100%% done"`, "", false, false},
+		{`"%*d|%-08.3lf|%zu|%%|%c"`, "*dfuc", false, false},
+		{`"%2$s %1$s"`, "", true, false},
+		{`"%y"`, "", false, true},
+		{`"trailing %"`, "", false, true},
+	}
+	for _, tt := range tests {
+		convs, positional, err := formatConversions(tt.format)
+		if (err != nil) != tt.err || string(convs) != tt.convs || positional != tt.positional {
+			t.Errorf("formatConversions(%s) = %q, %v, %v; want %q, %v, error %v",
+				tt.format, convs, positional, err, tt.convs, tt.positional, tt.err)
+		}
+	}
+}
+
+func TestFormatArgs(t *testing.T) {
+	tests := []struct {
+		format string
+		args   []string
+		want   string
+		err    string
+	}{
+		{`"no arguments"`, nil, "", ""},
+		{`"%s=%d"`, []string{"$name", "count + 1"}, ", name, count + 1", ""},
+		{`"%s in %s"`, []string{"config.json", "$entry->d_name"}, `, "config.json", entry->d_name`, ""},
+		{`"%s"`, []string{"hello world"}, `, "hello world"`, ""},
+		{`"%s|%s|%s"`, []string{"cfg.name", "argv", `"quoted"`}, `, "cfg.name", "argv", "quoted"`, ""},
+		{`"%s|%s|%d"`, []string{"$cfg.name", " $argv[1] ", "$n * 2"}, ", cfg.name, argv[1], n * 2", ""},
+		{`"%2$s %1$s"`, []string{"$b", "a"}, ", b, a", ""},
+		{`"%d"`, nil, "", `format "%d" has 1 conversion(s) but 0 argument(s) were given`},
+		{`"%d"`, []string{"a", "b"}, "", "has 1 conversion(s) but 2 argument(s)"},
+	}
+	for _, tt := range tests {
+		got, err := formatArgs(tt.format, tt.args)
+		switch {
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("formatArgs(%s, %q): got error %v, want %q", tt.format, tt.args, err, tt.err)
+		case tt.err == "" && (err != nil || got != tt.want):
+			t.Errorf("formatArgs(%s, %q) = %q, %v; want %q", tt.format, tt.args, got, err, tt.want)
+		}
+	}
+}
+
+func TestFormatMismatchFailsRender(t *testing.T) {
+	if err := InitAll(); err != nil {
+		t.Fatalf("InitAll: %v", err)
+	}
+	for _, tpl := range []string{
+		`{% format_alloc "msg" "%s and %s" "one" %}`,
+		`{{ "" | snprintf_checked : "buf,sizeof(buf),\"%d\"" }}`,
+		`{% cgen snprintf_checked "buf" "sizeof(buf)" "%d %d" "x" %}`,
+	} {
+		tmpl, err := pongo2.FromString(tpl)
+		if err == nil {
+			_, err = tmpl.Execute(nil)
+		}
+		if err == nil || !strings.Contains(err.Error(), "argument(s) were given") {
+			t.Errorf("%s: got %v, want an argument count error", tpl, err)
+		}
+	}
+}
+
+func TestFormatAllocRuns(t *testing.T) {
+	out := renderAndRun(t, `{{ "" | auto_free_generic }}
+int main(void) {
+    const char *name = "Ada";
+    int age = 36;
+    {% format_alloc "greeting" "Hello %s, you are %d (100%%)" "$name" "age + 1" %}
+    {% format_alloc "banner" "no arguments, no problem" %}
+    {% format_alloc "where" "%s/%s" "config.json" "$name" %}
+    printf("%s|%s|%s\n", greeting, banner, where);
+    return 0;
+}
+`, sanitize)
+	if want := "Hello Ada, you are 37 (100%)|no arguments, no problem|config.json/Ada\n"; out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+}
+
+func TestStringSplit(t *testing.T) {
+	out := renderAndRun(t, `int main(void) {
+    const char *line = "a,,b,";
+    const char *many = "1 2 3 4 5 6 7 8 9 10";
+    const char *empty = "";
+    {{ "parts,part_count" | string_split : "$line,," }}
+    {{ "words,word_count" | string_split : "$many, " }}
+    {{ "none,none_count" | string_split : "$empty,;" }}
+    {{ "pairs,pair_count" | string_split : "k1=>v1=>k2,=>" }}
+    for (size_t i = 0; i < part_count; i++) printf("[%s]", parts[i]);
+    printf(" %zu", part_count);
+    printf(" %s %zu", words[9], word_count);
+    printf(" %zu %d", none_count, none == NULL);
+    printf(" %s|%s|%s\n", pairs[0], pairs[1], pairs[2]);
+    printf("%s\n", line);
+    {{ "parts,part_count" | string_split_free }}
+    {{ "words,word_count" | string_split_free }}
+    {{ "none,none_count" | string_split_free }}
+    {{ "pairs,pair_count" | string_split_free }}
+    return 0;
+}
+`, sanitize)
+	if want := "[a][][b][] 4 10 10 0 1 k1|v1|k2\na,,b,\n"; out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+}
+
+func TestStringUpperCopyDocExamples(t *testing.T) {
+	out := renderAndRun(t, `{{ "" | auto_free_generic }}
+{{ "scratch" | arena_create : "256" }}
+int main(void) {
+    const char* original_name = "Hello World";
+    {
+        {{ "uppercase_copy" | string_upper_copy : "$original_name" }}
+        printf("%s\n", uppercase_copy);
+    }
+    {
+        {{ "uppercase_copy" | string_upper_copy : "$original_name,scratch" }}
+        printf("%s\n", uppercase_copy);
+    }
+    {{ "shout" | string_upper_copy : "quiet, please" }}
+    printf("%s|%s\n", shout, original_name);
+    {{ "scratch" | arena_destroy }}
+    return 0;
+}
+`, sanitize)
+	if want := "HELLO WORLD\nHELLO WORLD\nQUIET, PLEASE|Hello World\n"; out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+}
+
+func TestFormatMemberAccessArgument(t *testing.T) {
+	out := renderAndRun(t, `#include <string.h>
+int main(int argc, char **argv) {
+    (void)argc;
+    struct { const char *name; int port; } cfg = { "api", 8080 };
+    char buf[64];
+    {{ "" | snprintf_checked : "buf,sizeof(buf),\"%s:%d %s\",$cfg.name,cfg.port,cfg.name" }}
+    puts(buf);
+    {% cgen snprintf_checked "buf" "sizeof(buf)" "%s|%s" "$argv[0] + 0" "argv" %}
+    puts(buf + strlen(argv[0]));
+    return 0;
+}
+`, sanitize)
+	if want := "api:8080 cfg.name\n|argv\n"; out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+}
+
+func TestStringBuilderGrows(t *testing.T) {
+	out := renderAndRun(t, `{{ "" | auto_free_generic }}
+int main(void) {
+    const char *name = "Ada";
+    {{ "out" | string_builder }}
+    {{ "out" | builder_append : "Hello, " }}
+    {{ "out" | builder_append : "$name" }}
+    for (int i = 0; i < 40; i++) {
+        {% append_format "out" " %d:%s" "i" "$name" %}
+    }
+    {{ "out" | builder_append : "!" }}
+    size_t length = out.length, capacity = out.capacity;
+    {{ "message" | builder_result : "out" }}
+    printf("%zu %zu %d %d\n", length, strlen(message), capacity >= length + 1, capacity > 64);
+    printf("%.13s|%s\n", message, message + length - 8);
+    {{ "scratch" | string_builder }}
+    {{ "scratch" | builder_append : "discarded" }}
+    {{ "scratch" | builder_free }}
+    printf("%zu %d\n", out.length, out.data == NULL);
+    return 0;
+}
+`, sanitize)
+	// "Hello, Ada" is 10 bytes, " 0:Ada".." 9:Ada" 6 each, " 10:Ada".." 39:Ada" 7 each, "!" 1.
+	if want := "281 281 1 1\nHello, Ada 0:| 39:Ada!\n0 1\n"; out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+}
@@ -0,0 +1,139 @@
+package generators
+
+import (
+	"fmt"
+	"text/template"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+// codeGenerator turns already-evaluated tag arguments into C code.
+type codeGenerator func(args []string) (string, error)
+
+// codeTagNode is a parsed {% name arg1 arg2 ... %} tag. Each argument is a
+// pongo2 expression (usually a string literal) evaluated at render time,
+// so unlike a filter parameter an argument may freely contain commas.
+type codeTagNode struct {
+	name     string
+	position *pongo2.Token
+	args     []pongo2.IEvaluator
+	gen      codeGenerator
+}
+
+func (node *codeTagNode) Execute(ctx *pongo2.ExecutionContext, writer pongo2.TemplateWriter) *pongo2.Error {
+	args := make([]string, len(node.args))
+	for i, arg := range node.args {
+		value, err := arg.Evaluate(ctx)
+		if err != nil {
+			return err
+		}
+		args[i] = value.String()
+	}
+
+	recordUsage(node.name)
+	code, err := node.gen(args)
+	if err != nil {
+		return ctx.OrigError(fmt.Errorf("%s: %w", node.name, err), node.position)
+	}
+	writer.WriteString(code)
+	return nil
+}
+
+// registerTag registers a tag whose arguments are a list of expressions
+// passed to gen, recording each use in the active Usage like a filter.
+func registerTag(name string, gen codeGenerator) error {
+	err := pongo2.RegisterTag(name, func(doc *pongo2.Parser, start *pongo2.Token, arguments *pongo2.Parser) (pongo2.INodeTag, *pongo2.Error) {
+		node := &codeTagNode{name: name, position: start, gen: gen}
+		return node, node.parseArgs(arguments)
+	})
+	if err != nil {
+		return fmt.Errorf("registering tag %q: %w", name, err)
+	}
+	return nil
+}
+
+func (node *codeTagNode) parseArgs(arguments *pongo2.Parser) *pongo2.Error {
+	for arguments.Remaining() > 0 {
+		expr, err := arguments.ParseExpression()
+		if err != nil {
+			return err
+		}
+		node.args = append(node.args, expr)
+	}
+	return nil
+}
+
+// cgenGenerators holds the filters that can also be called through the
+// cgen tag, keyed by filter name.
+var cgenGenerators = map[string]codeGenerator{}
+
+// registerCgen makes gen callable as {% cgen name arg1 arg2 ... %}. Filters
+// that pack several arguments into one comma-separated string register
+// here too, so an argument containing a comma can be passed on its own.
+func registerCgen(name string, gen codeGenerator) error {
+	if _, ok := cgenGenerators[name]; ok {
+		return fmt.Errorf("cgen generator %q registered twice", name)
+	}
+	cgenGenerators[name] = gen
+	return nil
+}
+
+// FuncMap returns the cgen generators, built-in and user-defined, as
+// text/template functions taking their arguments one by one. Calls are
+// recorded in the active Usage and once-only generators expand only the
+// first time, as with the filters. Call it after LoadUserFilters.
+// Example usage:
+// {{ safe_fopen "report" "out.csv" "w" }}
+func FuncMap() template.FuncMap {
+	funcs := template.FuncMap{}
+	for name, gen := range cgenGenerators {
+		funcs[name] = func(args ...string) (string, error) {
+			recordUsage(name)
+			if requirements[name].Once && !firstUse(name) {
+				return "", nil
+			}
+			code, err := gen(args)
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", name, err)
+			}
+			return code, nil
+		}
+	}
+	return funcs
+}
+
+// filterCode returns a generator's result from a filter.
+func filterCode(name, code string, err error) (*pongo2.Value, *pongo2.Error) {
+	if err != nil {
+		return nil, &pongo2.Error{OrigError: fmt.Errorf("%s: %w", name, err)}
+	}
+	return pongo2.AsSafeValue(code), nil
+}
+
+func init() {
+	Register(InitCgenTag)
+}
+
+// InitCgenTag registers the cgen tag. Its first argument is a bare
+// generator name, the rest are expressions evaluated one by one; recorded
+// usage is the generator's, so headers come out as for the filter.
+// Example usage:
+// {% cgen snprintf_checked "buf" "sizeof(buf)" "%s, %s" "$first" "$last" %}
+func InitCgenTag() error {
+	err := pongo2.RegisterTag("cgen", func(doc *pongo2.Parser, start *pongo2.Token, arguments *pongo2.Parser) (pongo2.INodeTag, *pongo2.Error) {
+		nameToken := arguments.MatchType(pongo2.TokenIdentifier)
+		if nameToken == nil {
+			return nil, arguments.Error("cgen needs a generator name", nil)
+		}
+		gen, ok := cgenGenerators[nameToken.Val]
+		if !ok {
+			return nil, arguments.Error(fmt.Sprintf("unknown cgen generator %q", nameToken.Val), nameToken)
+		}
+		node := &codeTagNode{name: nameToken.Val, position: start, gen: gen}
+		return node, node.parseArgs(arguments)
+	})
+	if err != nil {
+		return fmt.Errorf("registering tag %q: %w", "cgen", err)
+	}
+	return nil
+}
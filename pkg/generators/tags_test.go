@@ -0,0 +1,57 @@
+package generators
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func TestCgenMatchesFilter(t *testing.T) {
+	tests := []struct {
+		filter, tag string
+	}{
+		{`{{ "f" | safe_fopen : "data.csv,r" }}`, `{% cgen safe_fopen "f" "data.csv" "r" %}`},
+		{`{{ "f" | safe_fopen : "$path,w,soft" }}`, `{% cgen safe_fopen "f" "$path" "w" "soft" %}`},
+		{`{{ "" | snprintf_checked : "buf,sizeof(buf),\"%d/%s\",n,$name" }}`, `{% cgen snprintf_checked "buf" "sizeof(buf)" "%d/%s" "n" "$name" %}`},
+		{`{{ "i,count" | check_bounds }}`, `{% cgen check_bounds "i" "count" %}`},
+		{`{{ "level,-5,10" | check_range }}`, `{% cgen check_range "level" "-5" "10" %}`},
+		{`{{ "mode" | check_enum : "fast|safe" }}`, `{% cgen check_enum "mode" "fast|safe" %}`},
+		{`{{ "volume,0,100" | clamp : "log" }}`, `{% cgen clamp "volume" "0" "100" "log" %}`},
+		{`{{ "got,header_size" | check_min_size }}`, `{% cgen check_min_size "got" "header_size" %}`},
+	}
+	for _, tt := range tests {
+		fromFilter, _ := render(t, tt.filter)
+		fromTag, _ := render(t, tt.tag)
+		if fromFilter != fromTag {
+			t.Errorf("%s and %s differ:\n%s\n---\n%s", tt.filter, tt.tag, fromFilter, fromTag)
+		}
+	}
+}
+
+func TestCgenArgumentsWithCommasAndQuotes(t *testing.T) {
+	out := renderAndRun(t, `int main(void) {
+    char buf[64];
+    const char *last = "Lovelace";
+    {% cgen snprintf_checked "buf" "sizeof(buf)" "%s, \"%s\" (%d)" "$last" "Ada, Countess" "1815" %}
+    puts(buf);
+    size_t got = 8;
+    {% cgen check_min_size "got > 4 ? got : 0" "sizeof(int[2])" %}
+    puts("size ok");
+    return 0;
+}
+`, sanitize)
+	if want := "Lovelace, \"Ada, Countess\" (1815)\nsize ok\n"; out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+}
+
+func TestCgenUnknownGenerator(t *testing.T) {
+	if err := InitAll(); err != nil {
+		t.Fatalf("InitAll: %v", err)
+	}
+	_, err := pongo2.FromString(`{% cgen no_such_thing "x" %}`)
+	if err == nil || !strings.Contains(err.Error(), `unknown cgen generator "no_such_thing"`) {
+		t.Errorf("got %v, want an unknown generator error", err)
+	}
+}
@@ -0,0 +1,142 @@
+package generators
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func init() {
+	Register(InitTermFilters)
+}
+
+var termColors = []string{"BLACK", "RED", "GREEN", "YELLOW", "BLUE", "MAGENTA", "CYAN", "WHITE"}
+
+func InitTermFilters() error {
+	var errs []error
+
+	// ANSI color macros for stdout, include once at file scope. They are
+	// empty strings when stdout isn't a terminal or NO_COLOR is set, so
+	// redirected output stays clean. Checked once, on first use.
+	// Example usage:
+	// {{ "" | generate_colors }}
+	// Then in code:
+	// printf("%sok%s\n", COLOR_GREEN, COLOR_RESET);
+	errs = append(errs, registerFilter("generate_colors", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		var macros strings.Builder
+		for i, name := range termColors {
+			fmt.Fprintf(&macros, "#define COLOR_%s term_color(\"\\033[%dm\")\n", name, 30+i)
+		}
+		code := fmt.Sprintf(
+			`static int term_color_enabled = -1;
+
+static const char *term_color(const char *code) {
+    if (term_color_enabled == -1) {
+        const char *no_color = getenv("NO_COLOR");
+        term_color_enabled = isatty(fileno(stdout)) && !(no_color && *no_color);
+    }
+    return term_color_enabled ? code : "";
+}
+
+%[1]s#define COLOR_BOLD term_color("\033[1m")
+#define COLOR_RESET term_color("\033[0m")`,
+			macros.String())
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// printf in a color, reset afterwards. Needs {{ "" | generate_colors }}.
+	// Example usage:
+	// {% color_printf "RED" "error: %s" "$msg" %}
+	errs = append(errs, registerTag("color_printf", func(args []string) (string, error) {
+		if len(args) < 2 {
+			return "", fmt.Errorf("needs color, format[, args...]")
+		}
+		color := strings.ToUpper(strings.TrimSpace(args[0]))
+		found := color == "BOLD"
+		for _, c := range termColors {
+			found = found || c == color
+		}
+		if !found {
+			return "", fmt.Errorf("unknown color %q, want BOLD or one of %s", args[0], strings.Join(termColors, ", "))
+		}
+		format, fmtArgs, err := formatCall(args[1:])
+		if err != nil {
+			return "", err
+		}
+		code := fmt.Sprintf(
+			`fputs(COLOR_%[1]s, stdout);
+printf(%[2]s%[3]s);
+fputs(COLOR_RESET, stdout);`,
+			color, format, fmtArgs)
+		return code, nil
+	}))
+
+	// A progress bar redrawn in place on stdout, with a percentage and an
+	// ETA from the elapsed time so far. State is named after the bar, so
+	// several can coexist. Update with progress_update and finish with
+	// progress_done.
+	// Example usage:
+	// {{ "download" | progress_bar : "total_bytes" }}
+	// {{ "download" | progress_update : "received" }}
+	// {{ "download" | progress_done }}
+	errs = append(errs, registerFilter("progress_bar", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		total := strings.TrimSpace(param.String())
+		if total == "" {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("progress_bar needs a total")}
+		}
+		code := fmt.Sprintf(
+			`double %[1]s_total = (double)(%[2]s);
+struct timespec %[1]s_start;
+clock_gettime(CLOCK_MONOTONIC, &%[1]s_start);`,
+			in.String(), total)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Example usage:
+	// {{ "download" | progress_update : "received" }}
+	errs = append(errs, registerFilter("progress_update", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		current := strings.TrimSpace(param.String())
+		if current == "" {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("progress_update needs the current value")}
+		}
+		code := fmt.Sprintf(
+			`{
+    double frac_%[1]s = %[1]s_total > 0 ? (double)(%[2]s) / %[1]s_total : 1.0;
+    if (frac_%[1]s < 0) {
+        frac_%[1]s = 0;
+    } else if (frac_%[1]s > 1) {
+        frac_%[1]s = 1;
+    }
+    struct timespec now_%[1]s;
+    clock_gettime(CLOCK_MONOTONIC, &now_%[1]s);
+    double elapsed_%[1]s = (double)(now_%[1]s.tv_sec - %[1]s_start.tv_sec) +
+                           (double)(now_%[1]s.tv_nsec - %[1]s_start.tv_nsec) / 1e9;
+    char bar_%[1]s[41];
+    int filled_%[1]s = (int)(frac_%[1]s * 40);
+    memset(bar_%[1]s, '#', (size_t)filled_%[1]s);
+    memset(bar_%[1]s + filled_%[1]s, '-', (size_t)(40 - filled_%[1]s));
+    bar_%[1]s[40] = '\0';
+    char eta_%[1]s[32] = "--:--";
+    if (frac_%[1]s > 0 && frac_%[1]s < 1) {
+        long left_%[1]s = (long)(elapsed_%[1]s * (1 - frac_%[1]s) / frac_%[1]s + 0.5);
+        snprintf(eta_%[1]s, sizeof(eta_%[1]s), "%%02ld:%%02ld", left_%[1]s / 60, left_%[1]s %% 60);
+    } else if (frac_%[1]s >= 1) {
+        snprintf(eta_%[1]s, sizeof(eta_%[1]s), "00:00");
+    }
+    printf("\r%[1]s [%%s] %%3d%%%% ETA %%s ", bar_%[1]s, (int)(frac_%[1]s * 100), eta_%[1]s);
+    fflush(stdout);
+}`,
+			in.String(), current)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Example usage:
+	// {{ "download" | progress_done }}
+	errs = append(errs, registerFilter("progress_done", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return pongo2.AsSafeValue("putchar('\\n');\nfflush(stdout);"), nil
+	}))
+
+	return errors.Join(errs...)
+}
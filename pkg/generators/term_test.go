@@ -0,0 +1,62 @@
+package generators
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestGenerateColorsRender(t *testing.T) {
+	src, _ := render(t, `{{ "" | generate_colors }}`)
+	for _, want := range []string{
+		`#define COLOR_RED term_color("\033[31m")`,
+		`#define COLOR_WHITE term_color("\033[37m")`,
+		`#define COLOR_RESET term_color("\033[0m")`,
+		`isatty(fileno(stdout))`,
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("generate_colors output lacks %s:\n%s", want, src)
+		}
+	}
+}
+
+func TestTermSmoke(t *testing.T) {
+	out := renderAndRun(t, `{{ "" | generate_colors }}
+int main(void) {
+    const char *name = "colors";
+    {% color_printf "red" "%s=%d" "$name" "7" %}
+    printf("\n[%s%s]\n", COLOR_BOLD, COLOR_RESET);
+
+    {{ "files" | progress_bar : "4" }}
+    {{ "bytes" | progress_bar : "1000" }}
+    for (int i = 0; i <= 4; i += 2) {
+        {{ "files" | progress_update : "i" }}
+        {{ "bytes" | progress_update : "i * 500" }}
+    }
+    {{ "files" | progress_done }}
+    {
+        {{ "empty" | progress_bar : "0" }}
+        {{ "empty" | progress_update : "0" }}
+        {{ "empty" | progress_done }}
+    }
+    return 0;
+}
+`, sanitize)
+
+	// stdout is a pipe here, so the color macros are empty.
+	head, bars, ok := strings.Cut(out, "[]\n")
+	if !ok || head != "colors=7\n" {
+		t.Fatalf("colored output = %q, want it without escape codes", out)
+	}
+	bar := func(name string, filled int, percent, eta string) string {
+		return regexp.QuoteMeta("\r"+name+" ["+strings.Repeat("#", filled)+strings.Repeat("-", 40-filled)+"] "+percent+"% ETA ") + eta + " "
+	}
+	want := "^" +
+		bar("files", 0, "  0", "--:--") + bar("bytes", 0, "  0", "--:--") +
+		bar("files", 20, " 50", `\d\d:\d\d`) + bar("bytes", 40, "100", "00:00") +
+		bar("files", 40, "100", "00:00") + bar("bytes", 40, "100", "00:00") + "\n" +
+		bar("empty", 40, "100", "00:00") + "\n$"
+	if !regexp.MustCompile(want).MatchString(bars) {
+		t.Errorf("progress output %q doesn't match %q", bars, want)
+	}
+}
@@ -0,0 +1,108 @@
+package generators
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func init() {
+	Register(InitTestingFilters)
+}
+
+func InitTestingFilters() error {
+	var errs []error
+
+	// A tiny test framework, include once at file scope. TEST bodies
+	// register themselves (GCC/Clang constructor attribute); failed
+	// assertions print file:line and the test carries on. RUN_ALL_TESTS()
+	// prints a summary and returns the number of failed tests.
+	// Example usage:
+	// {{ "" | generate_test_harness }}
+	// TEST(addition) { ASSERT_EQ_INT(1 + 1, 2); }
+	// int main(void) { return RUN_ALL_TESTS(); }
+	errs = append(errs, registerFilter("generate_test_harness", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := `#define TEST_MAX 256
+
+static struct {
+    const char *name;
+    void (*fn)(void);
+} test_registry[TEST_MAX];
+static int test_count = 0;
+static int test_current_failed = 0;
+
+static void test_register(const char *name, void (*fn)(void)) {
+    if (test_count == TEST_MAX) {
+        fprintf(stderr, "Too many tests (max %d)\n", TEST_MAX);
+        exit(EXIT_FAILURE);
+    }
+    test_registry[test_count].name = name;
+    test_registry[test_count].fn = fn;
+    test_count++;
+}
+
+#define TEST(name) \
+    static void test_##name(void); \
+    __attribute__((constructor)) static void test_register_##name(void) { \
+        test_register(#name, test_##name); \
+    } \
+    static void test_##name(void)
+
+#define ASSERT_TRUE(cond) do { \
+    if (!(cond)) { \
+        fprintf(stderr, "%s:%d: expected %s\n", __FILE__, __LINE__, #cond); \
+        test_current_failed = 1; \
+    } \
+} while (0)
+
+#define ASSERT_EQ_INT(actual, expected) do { \
+    long long actual_ = (long long)(actual), expected_ = (long long)(expected); \
+    if (actual_ != expected_) { \
+        fprintf(stderr, "%s:%d: %s == %lld, expected %lld\n", __FILE__, __LINE__, #actual, actual_, expected_); \
+        test_current_failed = 1; \
+    } \
+} while (0)
+
+#define ASSERT_EQ_STR(actual, expected) do { \
+    const char *actual_ = (actual), *expected_ = (expected); \
+    if (!actual_ || !expected_ ? actual_ != expected_ : strcmp(actual_, expected_) != 0) { \
+        fprintf(stderr, "%s:%d: %s == \"%s\", expected \"%s\"\n", __FILE__, __LINE__, #actual, \
+                actual_ ? actual_ : "(null)", expected_ ? expected_ : "(null)"); \
+        test_current_failed = 1; \
+    } \
+} while (0)
+
+static int run_all_tests(void) {
+    int failed = 0;
+    for (int i = 0; i < test_count; i++) {
+        test_current_failed = 0;
+        test_registry[i].fn();
+        printf("[%s] %s\n", test_current_failed ? "FAIL" : " OK ", test_registry[i].name);
+        failed += test_current_failed;
+    }
+    printf("%d passed, %d failed\n", test_count - failed, failed);
+    return failed;
+}
+
+#define RUN_ALL_TESTS() run_all_tests()`
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Invariant check that stays on in release builds: prints the message,
+	// the condition and where it failed, then aborts.
+	// Example usage:
+	// {{ "count <= capacity" | check_assert : "buffer overrun" }}
+	errs = append(errs, registerFilter("check_assert", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		cond := in.String()
+		code := fmt.Sprintf(
+			`if (!(%[1]s)) {
+    fprintf(stderr, "Assertion failed: %%s (%%s) at %%s:%%d\n", %[2]s, %[3]s, __FILE__, __LINE__);
+    abort();
+}`,
+			cond, quoteText(param.String()), cStringLiteral(cond))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,59 @@
+package generators
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestHarness(t *testing.T) {
+	src, libs := render(t, `{{ "" | generate_test_harness }}
+#include <string.h>
+TEST(addition) { ASSERT_EQ_INT(1 + 1, 2); }
+TEST(strings) { ASSERT_EQ_STR("cccp", "cccp"); ASSERT_EQ_STR(NULL, NULL); }
+TEST(broken) {
+    ASSERT_EQ_INT(2 * 2, 5);
+    ASSERT_EQ_STR("a", NULL);
+    ASSERT_TRUE(1 > 2);
+}
+TEST(also_broken) { ASSERT_TRUE(0); }
+int main(void) { return RUN_ALL_TESTS(); }
+`)
+	bin := compileC(t, src, libs, sanitize)
+	stdout, stderr, code := runC(t, bin, "")
+	if code != 2 {
+		t.Errorf("got exit %d, want 2 (the failed test count)", code)
+	}
+	want := []string{"2 passed, 2 failed", "[ OK ] addition", "[ OK ] strings", "[FAIL] also_broken", "[FAIL] broken"}
+	if got := sortedLines(stdout); !slices.Equal(got, want) {
+		t.Errorf("got stdout %q, want %q", got, want)
+	}
+	for _, msg := range []string{
+		"2 * 2 == 4, expected 5",
+		`"a" == "a", expected "(null)"`,
+		"expected 1 > 2",
+		"expected 0",
+	} {
+		if !strings.Contains(stderr, msg) {
+			t.Errorf("stderr lacks %q:\n%s", msg, stderr)
+		}
+	}
+}
+
+func TestCheckAssert(t *testing.T) {
+	src, libs := render(t, `int main(int argc, char **argv) {
+    (void)argv;
+    {{ "argc < 2" | check_assert : "too many \"args\"" }}
+    puts("ok");
+    return 0;
+}
+`)
+	bin := compileC(t, src, libs)
+	if stdout, _, code := runC(t, bin, ""); code != 0 || stdout != "ok\n" {
+		t.Errorf("passing assertion: got exit %d, stdout %q", code, stdout)
+	}
+	_, stderr, code := runC(t, bin, "", "extra")
+	if code == 0 || !strings.Contains(stderr, `Assertion failed: too many "args" (argc < 2) at`) {
+		t.Errorf("failing assertion: got exit %d, stderr %q", code, stderr)
+	}
+}
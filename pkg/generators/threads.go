@@ -0,0 +1,216 @@
+package generators
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func init() {
+	Register(InitThreadFilters)
+}
+
+func InitThreadFilters() error {
+	var errs []error
+
+	// Open a thread function, at file scope; its body sees the argument as
+	// void *arg. Close with thread_func_end, which returns NULL if the body
+	// didn't return already.
+	// Example usage:
+	// {{ "worker" | thread_func }}
+	//     int *n = arg;
+	//     ...
+	// {{ "" | thread_func_end }}
+	errs = append(errs, registerFilter("thread_func", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return pongo2.AsSafeValue(fmt.Sprintf("static void *thread_%s(void *arg) {\n    (void)arg;", in.String())), nil
+	}))
+
+	// Example usage:
+	// {{ "" | thread_func_end }}
+	errs = append(errs, registerFilter("thread_func_end", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return pongo2.AsSafeValue("    return NULL;\n}"), nil
+	}))
+
+	// Declares a pthread_t running a thread_func with an argument.
+	// Example usage:
+	// {{ "t1" | thread_start : "worker,&job" }}
+	// {{ "t2" | thread_start : "worker,NULL" }}
+	errs = append(errs, registerFilter("thread_start", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		parts := strings.SplitN(param.String(), ",", 2)
+		if len(parts) != 2 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("thread_start needs func,arg")}
+		}
+		code := fmt.Sprintf(
+			`pthread_t %[1]s;
+{
+    int rc_%[1]s = pthread_create(&%[1]s, NULL, thread_%[2]s, %[3]s);
+    if (rc_%[1]s != 0) {
+        fprintf(stderr, "Failed to start thread %[2]s: %%s\n", strerror(rc_%[1]s));
+        exit(EXIT_FAILURE);
+    }
+}`,
+			in.String(), strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Wait for a thread, optionally declaring a void* for its return value.
+	// Example usage:
+	// {{ "t1" | thread_join }}
+	// {{ "t1" | thread_join : "t1_result" }}
+	errs = append(errs, registerFilter("thread_join", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		handle := in.String()
+		result := strings.TrimSpace(param.String())
+		decl, target := "", "NULL"
+		if result != "" {
+			decl, target = fmt.Sprintf("void *%s = NULL;\n", result), "&"+result
+		}
+		code := fmt.Sprintf(
+			`%[3]s{
+    int rc_%[1]s = pthread_join(%[1]s, %[2]s);
+    if (rc_%[1]s != 0) {
+        fprintf(stderr, "Failed to join thread %[1]s: %%s\n", strerror(rc_%[1]s));
+        exit(EXIT_FAILURE);
+    }
+}`,
+			handle, target, decl)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// A statically initialized mutex, at file scope.
+	// Example usage:
+	// {{ "counter_lock" | mutex_create }}
+	errs = append(errs, registerFilter("mutex_create", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf("static pthread_mutex_t %s = PTHREAD_MUTEX_INITIALIZER;", in.String())
+		if firstUse("mutex_guard") {
+			code += `
+
+static void mutex_guard_unlock(pthread_mutex_t **m) {
+    pthread_mutex_unlock(*m);
+}`
+		}
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Hold a mutex for the rest of a block, closed by with_mutex_end. Like
+	// AUTO_FREE it uses the cleanup attribute, so the mutex is unlocked on
+	// every way out of the block, return and break included.
+	// Example usage:
+	// {{ "counter_lock" | with_mutex }}
+	//     counter++;
+	// {{ "counter_lock" | with_mutex_end }}
+	errs = append(errs, registerFilter("with_mutex", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(
+			`{
+    int rc_%[1]s = pthread_mutex_lock(&%[1]s);
+    if (rc_%[1]s != 0) {
+        fprintf(stderr, "Failed to lock %[1]s: %%s\n", strerror(rc_%[1]s));
+        exit(EXIT_FAILURE);
+    }
+    pthread_mutex_t *guard_%[1]s __attribute__((cleanup(mutex_guard_unlock))) = &%[1]s;
+    (void)guard_%[1]s;`,
+			in.String())
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Example usage:
+	// {{ "counter_lock" | with_mutex_end }}
+	errs = append(errs, registerFilter("with_mutex_end", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return pongo2.AsSafeValue("}"), nil
+	}))
+
+	// The body of a parallel loop, at file scope, with the index as a
+	// size_t named by the parameter. Each thread takes every Nth index.
+	// Shared data is reached from file scope or through void *arg, the
+	// pointer given to parallel_for; writes to it are the body's
+	// responsibility. Run it with parallel_for.
+	// Example usage:
+	// {{ "fill" | parallel_worker : "i" }}
+	//     int *squares = arg;
+	//     squares[i] = (int)(i * i);
+	// {{ "fill" | parallel_worker_end }}
+	errs = append(errs, registerFilter("parallel_worker", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		index := strings.TrimSpace(param.String())
+		if index == "" {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("parallel_worker needs an index name")}
+		}
+		code := fmt.Sprintf(
+			`struct %[1]s_range {
+    size_t first;
+    size_t step;
+    size_t count;
+    void *arg;
+};
+
+static void *%[1]s_worker(void *range_arg) {
+    const struct %[1]s_range *range = range_arg;
+    void *arg = range->arg;
+    (void)arg;
+    for (size_t %[2]s = range->first; %[2]s < range->count; %[2]s += range->step) {`,
+			in.String(), index)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Example usage:
+	// {{ "fill" | parallel_worker_end }}
+	errs = append(errs, registerFilter("parallel_worker_end", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return pongo2.AsSafeValue("    }\n    return NULL;\n}"), nil
+	}))
+
+	// Run a parallel_worker over indexes [0, count) on a number of threads
+	// and wait for all of them, passing an optional pointer as the body's
+	// arg (NULL by default). All three are evaluated once.
+	// Example usage:
+	// {{ "fill" | parallel_for : "1000,4" }}
+	// {{ "fill" | parallel_for : "n,4,squares" }}
+	errs = append(errs, registerFilter("parallel_for", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		parts := strings.Split(param.String(), ",")
+		if len(parts) != 2 && len(parts) != 3 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("parallel_for needs count,threads[,arg]")}
+		}
+		arg := "NULL"
+		if len(parts) == 3 {
+			arg = strings.TrimSpace(parts[2])
+		}
+		code := fmt.Sprintf(
+			`{
+    size_t %[1]s_count = (size_t)(%[2]s);
+    size_t %[1]s_nthreads = (size_t)(%[3]s);
+    void *%[1]s_arg = (%[4]s);
+    if (%[1]s_nthreads == 0) {
+        %[1]s_nthreads = 1;
+    }
+    pthread_t *%[1]s_handles = malloc(%[1]s_nthreads * sizeof(pthread_t));
+    struct %[1]s_range *%[1]s_ranges = malloc(%[1]s_nthreads * sizeof(struct %[1]s_range));
+    if (!%[1]s_handles || !%[1]s_ranges) {
+        fprintf(stderr, "Failed to get memory for %[1]s threads\n");
+        exit(EXIT_FAILURE);
+    }
+    for (size_t t = 0; t < %[1]s_nthreads; t++) {
+        %[1]s_ranges[t].first = t;
+        %[1]s_ranges[t].step = %[1]s_nthreads;
+        %[1]s_ranges[t].count = %[1]s_count;
+        %[1]s_ranges[t].arg = %[1]s_arg;
+        int rc = pthread_create(&%[1]s_handles[t], NULL, %[1]s_worker, &%[1]s_ranges[t]);
+        if (rc != 0) {
+            fprintf(stderr, "Failed to start %[1]s thread: %%s\n", strerror(rc));
+            exit(EXIT_FAILURE);
+        }
+    }
+    for (size_t t = 0; t < %[1]s_nthreads; t++) {
+        int rc = pthread_join(%[1]s_handles[t], NULL);
+        if (rc != 0) {
+            fprintf(stderr, "Failed to join %[1]s thread: %%s\n", strerror(rc));
+            exit(EXIT_FAILURE);
+        }
+    }
+    free(%[1]s_handles);
+    free(%[1]s_ranges);
+}`,
+			in.String(), strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), arg)
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,72 @@
+package generators
+
+import "testing"
+
+func TestParallelForFillsCallerArray(t *testing.T) {
+	out := renderAndRun(t, `{{ "fill" | parallel_worker : "i" }}
+    long *squares = arg;
+    squares[i] = (long)(i * i);
+{{ "fill" | parallel_worker_end }}
+
+{{ "count" | parallel_worker : "i" }}
+{{ "count" | parallel_worker_end }}
+
+int main(void) {
+    long squares[1000] = {0};
+    {{ "fill" | parallel_for : "1000,4,squares" }}
+    {{ "count" | parallel_for : "10,3" }}
+    long sum = 0;
+    for (size_t i = 0; i < 1000; i++) {
+        if (squares[i] != (long)(i * i)) {
+            printf("squares[%zu] = %ld\n", i, squares[i]);
+            return 1;
+        }
+        sum += squares[i];
+    }
+    printf("%ld\n", sum);
+    return 0;
+}
+`, "-fsanitize=thread")
+	if want := "332833500\n"; out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+}
+
+func TestThreadsShareCounterUnderMutex(t *testing.T) {
+	out := renderAndRun(t, `{{ "counter_lock" | mutex_create }}
+{{ "other_lock" | mutex_create }}
+static long counter;
+
+{{ "bump" | thread_func }}
+    long n = *(long *)arg;
+    for (long i = 0; i < n; i++) {
+        {{ "counter_lock" | with_mutex }}
+            counter++;
+            if (i == n - 1) break;
+        {{ "counter_lock" | with_mutex_end }}
+    }
+{{ "" | thread_func_end }}
+
+{{ "answer" | thread_func }}
+    static long value = 42;
+    return &value;
+{{ "" | thread_func_end }}
+
+int main(void) {
+    long n = 10000;
+    {{ "t1" | thread_start : "bump,&n" }}
+    {{ "t2" | thread_start : "bump,&n" }}
+    {{ "t3" | thread_start : "answer,NULL" }}
+    {{ "t1" | thread_join }}
+    {{ "t2" | thread_join }}
+    {{ "t3" | thread_join : "t3_result" }}
+    {{ "counter_lock" | with_mutex }}
+        printf("%ld %ld\n", counter, *(long *)t3_result);
+    {{ "counter_lock" | with_mutex_end }}
+    return 0;
+}
+`, "-fsanitize=thread")
+	if want := "20000 42\n"; out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+}
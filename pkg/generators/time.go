@@ -0,0 +1,109 @@
+package generators
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func init() {
+	Register(InitTimeFilters)
+}
+
+func InitTimeFilters() error {
+	var errs []error
+
+	// Local time as e.g. 2024-05-01T13:45:00+0200 in a char[32].
+	// Example usage:
+	// {{ "stamp" | now_iso8601 }}
+	errs = append(errs, registerFilter("now_iso8601", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(
+			`char %[1]s[32] = "";
+{
+    time_t now_%[1]s = time(NULL);
+    struct tm tm_%[1]s;
+    if (localtime_r(&now_%[1]s, &tm_%[1]s)) {
+        strftime(%[1]s, sizeof(%[1]s), "%%Y-%%m-%%dT%%H:%%M:%%S%%z", &tm_%[1]s);
+    }
+}`,
+			in.String())
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Format a time_t expression with a strftime format (quoted and
+	// escaped for you) into a char[128]. The result is empty if it
+	// doesn't fit.
+	// Example usage:
+	// {{ "when" | format_time : "st.st_mtime,%Y-%m-%d %H:%M" }}
+	errs = append(errs, registerFilter("format_time", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		parts := strings.SplitN(param.String(), ",", 2)
+		if len(parts) != 2 {
+			return nil, &pongo2.Error{OrigError: fmt.Errorf("format_time needs time,format")}
+		}
+		code := fmt.Sprintf(
+			`char %[1]s[128] = "";
+{
+    time_t t_%[1]s = %[2]s;
+    struct tm tm_%[1]s;
+    if (localtime_r(&t_%[1]s, &tm_%[1]s) &&
+        strftime(%[1]s, sizeof(%[1]s), %[3]s, &tm_%[1]s) == 0) {
+        %[1]s[0] = '\0';
+    }
+}`,
+			in.String(), strings.TrimSpace(parts[0]), cStringLiteral(strings.TrimSpace(parts[1])))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Start a monotonic stopwatch. The name prefixes the generated
+	// variable, so several timers can run in the same scope.
+	// Example usage:
+	// {{ "parse" | timer_start }}
+	errs = append(errs, registerFilter("timer_start", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(
+			`struct timespec %[1]s_timer_start;
+clock_gettime(CLOCK_MONOTONIC, &%[1]s_timer_start);`,
+			in.String())
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Milliseconds (as a double) since the named timer_start.
+	// Example usage:
+	// {{ "parse_ms" | timer_elapsed_ms : "parse" }}
+	errs = append(errs, registerFilter("timer_elapsed_ms", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(
+			`double %[1]s;
+{
+    struct timespec end_%[1]s;
+    clock_gettime(CLOCK_MONOTONIC, &end_%[1]s);
+    time_t sec_%[1]s = end_%[1]s.tv_sec - %[2]s_timer_start.tv_sec;
+    long nsec_%[1]s = end_%[1]s.tv_nsec - %[2]s_timer_start.tv_nsec;
+    if (nsec_%[1]s < 0) {
+        sec_%[1]s--;
+        nsec_%[1]s += 1000000000L;
+    }
+    %[1]s = (double)sec_%[1]s * 1000.0 + (double)nsec_%[1]s / 1e6;
+}`,
+			in.String(), strings.TrimSpace(param.String()))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Sleep for a number of milliseconds, resuming after signal interrupts.
+	// Example usage:
+	// {{ "250" | sleep_ms }}
+	// {{ "delay_ms * 2" | sleep_ms }}
+	errs = append(errs, registerFilter("sleep_ms", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(
+			`{
+    long _sleep_ms = (long)(%[1]s);
+    struct timespec _sleep_req = {_sleep_ms / 1000, (_sleep_ms %% 1000) * 1000000L};
+    while (nanosleep(&_sleep_req, &_sleep_req) == -1 && errno == EINTR) {
+    }
+}`,
+			in.String())
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	return errors.Join(errs...)
+}
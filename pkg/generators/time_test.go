@@ -0,0 +1,47 @@
+package generators
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestTimeFilters(t *testing.T) {
+	t.Setenv("TZ", "UTC")
+	out := renderAndRun(t, `#include <stdio.h>
+int main(void) {
+    {{ "stamp" | now_iso8601 }}
+    printf("%s\n", stamp);
+    {{ "when" | format_time : "(time_t)1577934245,%Y-%m-%d %H:%M:%S \"%%\"" }}
+    printf("%s\n", when);
+    {{ "too_long" | format_time : "0,%Y%Y%Y%Y%Y%Y%Y%Y%Y%Y%Y%Y%Y%Y%Y%Y%Y%Y%Y%Y%Y%Y%Y%Y%Y%Y%Y%Y%Y%Y%Y%Y%Y" }}
+    printf("[%s]\n", too_long);
+
+    {{ "outer" | timer_start }}
+    {{ "inner" | timer_start }}
+    long sleep_ms = 30;
+    {{ "sleep_ms" | sleep_ms }}
+    {{ "inner_ms" | timer_elapsed_ms : "inner" }}
+    {{ "sleep_ms / 3" | sleep_ms }}
+    {{ "outer_ms" | timer_elapsed_ms : "outer" }}
+    printf("%d %d %d\n", inner_ms >= 30, outer_ms >= 40, outer_ms >= inner_ms + 10);
+    return 0;
+}
+`, sanitize)
+	lines := strings.Split(out, "\n")
+	if len(lines) != 5 {
+		t.Fatalf("got output %q", out)
+	}
+	if !regexp.MustCompile(`^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\+0000$`).MatchString(lines[0]) {
+		t.Errorf("now_iso8601 = %q", lines[0])
+	}
+	if want := `2020-01-02 03:04:05 "%"`; lines[1] != want {
+		t.Errorf("format_time = %q, want %q", lines[1], want)
+	}
+	if lines[2] != "[]" {
+		t.Errorf("format_time overflow = %q, want empty", lines[2])
+	}
+	if lines[3] != "1 1 1" {
+		t.Errorf("timer checks = %q, want all true", lines[3])
+	}
+}
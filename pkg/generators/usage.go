@@ -0,0 +1,304 @@
+package generators
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+// Requirement lists the headers and link flags the code generated by a
+// filter needs in order to compile. Once marks file-scope filters whose
+// definitions may appear only once per output file: repeat uses in the
+// same render emit nothing instead of duplicate C symbols.
+type Requirement struct {
+	Headers []string
+	Libs    []string
+	Once    bool
+}
+
+var (
+	stdioHeaders   = []string{"stdio.h", "stdlib.h"}
+	stringHeaders  = []string{"string.h"}
+	curlHeaders    = []string{"stdio.h", "stdlib.h", "string.h", "curl/curl.h"}
+	cJSONHeaders   = []string{"stdio.h", "stdlib.h", "cjson/cJSON.h"}
+	statHeaders    = []string{"errno.h", "stdbool.h", "stdio.h", "stdlib.h", "sys/stat.h"}
+	tempHeaders    = []string{"errno.h", "limits.h", "stdio.h", "stdlib.h", "string.h"}
+	lockHeaders    = []string{"errno.h", "fcntl.h", "stdio.h", "stdlib.h", "string.h", "sys/file.h", "unistd.h"}
+	pthreadHeaders = []string{"pthread.h", "stdio.h", "stdlib.h", "string.h"}
+	walkHeaders    = []string{"dirent.h", "limits.h", "stdbool.h", "stdio.h", "stdlib.h", "string.h", "sys/stat.h"}
+	processHeaders = []string{"errno.h", "stdio.h", "stdlib.h", "string.h", "sys/types.h", "sys/wait.h", "unistd.h"}
+	mmapHeaders    = []string{"errno.h", "fcntl.h", "stdio.h", "stdlib.h", "string.h", "sys/mman.h", "sys/stat.h", "unistd.h"}
+	netHeaders     = []string{"arpa/inet.h", "errno.h", "netdb.h", "netinet/in.h", "stdint.h", "stdio.h", "stdlib.h", "string.h", "sys/socket.h", "unistd.h"}
+)
+
+// requirements is keyed by filter (or tag) name. Entries missing here need
+// nothing beyond what the template already includes.
+var requirements = map[string]Requirement{
+	"generate_error_macros": {Headers: []string{"stdint.h", "stdio.h", "stdlib.h"}, Once: true},
+	"safe_fopen":            {Headers: []string{"errno.h", "stdio.h", "stdlib.h", "string.h"}},
+	"open_directory":        {Headers: []string{"stdio.h", "stdlib.h", "dirent.h"}},
+	"close_directory":       {Headers: []string{"dirent.h"}},
+	"auto_free_generic":     {Headers: []string{"stdlib.h"}, Once: true},
+	"get_memory":            {Headers: stdioHeaders},
+	"get_zeroed_memory":     {Headers: stdioHeaders},
+	"generate_auto_cleanup": {Headers: []string{"stdio.h", "stdlib.h", "dirent.h"}, Once: true},
+	"copy_string":           {Headers: stringHeaders},
+	"auto_cleanup_array":    {Headers: []string{"stdlib.h"}},
+	"check_null":            {Headers: stdioHeaders},
+	"check_syscall":         {Headers: stdioHeaders},
+	"generate_result":       {Headers: []string{"stdarg.h", "stdbool.h", "stdio.h"}, Once: true},
+	"check_null_soft":       {Headers: []string{"errno.h"}},
+	"check_syscall_soft":    {Headers: []string{"errno.h", "string.h"}},
+	"check_bounds":          {Headers: []string{"stdint.h", "stdio.h", "stdlib.h"}},
+	"check_range":           {Headers: []string{"stdint.h", "stdio.h", "stdlib.h"}},
+	"check_enum":            {Headers: []string{"stdio.h", "stdlib.h", "string.h"}},
+	"clamp":                 {Headers: []string{"stdint.h", "stdio.h"}},
+	"check_args":            {Headers: stdioHeaders},
+	"check_min_size":        {Headers: []string{"stdint.h", "stdio.h", "stdlib.h"}},
+	"string_copy":           {Headers: stringHeaders},
+	"string_append_bounded": {Headers: []string{"stdio.h", "stdlib.h", "string.h"}},
+	"string_upper_copy":     {Headers: []string{"stdlib.h", "string.h", "ctype.h"}},
+	"write_string":          {Headers: []string{"unistd.h"}},
+	"newline":               {Headers: []string{"unistd.h"}},
+	"snprintf_checked":      {Headers: []string{"stdio.h"}},
+	"http_callback":         {Headers: curlHeaders, Libs: []string{"-lcurl"}, Once: true},
+	"http_get":              {Headers: curlHeaders, Libs: []string{"-lcurl"}},
+	"http_post":             {Headers: curlHeaders, Libs: []string{"-lcurl"}},
+	"curl_init":             {Headers: curlHeaders, Libs: []string{"-lcurl"}},
+	"curl_setopt":           {Headers: curlHeaders, Libs: []string{"-lcurl"}},
+	"curl_perform":          {Headers: curlHeaders, Libs: []string{"-lcurl"}},
+	"curl_headers":          {Headers: curlHeaders, Libs: []string{"-lcurl"}},
+	"curl_bearer":           {Headers: curlHeaders, Libs: []string{"-lcurl"}},
+	"curl_timeout":          {Headers: curlHeaders, Libs: []string{"-lcurl"}},
+	"curl_follow_redirects": {Headers: curlHeaders, Libs: []string{"-lcurl"}},
+	"http_download":         {Headers: curlHeaders, Libs: []string{"-lcurl"}},
+	"http_get_with_retry":   {Headers: append([]string{"errno.h", "time.h"}, curlHeaders...), Libs: []string{"-lcurl"}},
+	"json_parse":            {Headers: cJSONHeaders, Libs: []string{"-lcjson"}},
+	"json_get_string":       {Headers: cJSONHeaders, Libs: []string{"-lcjson"}},
+	"json_get_int":          {Headers: cJSONHeaders, Libs: []string{"-lcjson"}},
+	"json_get_array_len":    {Headers: cJSONHeaders, Libs: []string{"-lcjson"}},
+	"json_array_foreach":    {Headers: cJSONHeaders, Libs: []string{"-lcjson"}},
+	"json_free":             {Headers: cJSONHeaders, Libs: []string{"-lcjson"}},
+	"csv_reader":            {Headers: []string{"stdio.h", "stdlib.h", "sys/types.h"}, Once: true},
+	"csv_open":              {Headers: stdioHeaders},
+	"csv_close":             {Headers: []string{"stdio.h", "stdlib.h"}},
+	"cli_options":           {Headers: []string{"errno.h", "getopt.h", "limits.h", "stdio.h", "stdlib.h"}},
+	"cli_positional":        {Headers: []string{"getopt.h"}},
+	"env_string":            {Headers: []string{"stdlib.h"}},
+	"env_int":               {Headers: []string{"errno.h", "limits.h", "stdio.h", "stdlib.h"}},
+	"env_required":          {Headers: stdioHeaders},
+	"string_split":          {Headers: []string{"stdio.h", "stdlib.h", "string.h"}},
+	"string_split_free":     {Headers: []string{"stdlib.h"}},
+	"string_trim":           {Headers: []string{"ctype.h", "stdio.h", "stdlib.h", "string.h"}},
+	"string_slice":          {Headers: []string{"stdio.h", "stdlib.h", "string.h"}},
+	"string_replace":        {Headers: []string{"stdio.h", "stdlib.h", "string.h"}},
+	"string_startswith":     {Headers: stringHeaders},
+	"string_endswith":       {Headers: stringHeaders},
+	"string_contains":       {Headers: stringHeaders},
+	"regex_match":           {Headers: []string{"regex.h", "stdbool.h", "stdio.h", "stdlib.h"}},
+	"regex_capture":         {Headers: []string{"regex.h", "stdio.h", "stdlib.h", "string.h"}},
+	"parse_int":             {Headers: []string{"errno.h", "limits.h", "stdbool.h", "stdlib.h"}},
+	"parse_double":          {Headers: []string{"errno.h", "stdbool.h", "stdlib.h"}},
+	"int_to_string":         {Headers: stdioHeaders},
+	"format_alloc":          {Headers: stdioHeaders},
+	"string_builder":        {Headers: stdioHeaders},
+	"builder_append":        {Headers: []string{"stdio.h", "stdlib.h", "string.h"}},
+	"append_format":         {Headers: stdioHeaders},
+	"builder_free":          {Headers: []string{"stdlib.h"}},
+	"base64_table":          {Headers: []string{"stdio.h", "stdlib.h", "string.h"}, Once: true},
+	"base64_encode":         {Headers: []string{"stdlib.h"}},
+	"base64_decode":         {Headers: []string{"stdlib.h"}},
+	"now_iso8601":           {Headers: []string{"time.h"}},
+	"generate_test_harness": {Headers: []string{"stdio.h", "stdlib.h", "string.h"}, Once: true},
+	"check_assert":          {Headers: stdioHeaders},
+	"signal_flag":           {Headers: []string{"signal.h"}},
+	"on_signal":             {Headers: []string{"signal.h", "stdio.h", "stdlib.h", "string.h"}},
+	"graceful_shutdown":     {Headers: []string{"signal.h", "stdio.h", "stdlib.h", "string.h"}},
+	"thread_func":           {Headers: pthreadHeaders, Libs: []string{"-lpthread"}},
+	"thread_start":          {Headers: pthreadHeaders, Libs: []string{"-lpthread"}},
+	"thread_join":           {Headers: pthreadHeaders, Libs: []string{"-lpthread"}},
+	"mutex_create":          {Headers: pthreadHeaders, Libs: []string{"-lpthread"}},
+	"with_mutex":            {Headers: pthreadHeaders, Libs: []string{"-lpthread"}},
+	"parallel_worker":       {Headers: pthreadHeaders, Libs: []string{"-lpthread"}},
+	"parallel_for":          {Headers: pthreadHeaders, Libs: []string{"-lpthread"}},
+	"tcp_listen":            {Headers: netHeaders},
+	"tcp_accept_loop":       {Headers: netHeaders},
+	"tcp_connect":           {Headers: netHeaders},
+	"send_all":              {Headers: netHeaders},
+	"recv_line":             {Headers: netHeaders},
+	"udp_socket":            {Headers: append([]string{"sys/time.h"}, netHeaders...)},
+	"udp_bind":              {Headers: netHeaders},
+	"udp_send_to":           {Headers: netHeaders},
+	"udp_recv_from":         {Headers: netHeaders},
+	"run_command":           {Headers: processHeaders},
+	"run_command_argv":      {Headers: processHeaders},
+	"shell_escape":          {Headers: processHeaders},
+	"generate_colors":       {Headers: []string{"stdio.h", "stdlib.h", "unistd.h"}, Once: true},
+	"color_printf":          {Headers: stdioHeaders},
+	"progress_bar":          {Headers: []string{"time.h"}},
+	"progress_update":       {Headers: []string{"stdio.h", "string.h", "time.h"}},
+	"progress_done":         {Headers: stdioHeaders},
+	"prompt_string":         {Headers: []string{"stdio.h", "string.h"}},
+	"prompt_int":            {Headers: []string{"errno.h", "limits.h", "stdbool.h", "stdio.h", "stdlib.h", "string.h"}},
+	"confirm":               {Headers: []string{"stdbool.h", "stdio.h", "string.h", "strings.h"}},
+	"prompt_password":       {Headers: []string{"stdbool.h", "stdio.h", "string.h", "termios.h", "unistd.h"}},
+	"daemonize":             {Headers: []string{"fcntl.h", "stdio.h", "stdlib.h", "unistd.h"}},
+	"pidfile_helpers":       {Headers: []string{"limits.h", "sys/types.h", "unistd.h"}, Once: true},
+	"pidfile_create":        {Headers: []string{"errno.h", "fcntl.h", "signal.h", "stdio.h", "stdlib.h", "string.h", "unistd.h"}},
+	"pidfile_remove":        {Headers: []string{"errno.h", "stdio.h", "string.h", "unistd.h"}},
+	"mmap_file":             {Headers: mmapHeaders},
+	"mmap_file_writable":    {Headers: mmapHeaders},
+	"arena_create":          {Headers: []string{"stddef.h", "stdint.h", "stdio.h", "stdlib.h", "string.h"}},
+	"generate_rcstring":     {Headers: []string{"stdio.h", "stdlib.h", "string.h"}, Once: true},
+	"munmap_file":           {Headers: []string{"stdio.h", "stdlib.h", "sys/mman.h"}},
+	"generate_logging":      {Headers: []string{"stdarg.h", "stdio.h", "stdlib.h", "strings.h", "time.h", "unistd.h"}, Once: true},
+	"format_time":           {Headers: []string{"time.h"}},
+	"timer_start":           {Headers: []string{"time.h"}},
+	"timer_elapsed_ms":      {Headers: []string{"time.h"}},
+	"sleep_ms":              {Headers: []string{"errno.h", "time.h"}},
+	"write_file":            {Headers: stdioHeaders},
+	"append_file":           {Headers: stdioHeaders},
+	"read_file_all":         {Headers: stdioHeaders},
+	"file_exists":           {Headers: statHeaders},
+	"file_size":             {Headers: statHeaders},
+	"file_mtime":            {Headers: append([]string{"time.h"}, statHeaders...)},
+	"is_directory":          {Headers: statHeaders},
+	"fs_helpers":            {Headers: []string{"dirent.h", "errno.h", "fcntl.h", "limits.h", "stdio.h", "stdlib.h", "string.h", "sys/stat.h", "unistd.h"}, Once: true},
+	"mkdir_all":             {Headers: []string{"errno.h", "stdio.h", "stdlib.h", "string.h"}},
+	"copy_file":             {Headers: []string{"errno.h", "stdio.h", "stdlib.h", "string.h"}},
+	"move_file":             {Headers: []string{"errno.h", "stdio.h", "stdlib.h", "string.h"}},
+	"remove_file":           {Headers: []string{"errno.h", "stdio.h", "stdlib.h", "string.h", "unistd.h"}},
+	"temp_file":             {Headers: tempHeaders},
+	"temp_dir":              {Headers: tempHeaders},
+	"remove_temp_dir":       {Headers: []string{"errno.h", "stdio.h", "stdlib.h", "string.h"}},
+	"walk_dir":              {Headers: walkHeaders},
+	"with_file_lock":        {Headers: lockHeaders},
+	"map_create":            {Headers: []string{"stdbool.h", "stdio.h", "stdlib.h", "string.h"}},
+	"map_get":               {Headers: []string{"stdbool.h"}},
+	"list_create":           {Headers: stdioHeaders},
+	"array_create":          {Headers: []string{"stdio.h", "stdlib.h", "string.h"}},
+	"array_get":             {Headers: []string{"stdbool.h"}},
+	"array_free":            {Headers: []string{"stdlib.h"}},
+	"array_sort":            {Headers: []string{"stdlib.h"}},
+	"array_bsearch":         {Headers: []string{"stdbool.h", "stdlib.h"}},
+	"sort_array":            {Headers: []string{"stdlib.h"}},
+	"stack_create":          {Headers: stdioHeaders},
+	"stack_free":            {Headers: []string{"stdlib.h"}},
+	"queue_create":          {Headers: stdioHeaders},
+	"queue_free":            {Headers: []string{"stdlib.h"}},
+	"ring_create":           {Headers: stdioHeaders},
+	"list_remove_if":        {Headers: []string{"stdlib.h"}},
+	"list_free":             {Headers: []string{"stdlib.h"}},
+	"release_file_lock":     {Headers: []string{"sys/file.h", "unistd.h"}},
+	"append_line_locked":    {Headers: lockHeaders},
+	"walk_dir_recursive":    {Headers: walkHeaders},
+}
+
+// Usage records which filters ran during one render.
+type Usage struct {
+	mu      sync.Mutex
+	filters map[string]bool
+	emitted map[string]bool
+}
+
+var (
+	activeMu    sync.Mutex
+	activeUsage *Usage
+)
+
+// StartUsage begins recording filter usage for a new render. Filter calls
+// are recorded into the returned Usage until the next StartUsage call.
+func StartUsage() *Usage {
+	u := &Usage{filters: map[string]bool{}}
+	activeMu.Lock()
+	activeUsage = u
+	activeMu.Unlock()
+	return u
+}
+
+func recordUsage(name string) {
+	activeMu.Lock()
+	u := activeUsage
+	activeMu.Unlock()
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	u.filters[name] = true
+	u.mu.Unlock()
+}
+
+// firstUse reports whether key is being marked for the first time in the
+// active render. File-scope helpers use it so they are emitted at most once
+// per output file however often the template asks for them.
+func firstUse(key string) bool {
+	activeMu.Lock()
+	u := activeUsage
+	activeMu.Unlock()
+	if u == nil {
+		return true
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.emitted == nil {
+		u.emitted = map[string]bool{}
+	}
+	if u.emitted[key] {
+		return false
+	}
+	u.emitted[key] = true
+	return true
+}
+
+// marked reports whether firstUse has already seen key in the active render.
+func marked(key string) bool {
+	activeMu.Lock()
+	u := activeUsage
+	activeMu.Unlock()
+	if u == nil {
+		return false
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.emitted[key]
+}
+
+// Headers returns the sorted, deduplicated headers needed by the filters used.
+func (u *Usage) Headers() []string {
+	return u.collect(func(r Requirement) []string { return r.Headers })
+}
+
+// Libs returns the sorted, deduplicated link flags needed by the filters used.
+func (u *Usage) Libs() []string {
+	return u.collect(func(r Requirement) []string { return r.Libs })
+}
+
+func (u *Usage) collect(field func(Requirement) []string) []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	var out []string
+	for name := range u.filters {
+		out = append(out, field(requirements[name])...)
+	}
+	slices.Sort(out)
+	return slices.Compact(out)
+}
+
+// registerFilter registers fn with pongo2, recording each call in the
+// active Usage. Registering a name twice is an error.
+func registerFilter(name string, fn pongo2.FilterFunction) error {
+	err := pongo2.RegisterFilter(name, func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		recordUsage(name)
+		if requirements[name].Once && !firstUse(name) {
+			return pongo2.AsSafeValue(""), nil
+		}
+		return fn(in, param)
+	})
+	if err != nil {
+		return fmt.Errorf("registering filter %q: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package generators
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestOnceOnlyEmittedOnce(t *testing.T) {
+	src, _ := render(t, `{{ "" | auto_free_generic }}
+{{ "" | auto_free_generic }}
+{{ "" | auto_free_generic }}
+int main(void) {
+    AUTO_FREE char *buf = malloc(16);
+    return buf == NULL;
+}
+`)
+	if count := strings.Count(src, "static void auto_free_generic"); count != 1 {
+		t.Errorf("auto_free_generic defined %d times, want once:\n%s", count, src)
+	}
+	syntaxCheck(t, src)
+
+	// Each render starts over.
+	again, _ := render(t, `{{ "" | auto_free_generic }}`)
+	if !strings.Contains(again, "static void auto_free_generic") {
+		t.Errorf("a new render did not emit auto_free_generic:\n%s", again)
+	}
+}
+
+func TestEveryOnceOnlyFilterTwice(t *testing.T) {
+	var names []string
+	for name, req := range requirements {
+		// http_callback needs libcurl's headers; http_test.go covers it.
+		if req.Once && name != "http_callback" {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			tpl := `{{ "" | ` + name + ` }}` + "\n"
+			src, _ := render(t, tpl+tpl)
+			once, _ := render(t, tpl)
+			if src != once+"\n" {
+				t.Errorf("second call emitted code again:\n%s", src)
+			}
+			syntaxCheck(t, src)
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package generators
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/flosch/pongo2/v6"
+	"gopkg.in/yaml.v3"
+)
+
+// UserFilter is one shortcode defined in a spec file rather than in Go.
+// Body is a text/template expanded with each parameter name bound to its
+// argument, e.g. {{.name}}, plus the cescape, cformat_escape, quote (text
+// is quoted, a $-marked variable left alone) and text (always quoted)
+// functions.
+type UserFilter struct {
+	Name    string   `json:"name" yaml:"name"`
+	Params  []string `json:"params" yaml:"params"`
+	Once    bool     `json:"once" yaml:"once"`
+	Headers []string `json:"headers" yaml:"headers"`
+	Libs    []string `json:"libs" yaml:"libs"`
+	Body    string   `json:"body" yaml:"body"`
+}
+
+var userFilterFuncs = template.FuncMap{
+	"cescape":        cEscape,
+	"cformat_escape": cFormatEscape,
+	"quote":          quoteIfLiteral,
+	"text":           quoteText,
+}
+
+// LoadUserFilters loads the shortcodes in every *.yaml, *.yml and *.json
+// file in dir, each holding a list of UserFilter. A missing dir is not an
+// error. Each shortcode becomes a pongo2 filter, a cgen generator and so a
+// FuncMap function. Must run after InitAll, so a name that is already
+// taken is reported instead of shadowing a built-in.
+//
+// As a filter, a shortcode's arguments are its input followed by its
+// parameter, both split on commas: with params ["dest", "lo", "hi"],
+// {{ "n" | clamp_int : "0,10" }} binds dest=n, lo=0, hi=10. Through cgen
+// or FuncMap each argument is passed on its own.
+func LoadUserFilters(dir string) error {
+	if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	var paths []string
+	for _, pattern := range []string{"*.yaml", "*.yml", "*.json"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return err
+		}
+		paths = append(paths, matches...)
+	}
+	slices.Sort(paths)
+	var errs []error
+	for _, path := range paths {
+		errs = append(errs, loadUserFilterFile(path))
+	}
+	return errors.Join(errs...)
+}
+
+func loadUserFilterFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var specs []UserFilter
+	if filepath.Ext(path) == ".json" {
+		err = json.Unmarshal(data, &specs)
+	} else {
+		err = yaml.Unmarshal(data, &specs)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	var errs []error
+	for _, spec := range specs {
+		if err := registerUserFilter(path, spec); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func registerUserFilter(path string, spec UserFilter) error {
+	if spec.Name == "" {
+		return fmt.Errorf("shortcode without a name")
+	}
+	if _, ok := cgenGenerators[spec.Name]; ok || pongo2.FilterExists(spec.Name) {
+		return fmt.Errorf("shortcode %q is already defined", spec.Name)
+	}
+	body, err := template.New(spec.Name).Funcs(userFilterFuncs).Option("missingkey=error").Parse(spec.Body)
+	if err != nil {
+		return fmt.Errorf("shortcode %q: %w", spec.Name, err)
+	}
+	requirements[spec.Name] = Requirement{Headers: spec.Headers, Libs: spec.Libs, Once: spec.Once}
+
+	expand := func(args []string) (string, error) {
+		if len(args) != len(spec.Params) {
+			return "", fmt.Errorf("%s: shortcode %s takes %d argument(s) (%s), got %d",
+				path, spec.Name, len(spec.Params), strings.Join(spec.Params, ", "), len(args))
+		}
+		bound := make(map[string]string, len(args))
+		for i, name := range spec.Params {
+			bound[name] = strings.TrimSpace(args[i])
+		}
+		var b strings.Builder
+		if err := body.Execute(&b, bound); err != nil {
+			return "", fmt.Errorf("%s: %w", path, err)
+		}
+		return b.String(), nil
+	}
+	if err := registerCgen(spec.Name, expand); err != nil {
+		return err
+	}
+	return registerFilter(spec.Name, func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		var args []string
+		for _, v := range []string{in.String(), param.String()} {
+			if v != "" {
+				args = append(args, strings.Split(v, ",")...)
+			}
+		}
+		code, err := expand(args)
+		if err != nil {
+			return nil, &pongo2.Error{OrigError: err}
+		}
+		return pongo2.AsSafeValue(code), nil
+	})
+}
@@ -0,0 +1,118 @@
+package generators
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+var (
+	testShortcodesOnce sync.Once
+	testShortcodesErr  error
+)
+
+// loadTestShortcodes loads testdata/shortcodes.d. Registration is global
+// and permanent, so it happens once per test binary.
+func loadTestShortcodes(t *testing.T) {
+	t.Helper()
+	if err := InitAll(); err != nil {
+		t.Fatalf("InitAll: %v", err)
+	}
+	testShortcodesOnce.Do(func() {
+		testShortcodesErr = LoadUserFilters(filepath.Join("testdata", "shortcodes.d"))
+	})
+	if testShortcodesErr != nil {
+		t.Fatalf("LoadUserFilters: %v", testShortcodesErr)
+	}
+}
+
+func TestUserFiltersAlongsideBuiltins(t *testing.T) {
+	loadTestShortcodes(t)
+	src, libs := render(t, `{{ "" | auto_free_generic }}
+{{ "" | test_banner }}
+{{ "" | test_banner }}
+int main(void) {
+    const char *raw = "  padded  ";
+    int n = 42, m = 1;
+    {{ "n" | test_clamp_int : "0,10" }}
+    {{ "n,m" | test_swap_int }}
+    {{ "clean" | string_trim : "$raw" }}
+    {{ "" | test_log_line : "hello" }}
+    {{ "" | test_log_line : "$clean" }}
+    banner();
+    printf("%d %d\n", n, m);
+    return 0;
+}
+`)
+	if count := strings.Count(src, "static void banner"); count != 1 {
+		t.Errorf("once-only shortcode emitted %d times", count)
+	}
+	bin := compileC(t, src, libs, sanitize)
+	stdout, stderr, code := runC(t, bin, "")
+	if code != 0 {
+		t.Fatalf("program exited %d: %s\n%s", code, stderr, numbered(src))
+	}
+	if want := "== cccp ==\n1 10\n"; stdout != want {
+		t.Errorf("got stdout %q, want %q", stdout, want)
+	}
+	if want := "log: hello\nlog: padded\n"; stderr != want {
+		t.Errorf("got stderr %q, want %q", stderr, want)
+	}
+}
+
+func TestUserFiltersFuncMap(t *testing.T) {
+	loadTestShortcodes(t)
+	tmpl, err := template.New("t").Funcs(FuncMap()).Parse(
+		`{{ test_clamp_int "n" "0" "10" }}` + "\n" + `{{ safe_fopen "f" "out, final.csv" "w" }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"if (n < 0) n = 0;", `f = fopen("out, final.csv", "w");`} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("FuncMap output lacks %s:\n%s", want, b.String())
+		}
+	}
+}
+
+func TestUserFilterArgumentCount(t *testing.T) {
+	loadTestShortcodes(t)
+	tmpl, err := pongo2.FromString(`{{ "n" | test_clamp_int : "0" }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tmpl.Execute(nil)
+	if err == nil || !strings.Contains(err.Error(), filepath.Join("shortcodes.d", "example.yaml")) ||
+		!strings.Contains(err.Error(), "takes 3 argument(s) (dest, lo, hi), got 2") {
+		t.Errorf("got error %v, want one naming example.yaml and the parameters", err)
+	}
+}
+
+func TestUserFilterCollidesWithBuiltin(t *testing.T) {
+	if err := InitAll(); err != nil {
+		t.Fatalf("InitAll: %v", err)
+	}
+	dir := t.TempDir()
+	spec := "- name: string_trim\n  params: [s]\n  body: '{{.s}}'\n"
+	if err := os.WriteFile(filepath.Join(dir, "dup.yaml"), []byte(spec), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	err := LoadUserFilters(dir)
+	if err == nil || !strings.Contains(err.Error(), `shortcode "string_trim" is already defined`) {
+		t.Errorf("got error %v, want a collision with the built-in", err)
+	}
+}
+
+func TestUserFiltersMissingDir(t *testing.T) {
+	if err := LoadUserFilters(filepath.Join(t.TempDir(), "none")); err != nil {
+		t.Errorf("missing dir: %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package generators
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+func init() {
+	Register(InitWalkFilters)
+}
+
+// walk_dir and walk_dir_recursive open a loop over the entries of a
+// directory, skipping . and .. The entry name is the input; inside the
+// loop it is a const char * to the base name, <entry>_path is the joined
+// path and <entry>_is_dir tells directories apart (symlinks are not
+// followed). Close the loop with the matching *_end filter given the same
+// name. Nested walks only need different entry names. continue moves to
+// the next entry; don't break out of a walk, the directory would leak.
+func InitWalkFilters() error {
+	var errs []error
+
+	// Example usage:
+	// {{ "entry" | walk_dir : "fixtures" }}
+	//     if (!entry_is_dir) count++;
+	// {{ "entry" | walk_dir_end }}
+	errs = append(errs, registerFilter("walk_dir", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		entry := in.String()
+		code := fmt.Sprintf(
+			`{
+    const char *root_%[1]s = %[2]s;
+    DIR *dir_%[1]s = opendir(root_%[1]s);
+    if (!dir_%[1]s) {
+        fprintf(stderr, "Failed to open directory: %%s\n", root_%[1]s);
+        exit(EXIT_FAILURE);
+    }
+    struct dirent *de_%[1]s;
+    while ((de_%[1]s = readdir(dir_%[1]s))) {
+%[3]s
+        {`,
+			entry, quoteIfLiteral(param.String()), walkEntry(entry, "root_"+entry))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Example usage:
+	// {{ "entry" | walk_dir_end }}
+	errs = append(errs, registerFilter("walk_dir_end", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(
+			`        }
+    }
+    closedir(dir_%[1]s);
+}`,
+			in.String())
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Walks the whole tree, visiting each directory's entries before
+	// descending into its subdirectories. Subdirectories that can't be
+	// opened are reported and skipped; only the root failing is fatal.
+	// Example usage:
+	// {{ "file" | walk_dir_recursive : "src" }}
+	//     if (!file_is_dir) printf("%s\n", file_path);
+	// {{ "file" | walk_dir_recursive_end }}
+	errs = append(errs, registerFilter("walk_dir_recursive", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		entry := in.String()
+		code := fmt.Sprintf(
+			`{
+    size_t stack_len_%[1]s = 0, stack_cap_%[1]s = 16;
+    char **stack_%[1]s = malloc(stack_cap_%[1]s * sizeof(char *));
+    char *root_%[1]s = stack_%[1]s ? strdup(%[2]s) : NULL;
+    if (!root_%[1]s) {
+        fprintf(stderr, "Failed to get memory for %[1]s\n");
+        exit(EXIT_FAILURE);
+    }
+    stack_%[1]s[stack_len_%[1]s++] = root_%[1]s;
+    while (stack_len_%[1]s > 0) {
+        char *dir_path_%[1]s = stack_%[1]s[--stack_len_%[1]s];
+        DIR *dir_%[1]s = opendir(dir_path_%[1]s);
+        bool at_root_%[1]s = root_%[1]s != NULL;
+        root_%[1]s = NULL;
+        if (!dir_%[1]s) {
+            fprintf(stderr, "Failed to open directory: %%s\n", dir_path_%[1]s);
+            if (at_root_%[1]s) {
+                exit(EXIT_FAILURE);
+            }
+            free(dir_path_%[1]s);
+            continue;
+        }
+        struct dirent *de_%[1]s;
+        while ((de_%[1]s = readdir(dir_%[1]s))) {
+%[3]s
+            if (%[1]s_is_dir) {
+                if (stack_len_%[1]s == stack_cap_%[1]s) {
+                    char **grown_%[1]s = realloc(stack_%[1]s, stack_cap_%[1]s * 2 * sizeof(char *));
+                    if (!grown_%[1]s) {
+                        fprintf(stderr, "Failed to get memory for %[1]s\n");
+                        exit(EXIT_FAILURE);
+                    }
+                    stack_%[1]s = grown_%[1]s;
+                    stack_cap_%[1]s *= 2;
+                }
+                stack_%[1]s[stack_len_%[1]s] = strdup(%[1]s_path);
+                if (!stack_%[1]s[stack_len_%[1]s]) {
+                    fprintf(stderr, "Failed to get memory for %[1]s\n");
+                    exit(EXIT_FAILURE);
+                }
+                stack_len_%[1]s++;
+            }
+            {`,
+			entry, quoteIfLiteral(param.String()), walkEntry(entry, "dir_path_"+entry))
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	// Example usage:
+	// {{ "file" | walk_dir_recursive_end }}
+	errs = append(errs, registerFilter("walk_dir_recursive_end", func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		code := fmt.Sprintf(
+			`            }
+        }
+        closedir(dir_%[1]s);
+        free(dir_path_%[1]s);
+    }
+    free(stack_%[1]s);
+}`,
+			in.String())
+		return pongo2.AsSafeValue(code), nil
+	}))
+
+	return errors.Join(errs...)
+}
+
+// walkEntry generates the per-entry preamble of a walk loop: skip . and ..,
+// then declare the entry name, joined path and is_dir flag.
+func walkEntry(entry, dirPath string) string {
+	return fmt.Sprintf(
+		`        const char *%[1]s = de_%[1]s->d_name;
+        if (strcmp(%[1]s, ".") == 0 || strcmp(%[1]s, "..") == 0) {
+            continue;
+        }
+        char %[1]s_path[PATH_MAX];
+        if (snprintf(%[1]s_path, sizeof(%[1]s_path), "%%s/%%s", %[2]s, %[1]s) >= (int)sizeof(%[1]s_path)) {
+            fprintf(stderr, "Path too long: %%s/%%s\n", %[2]s, %[1]s);
+            continue;
+        }
+        struct stat %[1]s_st;
+        bool %[1]s_is_dir = lstat(%[1]s_path, &%[1]s_st) == 0 && S_ISDIR(%[1]s_st.st_mode);
+        (void)%[1]s_is_dir;`,
+		entry, dirPath)
+}
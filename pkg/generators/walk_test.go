@@ -0,0 +1,88 @@
+package generators
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// walkFixtures creates fixtures/a.txt, fixtures/b.txt and
+// fixtures/sub/deep/c.txt under a temporary directory and returns it.
+func walkFixtures(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "sub/deep/c.txt"} {
+		path := filepath.Join(dir, "fixtures", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func sortedLines(s string) []string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	slices.Sort(lines)
+	return lines
+}
+
+func TestWalkDir(t *testing.T) {
+	src, libs := render(t, `int main(void) {
+    {{ "entry" | walk_dir : "fixtures" }}
+        printf("%s %s %d\n", entry, entry_path, entry_is_dir);
+    {{ "entry" | walk_dir_end }}
+    return 0;
+}
+`)
+	bin := compileC(t, src, libs, sanitize)
+	stdout, stderr, code := runC(t, bin, walkFixtures(t))
+	if code != 0 {
+		t.Fatalf("program exited %d: %s", code, stderr)
+	}
+	want := []string{
+		"a.txt fixtures/a.txt 0",
+		"b.txt fixtures/b.txt 0",
+		"sub fixtures/sub 1",
+	}
+	if got := sortedLines(stdout); !slices.Equal(got, want) {
+		t.Errorf("got entries %q, want %q", got, want)
+	}
+}
+
+func TestWalkDirRecursive(t *testing.T) {
+	src, libs := render(t, `int main(void) {
+    {{ "file" | walk_dir_recursive : "fixtures" }}
+        if (!file_is_dir) printf("%s\n", file_path);
+    {{ "file" | walk_dir_recursive_end }}
+    return 0;
+}
+`)
+	bin := compileC(t, src, libs, sanitize)
+	stdout, stderr, code := runC(t, bin, walkFixtures(t))
+	if code != 0 {
+		t.Fatalf("program exited %d: %s", code, stderr)
+	}
+	want := []string{"fixtures/a.txt", "fixtures/b.txt", "fixtures/sub/deep/c.txt"}
+	if got := sortedLines(stdout); !slices.Equal(got, want) {
+		t.Errorf("got files %q, want %q", got, want)
+	}
+}
+
+func TestWalkDirMissingRoot(t *testing.T) {
+	src, libs := render(t, `int main(void) {
+    {{ "entry" | walk_dir : "src" }}
+    {{ "entry" | walk_dir_end }}
+    return 0;
+}
+`)
+	bin := compileC(t, src, libs)
+	_, stderr, code := runC(t, bin, t.TempDir())
+	if code == 0 || !strings.Contains(stderr, "Failed to open directory: src") {
+		t.Errorf("got exit %d, stderr %q; want a failure naming src", code, stderr)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/flosch/pongo2/v6"
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is how long the watcher waits after the last event before
+// rebuilding, so an editor's write/rename bursts trigger one rebuild.
+const watchDebounce = 200 * time.Millisecond
+
+// watch renders everything once, then re-renders changed templates (or all of
+// them when the context file or a partial changes) until interrupted with
+// Ctrl-C.
+func watch(opts options) error {
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return watchUntil(sigCtx, opts, os.Stdout)
+}
+
+// watchUntil is watch until done is cancelled, with status lines written
+// to out.
+func watchUntil(done context.Context, opts options, out io.Writer) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	if err := addWatchDirs(watcher, opts.srcDir); err != nil {
+		return err
+	}
+	contextPath := ""
+	if opts.contextFile != "" {
+		contextPath = filepath.Clean(opts.contextFile)
+		if err := watcher.Add(filepath.Dir(contextPath)); err != nil {
+			return err
+		}
+	}
+
+	w := &watchState{opts: opts, flags: buildFlags{}, out: out}
+	w.rebuildAll(0)
+	pending := map[string]bool{}
+	timer := time.NewTimer(watchDebounce)
+	timer.Stop()
+
+	for {
+		select {
+		case <-done.Done():
+			fmt.Fprintln(out, "watch: stopped")
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := addWatchDirs(watcher, event.Name); err != nil {
+						w.logStatus("watch error: %s is not watched: %v", event.Name, err)
+					}
+				}
+			}
+			if event.Has(fsnotify.Write) || event.Has(fsnotify.Create) || event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+				pending[filepath.Clean(event.Name)] = true
+				timer.Reset(watchDebounce)
+			}
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			w.logStatus("watch error: %v", err)
+
+		case <-timer.C:
+			removed := w.removeStale(pending)
+			if w.ctx == nil || (contextPath != "" && pending[contextPath]) || anyPartial(pending) {
+				w.rebuildAll(removed)
+			} else {
+				w.rebuildChanged(pending, removed)
+			}
+			pending = map[string]bool{}
+		}
+	}
+}
+
+// anyPartial reports whether a partial is among the changed paths. Any
+// template may include it, so that takes a full rebuild.
+func anyPartial(changed map[string]bool) bool {
+	for path := range changed {
+		if isPartial(path) {
+			return true
+		}
+	}
+	return false
+}
+
+func addWatchDirs(watcher *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return watcher.Add(path)
+		}
+		return nil
+	})
+}
+
+// watchState is what the watcher keeps between rebuilds: the context of
+// the last full rebuild (nil if it failed to load) and every output's link
+// flags.
+type watchState struct {
+	opts  options
+	flags buildFlags
+	ctx   pongo2.Context
+	out   io.Writer
+}
+
+// rebuildAll reloads the context and renders every template.
+func (w *watchState) rebuildAll(removed int) {
+	ctx, err := buildContext(w.opts.contextFile, w.opts.defines)
+	if err != nil {
+		w.ctx = nil
+		w.logStatus("context error: %v", err)
+		return
+	}
+	w.ctx = ctx
+
+	generated, err := runGeneration(w.opts, ctx, w.flags)
+	if ferr := formatOutputs(w.opts, generated); ferr != nil {
+		err = errors.Join(err, ferr)
+	}
+	w.reportRebuild(len(generated), removed, err)
+}
+
+func (w *watchState) rebuildChanged(changed map[string]bool, removed int) {
+	var generated []string
+	var errs []error
+	srcDir := filepath.Clean(w.opts.srcDir)
+
+	for path := range changed {
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		if rel, err := filepath.Rel(srcDir, path); err != nil || !filepath.IsLocal(rel) {
+			continue
+		}
+
+		dest, err := generateFile(w.opts, path, w.ctx, w.flags)
+		if err != nil {
+			errs = append(errs, err)
+		} else if dest != "" {
+			generated = append(generated, dest)
+		}
+	}
+
+	if len(generated) == 0 && len(errs) == 0 && removed == 0 {
+		return
+	}
+	if err := w.flags.write(w.opts.outDir); err != nil {
+		errs = append(errs, err)
+	}
+	err := summarizeErrors(errs)
+	if ferr := formatOutputs(w.opts, generated); ferr != nil {
+		err = errors.Join(err, ferr)
+	}
+	w.reportRebuild(len(generated), removed, err)
+}
+
+// removeStale deletes the output of every changed source path that no
+// longer exists, a removed or renamed-away template or asset, and returns
+// how many outputs it deleted. A removed directory takes its mirrored
+// output directory with it.
+func (w *watchState) removeStale(changed map[string]bool) int {
+	removed := 0
+	srcDir := filepath.Clean(w.opts.srcDir)
+	for path := range changed {
+		if _, err := os.Lstat(path); !errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		rel, err := filepath.Rel(srcDir, path)
+		if err != nil || !filepath.IsLocal(rel) {
+			continue
+		}
+
+		dest := filepath.Join(w.opts.outDir, rel)
+		if info, err := os.Stat(dest); err == nil && info.IsDir() {
+			for out := range w.flags {
+				if strings.HasPrefix(out, dest+string(filepath.Separator)) {
+					delete(w.flags, out)
+					removed++
+				}
+			}
+			if err := os.RemoveAll(dest); err != nil {
+				w.logStatus("watch error: %v", err)
+			}
+			continue
+		}
+
+		if strings.HasSuffix(rel, ".tpl") {
+			dest = strings.TrimSuffix(dest, ".tpl")
+		} else if !w.opts.copyAssets {
+			continue
+		}
+		delete(w.flags, dest)
+		if err := os.Remove(dest); err == nil {
+			removed++
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			w.logStatus("watch error: %v", err)
+		}
+	}
+	return removed
+}
+
+func (w *watchState) reportRebuild(count, removed int, err error) {
+	status := fmt.Sprintf("rebuilt %d file(s)", count)
+	if removed > 0 {
+		status += fmt.Sprintf(", removed %d", removed)
+	}
+	if err != nil {
+		w.logStatus("%s with errors: %v", status, err)
+		return
+	}
+	w.logStatus("%s", status)
+}
+
+// logStatus prints one timestamped status line.
+func (w *watchState) logStatus(format string, args ...any) {
+	fmt.Fprintf(w.out, "[%s] %s\n", time.Now().Format("15:04:05"), oneLine(fmt.Sprintf(format, args...)))
+}
+
+// oneLine flattens multi-line text, such as the error summarizeErrors
+// makes, so it fits on one status line.
+func oneLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	return strings.ReplaceAll(strings.Join(lines, "; "), ":; ", ": ")
+}
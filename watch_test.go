@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lockedBuffer collects the watcher's status lines while it runs.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) lines() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return strings.Split(strings.TrimSuffix(b.buf.String(), "\n"), "\n")
+}
+
+// waitLines waits for the watcher to have printed n lines and returns them.
+func (b *lockedBuffer) waitLines(t *testing.T, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		lines := b.lines()
+		if len(lines) >= n && lines[0] != "" {
+			return lines
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("waited for %d status line(s), got %q", n, lines)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+var stampRe = regexp.MustCompile(`^\[\d\d:\d\d:\d\d\] `)
+
+func TestWatchStatusIsOneLine(t *testing.T) {
+	var out bytes.Buffer
+	w := &watchState{out: &out}
+	w.reportRebuild(2, 1, summarizeErrors([]error{
+		errors.New("src/a.c.tpl: line 1\nline 2"),
+		errors.New("src/b.c.tpl: bad"),
+	}))
+	w.reportRebuild(3, 0, nil)
+
+	want := []string{
+		"rebuilt 2 file(s), removed 1 with errors: 2 file(s) failed: src/a.c.tpl: line 1; line 2; src/b.c.tpl: bad",
+		"rebuilt 3 file(s)",
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("got %q, want %d lines", out.String(), len(want))
+	}
+	for i, line := range lines {
+		if !stampRe.MatchString(line) || stampRe.ReplaceAllString(line, "") != want[i] {
+			t.Errorf("line %d: got %q, want a timestamp and %q", i, line, want[i])
+		}
+	}
+}
+
+func TestWatchRebuilds(t *testing.T) {
+	dir := t.TempDir()
+	src, outDir := filepath.Join(dir, "src"), filepath.Join(dir, "out")
+	writeTree(t, src, map[string]string{
+		"a.c.tpl": "int a;\n",
+		"b.c.tpl": "int b = {{ n }};\n",
+	})
+	opts := options{srcDir: src, outDir: outDir, noFormat: true, defines: defineFlags{"n=7"}}
+
+	var out lockedBuffer
+	done, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() { result <- watchUntil(done, opts, &out) }()
+	defer func() {
+		cancel()
+		if err := <-result; err != nil {
+			t.Errorf("watch: %v", err)
+		}
+		if lines := out.lines(); lines[len(lines)-1] != "watch: stopped" {
+			t.Errorf("got last line %q, want watch: stopped", lines[len(lines)-1])
+		}
+	}()
+
+	status := func(n int) string {
+		t.Helper()
+		lines := out.waitLines(t, n)
+		return stampRe.ReplaceAllString(lines[n-1], "")
+	}
+	if got := status(1); got != "rebuilt 2 file(s)" {
+		t.Fatalf("initial build: got %q", got)
+	}
+
+	// A burst of writes is debounced into a single rebuild.
+	for i := range 5 {
+		writeTree(t, src, map[string]string{"a.c.tpl": strings.Repeat("int a;\n", i+1)})
+		time.Sleep(watchDebounce / 10)
+	}
+	if got := status(2); got != "rebuilt 1 file(s)" {
+		t.Errorf("after a burst: got %q", got)
+	}
+	time.Sleep(2 * watchDebounce)
+	if lines := out.lines(); len(lines) != 2 {
+		t.Errorf("a burst of writes gave %d rebuilds: %q", len(lines)-1, lines[1:])
+	}
+	if got := readFile(t, filepath.Join(outDir, "a.c")); got != strings.Repeat("int a;\n", 5) {
+		t.Errorf("a.c is stale: %q", got)
+	}
+
+	// A render error is reported on the status line without stopping.
+	writeTree(t, src, map[string]string{"b.c.tpl": "{% if %}\n"})
+	if got := status(3); !strings.HasPrefix(got, "rebuilt 0 file(s) with errors: 1 file(s) failed: "+filepath.Join(src, "b.c.tpl")) {
+		t.Errorf("after a bad edit: got %q", got)
+	}
+
+	// Removing a template removes its output.
+	if err := os.Remove(filepath.Join(src, "a.c.tpl")); err != nil {
+		t.Fatal(err)
+	}
+	if got := status(4); got != "rebuilt 0 file(s), removed 1" {
+		t.Errorf("after a removal: got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "a.c")); !os.IsNotExist(err) {
+		t.Errorf("a.c was not removed: %v", err)
+	}
+
+	// New directories are watched.
+	if err := os.Mkdir(filepath.Join(src, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * watchDebounce)
+	writeTree(t, src, map[string]string{"sub/c.c.tpl": "int c;\n"})
+	if got := status(5); got != "rebuilt 1 file(s)" {
+		t.Errorf("after adding sub/c.c.tpl: got %q", got)
+	}
+	if got := readFile(t, filepath.Join(outDir, "sub", "c.c")); got != "int c;\n" {
+		t.Errorf("got sub/c.c %q", got)
+	}
+}